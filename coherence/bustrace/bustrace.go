@@ -0,0 +1,166 @@
+/*
+Package bustrace implements a Tracer struct which writes every event of the bus to a JSON Lines file, e.g. to analyse
+the traffic offline or to show the exact sequence of transactions leading to a bug. An event is only written if it is
+in the cycle window and for one of the blocks of the configuration.
+*/
+package bustrace
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"math"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/bus"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/cache"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/clock"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/xact"
+)
+
+type Config struct {
+	File      string   `json:"file"`       // JSON Lines file the events are written to, none is written if empty
+	Addresses []uint32 `json:"addresses"`  // Only the events for the blocks of these addresses are written, all if empty
+	FromCycle int      `json:"from_cycle"` // First cycle whose events are written
+	ToCycle   int      `json:"to_cycle"`   // Last cycle whose events are written, 0 for no limit
+}
+
+// Record is a line of the file.
+type Record struct {
+	Cycle          int           `json:"cycle"`
+	Event          string        `json:"event"` // grant, request, reply or release
+	SenderId       int           `json:"sender"`
+	RequesterId    int           `json:"requester"` // The cache whose request is served
+	Type           string        `json:"type"`
+	Address        uint32        `json:"address"`
+	RequestedWords uint32        `json:"requested_words"`
+	SentWords      uint32        `json:"sent_words"`
+	StateChanges   []StateChange `json:"state_changes"` // Caches whose line of the block changed state in response
+}
+
+type StateChange struct {
+	CacheId int    `json:"cache"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+}
+
+// State of a block which is not cached, whether the protocol has an Invalid state or not.
+const invalidState = "Invalid"
+
+type Tracer struct {
+	config        Config
+	caches        []cache.CacheController
+	clock         *clock.Clock
+	offsetNumBits uint32
+	blocks        map[uint32]bool // Block addresses of the configuration, nil if every block is written
+	writer        *bufio.Writer
+	encoder       *json.Encoder
+	events        []*event // Events whose AfterEvent has not been called yet, the innermost last
+	records       []Record // Records waiting for the outermost event to end, in the order the events started
+	err           error    // First error writing the records, after which none is written
+}
+
+// event is an event of the bus being handled by the caches.
+type event struct {
+	isWritten    bool
+	recordIndex  int
+	statesBefore []string // State of the block in every cache before the event
+}
+
+// blockSize is in bytes. The records are buffered, Flush MUST be called once the simulation ends.
+func NewTracer(config Config, caches []cache.CacheController, blockSize int, clock *clock.Clock,
+	w io.Writer) *Tracer {
+	t := &Tracer{
+		config:        config,
+		caches:        caches,
+		clock:         clock,
+		offsetNumBits: uint32(math.Log2(float64(blockSize))),
+		writer:        bufio.NewWriter(w),
+	}
+	t.encoder = json.NewEncoder(t.writer)
+
+	if len(config.Addresses) > 0 {
+		t.blocks = map[uint32]bool{}
+		for _, address := range config.Addresses {
+			t.blocks[t.getBlockAddress(address)] = true
+		}
+	}
+	return t
+}
+
+func (t *Tracer) BeforeEvent(eventType bus.EventType, transaction xact.Transaction) {
+	e := &event{isWritten: t.isWritten(transaction), recordIndex: len(t.records)}
+	t.events = append(t.events, e)
+	if !e.isWritten {
+		return
+	}
+
+	for _, c := range t.caches {
+		e.statesBefore = append(e.statesBefore, getStateName(c.GetLineState(transaction.Address)))
+	}
+	t.records = append(t.records, Record{Cycle: t.clock.GetCycle(), Event: eventType.String()})
+}
+
+// The records of the events notified during another event are written after the record of the latter, so that the
+// records are in the order the events started.
+func (t *Tracer) AfterEvent(eventType bus.EventType, transaction xact.Transaction) {
+	e := t.events[len(t.events)-1]
+	t.events = t.events[:len(t.events)-1]
+	if e.isWritten {
+		t.completeRecord(&t.records[e.recordIndex], e, transaction)
+	}
+
+	if len(t.events) > 0 {
+		return
+	}
+	for _, record := range t.records {
+		if t.err == nil {
+			t.err = t.encoder.Encode(record)
+		}
+	}
+	t.records = t.records[:0]
+}
+
+// Write the buffered records and return the first error writing them, if any.
+func (t *Tracer) Flush() error {
+	if t.err != nil {
+		return t.err
+	}
+	return t.writer.Flush()
+}
+
+// The transaction given after an event is the one the caches handled, e.g. the one sent by a cache granted the bus.
+func (t *Tracer) completeRecord(record *Record, e *event, transaction xact.Transaction) {
+	record.SenderId = transaction.SenderId
+	record.RequesterId = transaction.RequesterId
+	record.Type = transaction.TransactionType.String()
+	record.Address = transaction.Address
+	record.RequestedWords = transaction.RequestedDataSize
+	record.SentWords = transaction.SendDataSize
+	record.StateChanges = []StateChange{}
+	for i, c := range t.caches {
+		state := getStateName(c.GetLineState(transaction.Address))
+		if state != e.statesBefore[i] {
+			record.StateChanges = append(record.StateChanges, StateChange{CacheId: i, From: e.statesBefore[i],
+				To: state})
+		}
+	}
+}
+
+func (t *Tracer) isWritten(transaction xact.Transaction) bool {
+	cycle := t.clock.GetCycle()
+	if cycle < t.config.FromCycle || (t.config.ToCycle > 0 && cycle > t.config.ToCycle) {
+		return false
+	}
+	return t.blocks == nil || t.blocks[t.getBlockAddress(transaction.Address)]
+}
+
+func (t *Tracer) getBlockAddress(address uint32) uint32 {
+	return address >> t.offsetNumBits << t.offsetNumBits
+}
+
+func getStateName(state cache.LineState) string {
+	if state.Name == "" && state.Transient == "" {
+		return invalidState
+	}
+	return state.GetDisplayName()
+}
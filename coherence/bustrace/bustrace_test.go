@@ -0,0 +1,107 @@
+package bustrace
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/bus"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/cache"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/clock"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/xact"
+	"github.com/chriskheng/cs4223-assignment2/coherence/testutils"
+)
+
+const blockSize = 16
+
+type tracedEvent struct {
+	cycle   int
+	address uint32
+}
+
+type filterTest struct {
+	name    string
+	config  Config
+	written []tracedEvent // Expected events of tracedEvents which are written, in the same order
+}
+
+// Requests traced from cycle 1 to 3, in blocks 0x0, 0x20 and 0x40.
+var tracedEvents = []tracedEvent{
+	{cycle: 1, address: 0x0}, {cycle: 1, address: 0x24}, {cycle: 2, address: 0x20}, {cycle: 2, address: 0x44},
+	{cycle: 3, address: 0x8},
+}
+
+var filterTests = []filterTest{
+	{name: "no filter", written: tracedEvents},
+	{
+		name:    "addresses of the same block",
+		config:  Config{Addresses: []uint32{0x28}},
+		written: []tracedEvent{{cycle: 1, address: 0x24}, {cycle: 2, address: 0x20}},
+	},
+	{
+		name:    "several blocks",
+		config:  Config{Addresses: []uint32{0x4, 0x40}},
+		written: []tracedEvent{{cycle: 1, address: 0x0}, {cycle: 2, address: 0x44}, {cycle: 3, address: 0x8}},
+	},
+	{
+		name:    "from cycle",
+		config:  Config{FromCycle: 2},
+		written: []tracedEvent{{cycle: 2, address: 0x20}, {cycle: 2, address: 0x44}, {cycle: 3, address: 0x8}},
+	},
+	{
+		name:    "to cycle",
+		config:  Config{ToCycle: 1},
+		written: []tracedEvent{{cycle: 1, address: 0x0}, {cycle: 1, address: 0x24}},
+	},
+	{
+		name:    "cycle window of a single cycle",
+		config:  Config{FromCycle: 2, ToCycle: 2},
+		written: []tracedEvent{{cycle: 2, address: 0x20}, {cycle: 2, address: 0x44}},
+	},
+	{
+		name:    "cycle window and addresses",
+		config:  Config{Addresses: []uint32{0x0}, FromCycle: 2, ToCycle: 3},
+		written: []tracedEvent{{cycle: 3, address: 0x8}},
+	},
+	{
+		name:   "cycle window without events",
+		config: Config{FromCycle: 4},
+	},
+}
+
+func TestFilters(t *testing.T) {
+	for _, test := range filterTests {
+		clock := clock.NewClock()
+		b := bus.NewBus(bus.Config{TransferCycles: 2, Width: 1}, blockSize, clock)
+		caches := []cache.CacheController{cache.NewMesiCache(0, b, blockSize, 2, 64, cache.ReplacementConfig{})}
+		var buffer bytes.Buffer
+		tracer := NewTracer(test.config, caches, blockSize, clock, &buffer)
+
+		for _, event := range tracedEvents {
+			clock.Advance(event.cycle - clock.GetCycle())
+			transaction := xact.Transaction{TransactionType: xact.BusRead, Address: event.address, SenderId: 0}
+			tracer.BeforeEvent(bus.RequestEvent, transaction)
+			tracer.AfterEvent(bus.RequestEvent, transaction)
+		}
+		if err := tracer.Flush(); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		written := []tracedEvent{}
+		scanner := bufio.NewScanner(&buffer)
+		for scanner.Scan() {
+			var record Record
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				t.Fatalf("%s: invalid line %s: %v", test.name, scanner.Text(), err)
+			}
+			written = append(written, tracedEvent{cycle: record.Cycle, address: record.Address})
+		}
+
+		if fmt.Sprint(written) != fmt.Sprint(test.written) {
+			identifier := fmt.Sprintf("events written (%s)", test.name)
+			t.Errorf(testutils.GetErrorString(identifier, fmt.Sprint(test.written), fmt.Sprint(written)))
+		}
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Package checker implements a Checker struct which checks the coherence invariants on the states of the cache lines of
+every cache controller during a simulation.
+*/
+package checker
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/cache"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/xact"
+	"github.com/chriskheng/cs4223-assignment2/coherence/simerror"
+)
+
+// Checker records the blocks of the transactions on the bus or the network, and checks them at the end of the cycle
+// once every cache controller has handled the transactions. The invariants are:
+// * a copy in an exclusive state (e.g. Modified or Exclusive) is the only valid copy of the block
+// * at most one copy is in an owner state (e.g. Owned, Dragon SharedModified or MESIF Forward)
+type Checker struct {
+	caches        []cache.CacheController // Indexed by cache id
+	offsetNumBits uint32
+	addresses     []uint32 // Block addresses of the transactions of the current cycle
+}
+
+// blockSize is in bytes.
+func NewChecker(caches []cache.CacheController, blockSize int) *Checker {
+	return &Checker{caches: caches, offsetNumBits: uint32(math.Log2(float64(blockSize)))}
+}
+
+func (c *Checker) OnTransaction(transaction xact.Transaction) {
+	blockAddress := transaction.Address >> c.offsetNumBits << c.offsetNumBits
+	for _, address := range c.addresses {
+		if address == blockAddress {
+			return
+		}
+	}
+	c.addresses = append(c.addresses, blockAddress)
+}
+
+// Check the blocks of the transactions since the last check, and return the first violation found without its cycle.
+func (c *Checker) Check() *simerror.CoherenceError {
+	addresses := c.addresses
+	c.addresses = c.addresses[:0]
+	for _, address := range addresses {
+		if err := c.checkBlock(address); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Checker) checkBlock(address uint32) *simerror.CoherenceError {
+	states := make([]cache.LineState, len(c.caches))
+	numValid := 0
+	exclusive := -1
+	owners := map[string]int{}
+	for id := range c.caches {
+		states[id] = c.caches[id].GetLineState(address)
+		if !states[id].IsValid {
+			continue
+		}
+		numValid++
+		if states[id].IsExclusive {
+			exclusive = id
+		}
+		if states[id].IsOwner {
+			owners[states[id].Name]++
+		}
+	}
+
+	if exclusive != -1 && numValid > 1 {
+		return newViolation(address, states, fmt.Sprintf("cache %d holds the block in %s state but %d other caches "+
+			"hold a valid copy", exclusive, states[exclusive].GetDisplayName(), numValid-1))
+	}
+	for name, numOwners := range owners {
+		if numOwners > 1 {
+			return newViolation(address, states, fmt.Sprintf("%d caches hold the block in %s state", numOwners, name))
+		}
+	}
+	return nil
+}
+
+func newViolation(address uint32, states []cache.LineState, invariant string) *simerror.CoherenceError {
+	err := &simerror.CoherenceError{Address: address, Invariant: invariant}
+	for _, state := range states {
+		name := state.GetDisplayName()
+		if name == "" {
+			name = "not cached"
+		}
+		err.LineStates = append(err.LineStates, name)
+	}
+	return err
+}
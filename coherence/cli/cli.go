@@ -0,0 +1,80 @@
+/*
+Package cli implements the command line interface of the simulator. It has the run, sweep, trace-stats, validate and
+debug subcommands, and keeps the positional form of the arguments used by the experiment scripts.
+*/
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+type command struct {
+	name        string
+	description string
+	run         func(args []string) int
+}
+
+var commands = []command{
+	{"run", "Simulate a system and print its statistics", runRun},
+	{"sweep", "Simulate every combination of the given protocols and cache configurations", runSweep},
+	{"trace-stats", "Print the statistics of the trace of every core, independently of the simulated system",
+		runTraceStats},
+	{"validate", "Check the configuration of a system and print it as JSON", runValidate},
+	{"debug", "Step through a simulation interactively, with breakpoints", runDebug},
+}
+
+// Main runs the command given by the arguments, which exclude the program name, and returns the exit code. The
+// arguments are in the positional form if they do not start with a subcommand.
+func Main(args []string) int {
+	if len(args) > 0 {
+		for _, c := range commands {
+			if c.name == args[0] {
+				return c.run(args[1:])
+			}
+		}
+	}
+	return runLegacy(args)
+}
+
+func newFlagSet(name string, description string) *flag.FlagSet {
+	flags := flag.NewFlagSet("coherence "+name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: coherence %s [flags]\n\n%s.\n\nFlags:\n", name, description)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// Parse the flags of a subcommand, which takes no positional arguments. Return the exit code and false if the
+// subcommand must not go on, e.g. because the flags are invalid or the help is requested.
+func parseFlags(flags *flag.FlagSet, args []string) (int, bool) {
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0, false
+		}
+		return 2, false
+	}
+
+	if flags.NArg() > 0 {
+		fmt.Fprintf(flags.Output(), "unexpected argument %s\n", flags.Arg(0))
+		flags.Usage()
+		return 2, false
+	}
+	return 0, true
+}
+
+// Print the error of a subcommand and return the exit code.
+func fail(name string, err error) int {
+	fmt.Fprintf(os.Stderr, "coherence %s: %s\n", name, err.Error())
+	return 1
+}
+
+func printCommands(w io.Writer) {
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-12s %s\n", c.name, c.description)
+	}
+}
@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"os"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/debugger"
+	"github.com/chriskheng/cs4223-assignment2/coherence/simulation"
+	"github.com/chriskheng/cs4223-assignment2/coherence/simulator"
+)
+
+func runDebug(args []string) int {
+	flags := newFlagSet("debug", "Step through a simulation with the commands read from the standard input")
+	system := newSystemFlags(flags, true)
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+	system.recordSetFlags(flags)
+
+	c, err := system.loadConfig(os.Stderr)
+	if err != nil {
+		return fail("debug", err)
+	}
+
+	if err := system.validate(c); err != nil {
+		return fail("debug", err)
+	}
+
+	traces, closeTraces, err := simulation.OpenTraceFiles(c)
+	if err != nil {
+		return fail("debug", err)
+	}
+	defer closeTraces()
+
+	sim, err := simulation.New(c, traces)
+	if err != nil {
+		return fail("debug", err)
+	}
+
+	baseSimulator := sim.(*simulator.BaseSimulator)
+	debugger.NewDebugger(baseSimulator, c.L1.BlockSize, os.Stdout).Run(os.Stdin)
+	if err := baseSimulator.CloseBusTrace(); err != nil {
+		return fail("debug", err)
+	}
+	return 0
+}
@@ -0,0 +1,250 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/config"
+	"github.com/chriskheng/cs4223-assignment2/coherence/simulation"
+	"github.com/chriskheng/cs4223-assignment2/coherence/stats"
+)
+
+// Run the simulation given by the positional form of the arguments, in which the statistics are printed as text to
+// the standard output and as CSV to the standard error. They are also written to a report file if it is given.
+func runLegacy(args []string) int {
+	flags := flag.NewFlagSet("coherence", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	system := newSystemFlags(flags, false)
+	report := &outputFlags{
+		format:     flags.String("report-format", "csv", ""),
+		path:       flags.String("report", "", ""),
+		formatName: "report-format",
+	}
+
+	c, err := parseLegacy(flags, system, args)
+	if err == nil {
+		_, err = report.getFormat()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		fmt.Fprintln(os.Stderr, "")
+		printLegacyUsage(os.Stderr)
+		return 2
+	}
+
+	results, err := simulation.RunTraceFiles(context.Background(), c)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+
+	stats.PrintStatistics(os.Stdout, results)
+	stats.PrintStatisticsCsv(os.Stderr, results)
+
+	if *report.path != "" {
+		if err := writeReport(report, c, results); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
+	}
+	return 0
+}
+
+func writeReport(report *outputFlags, c config.Config, results stats.Results) error {
+	format, _ := report.getFormat()
+	w, err := report.open()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	return newReporter(format).Report(w, c.GetRunInfo(), results)
+}
+
+func parseLegacy(flags *flag.FlagSet, system *systemFlags, args []string) (config.Config, error) {
+	if err := flags.Parse(args); err != nil {
+		return config.Config{}, err
+	}
+	system.recordSetFlags(flags)
+
+	c, err := system.loadBaseConfig()
+	if err != nil {
+		return config.Config{}, err
+	}
+
+	args = flags.Args()
+	isArgsCountValid := len(args) == 2 || len(args) == 5 || len(args) == 6 ||
+		(len(args) == 0 && *system.configPath != "")
+	if !isArgsCountValid {
+		return config.Config{}, errors.New("incorrect number of arguments provided")
+	}
+
+	if len(args) >= 2 {
+		if err := parseProtocolAndBenchmark(&c, system, args[0:2]); err != nil {
+			return config.Config{}, err
+		}
+	}
+
+	if len(args) >= 5 {
+		if err := parseCacheConfigs(&c, system, args[2:5]); err != nil {
+			return config.Config{}, err
+		}
+	} else if *system.configPath == "" {
+		fmt.Printf("Using default cache config => cache size: %dB, associativity: %d, block size: %dB\n",
+			c.L1.Size, c.L1.Associativity, c.L1.BlockSize)
+	}
+
+	if len(args) == 6 {
+		if err := parseNumCores(&c, system, args[5]); err != nil {
+			return config.Config{}, err
+		}
+	}
+
+	if err := system.apply(&c); err != nil {
+		return config.Config{}, err
+	}
+
+	if err := discoverNumCores(&c, os.Stdout); err != nil {
+		return config.Config{}, err
+	}
+
+	if err := system.validate(c); err != nil {
+		return config.Config{}, err
+	}
+
+	fmt.Printf("Using replacement policy: %s\n", c.L1.Replacement.Policy)
+	return c, nil
+}
+
+// The invalid fields given by the positional arguments are named after them.
+func setArgument(system *systemFlags, field string, name string) {
+	system.fieldNames[field] = name
+	system.isSet[name] = true
+}
+
+func parseProtocolAndBenchmark(c *config.Config, system *systemFlags, args []string) error {
+	if err := c.Protocol.UnmarshalText([]byte(args[0])); err != nil {
+		return errors.New("invalid protocol")
+	}
+	c.TracePrefix = args[1]
+	setArgument(system, "trace_prefix", "input_file_prefix")
+	return nil
+}
+
+func parseCacheConfigs(c *config.Config, system *systemFlags, configs []string) error {
+	cacheSizeValue, err1 := strconv.Atoi(configs[0])
+	associativityValue, err2 := strconv.Atoi(configs[1])
+	blockSizeValue, err3 := strconv.Atoi(configs[2])
+
+	if err1 != nil || err2 != nil || err3 != nil {
+		return errors.New("cache_size, associativity, or block_size provided is not an integer")
+	}
+
+	c.L1.Size = cacheSizeValue
+	c.L1.Associativity = associativityValue
+	c.L1.BlockSize = blockSizeValue
+	setArgument(system, "l1.size", "cache_size")
+	setArgument(system, "l1.associativity", "associativity")
+	setArgument(system, "l1.block_size", "block_size")
+	return nil
+}
+
+func parseNumCores(c *config.Config, system *systemFlags, numCores string) error {
+	numCoresValue, err := strconv.Atoi(numCores)
+	if err != nil || numCoresValue < 1 {
+		return errors.New("num_cores provided is not a positive integer")
+	}
+
+	c.NumCores = numCoresValue
+	setArgument(system, "num_cores", "num_cores")
+	return nil
+}
+
+func printLegacyUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: coherence [options] <protocol> <input_file_prefix> [cache_size] [associativity] [block_size] [num_cores]")
+	fmt.Fprintln(w, "       coherence -config <config_file> [options] [<protocol> <input_file_prefix> ...]")
+	fmt.Fprintln(w, "       coherence <command> [flags]")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "commands, which take named flags instead of the arguments (see coherence <command> -h):")
+	printCommands(w)
+	fmt.Fprintln(w, "")
+
+	fmt.Fprintln(w, "protocol: MSI, MESI, MESIF, MOESI, Dragon, Firefly or DirMESI (directory-based MESI)")
+	fmt.Fprintln(w, "input_file_prefix: Prefix to the benchmark file, "+
+		"e.g. ../benchmarks/blackscholes_four/blackscholes")
+	fmt.Fprintln(w, "cache_size: cache size in bytes. Must be power of 2 and divisible by block_size")
+	fmt.Fprintln(w, "associativity: associativity of the cache. Must be power of 2 and able "+
+		"to divide the number of cache sets")
+	fmt.Fprintln(w, "block_size: block size in bytes. Must be power of 2 and at least the size of a word (4 bytes).")
+	fmt.Fprintln(w, "num_cores: number of cores. Trace files <input_file_prefix>_0.data to "+
+		"<input_file_prefix>_<num_cores - 1>.data must exist. If not provided, one core is used for every trace file found.")
+
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "options:")
+	fmt.Fprintln(w, "-config: JSON file describing the simulated system, see ../configs for examples. The arguments "+
+		"and the options given override the file.")
+	fmt.Fprintln(w, "-num-cores: number of cores, the same as num_cores.")
+	fmt.Fprintln(w, "-report: file to write the statistics to along with the protocol, the trace and the cache "+
+		"configuration, in addition to the standard output and error.")
+	fmt.Fprintln(w, "-report-format: csv (with a header and a row for every core), json or text. Default: csv")
+	fmt.Fprintln(w, "-replacement: replacement policy of the caches. LRU, FIFO, Random, PLRU (tree pseudo-LRU), "+
+		"LFU or SRRIP. Default: LRU")
+	fmt.Fprintln(w, "-replacement-seed: seed of the Random replacement policy. Default: 1")
+	fmt.Fprintln(w, "-bus: atomic or split. A split-transaction bus lets other caches send their requests while "+
+		"memory works on a request. Default: atomic")
+	fmt.Fprintln(w, "-bus-max-outstanding: maximum number of outstanding transactions on the split-transaction "+
+		"bus. Default: 4")
+	fmt.Fprintln(w, "-arbitration: arbitration policy of the bus. FIFO, RoundRobin (by core id), Priority (lowest "+
+		"core id first) or Random. Default: FIFO")
+	fmt.Fprintln(w, "-arbitration-seed: seed of the Random arbitration policy. Default: 1")
+	fmt.Fprintln(w, "-check-coherence: check the coherence invariants after every cycle with bus or network "+
+		"transactions, and stop at the first violation.")
+	fmt.Fprintln(w, "-track-values: give every store a unique value and stop at the first load which does not "+
+		"return the value of the last store to its word (not supported by DirMESI).")
+	fmt.Fprintln(w, "-stall-cycles: stop when no instruction is retired and no transaction is completed for this "+
+		"many cycles, e.g. in a deadlock, and write the state of every component to the dump file. 0 to never "+
+		"stop. Default: 1000000")
+	fmt.Fprintln(w, "-max-cycles: stop after this many cycles the same way, 0 for no limit. Default: 0")
+	fmt.Fprintln(w, "-dump-file: file the state of every component is written to when the simulation is stopped, "+
+		"none if empty. Default: "+defaultDumpFile)
+	fmt.Fprintln(w, "-bus-trace: JSON Lines file every grant, request, reply and release of the bus is written to, "+
+		"with the caches which changed state in response (not supported by DirMESI).")
+	fmt.Fprintln(w, "-bus-trace-addr: comma-separated addresses, only the bus events for their blocks are written. "+
+		"Default: every block")
+	fmt.Fprintln(w, "-bus-trace-from: first cycle whose bus events are written. Default: 0")
+	fmt.Fprintln(w, "-bus-trace-to: last cycle whose bus events are written, 0 for no limit. Default: 0")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "l2 options add a last-level cache shared by the cores between the bus and memory "+
+		"(not supported by DirMESI):")
+	fmt.Fprintln(w, "-l2-size: L2 cache size in bytes. No L2 cache is used if not provided, unless it is in "+
+		"the config file.")
+	fmt.Fprintln(w, "-l2-assoc: associativity of the L2 cache. Default: 8")
+	fmt.Fprintln(w, "-l2-block-size: L2 block size in bytes. Must be at least block_size. Default: block_size")
+	fmt.Fprintln(w, "-l2-latency: cycles needed to access the L2 cache. Default: 10")
+	fmt.Fprintln(w, "-l2-policy: inclusive or non-inclusive. An inclusive L2 cache invalidates the L1 copies "+
+		"of the blocks it evicts. Default: inclusive")
+
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "dram options simulate the timing of the DRAM banks instead of taking 100 cycles for every "+
+		"memory access (not supported by DirMESI):")
+	fmt.Fprintln(w, "-dram-banks: number of DRAM banks. The DRAM model is not used if not provided, unless it is "+
+		"in the config file.")
+	fmt.Fprintln(w, "-dram-row-size: row size of a bank in bytes. Must be a multiple of block_size. Default: 2048")
+	fmt.Fprintln(w, "-dram-page: open or closed. An open page policy leaves a row open after an access so "+
+		"that the next access to the row is a row buffer hit. Default: open")
+	fmt.Fprintln(w, "-dram-interleave: block or row. Whether consecutive blocks or consecutive rows are in "+
+		"different banks. Default: block")
+	fmt.Fprintln(w, "-dram-cas: cycles to access a block of the open row. Default: 40")
+	fmt.Fprintln(w, "-dram-rcd: cycles to open a row. Default: 40")
+	fmt.Fprintln(w, "-dram-precharge: cycles to close a row. Default: 40")
+
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "You can just provide the arguments: protocol and input_file_prefix. In this case, "+
+		"the default cache configuration will be used.")
+	fmt.Fprintln(w, "Default cache configuration => cache_size: 4096B, associativity: 2, block_size: 32B")
+}
@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/stats"
+)
+
+type outputFormat int
+
+const (
+	textFormat outputFormat = iota
+	csvFormat
+	jsonFormat
+)
+
+type outputFlags struct {
+	format     *string
+	path       *string
+	formatName string // Name of the format flag
+}
+
+func newOutputFlags(flags *flag.FlagSet) *outputFlags {
+	return &outputFlags{
+		format:     flags.String("format", "", "text, csv or json. Default: text"),
+		path:       flags.String("output", "", "`file` to write the output to. Default: the standard output"),
+		formatName: "format",
+	}
+}
+
+func (f *outputFlags) getFormat() (outputFormat, error) {
+	switch *f.format {
+	case "", "text":
+		return textFormat, nil
+	case "csv":
+		return csvFormat, nil
+	case "json":
+		return jsonFormat, nil
+	default:
+		return textFormat, fmt.Errorf("%s needs to be text, csv or json", f.formatName)
+	}
+}
+
+// Return the writer of the output, which MUST be closed once written.
+func (f *outputFlags) open() (io.WriteCloser, error) {
+	if *f.path == "" {
+		return nopCloser{os.Stdout}, nil
+	}
+	return os.Create(*f.path)
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+func newReporter(format outputFormat) stats.Reporter {
+	switch format {
+	case csvFormat:
+		return stats.NewCsvReporter()
+	case jsonFormat:
+		return stats.NewJsonReporter()
+	default:
+		return stats.NewTextReporter()
+	}
+}
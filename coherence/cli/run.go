@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"os/signal"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/simulation"
+)
+
+func runRun(args []string) int {
+	flags := newFlagSet("run", "Simulate a system and print its statistics")
+	system := newSystemFlags(flags, true)
+	output := newOutputFlags(flags)
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+	system.recordSetFlags(flags)
+
+	format, err := output.getFormat()
+	if err != nil {
+		return fail("run", err)
+	}
+
+	c, err := system.loadConfig(os.Stderr)
+	if err != nil {
+		return fail("run", err)
+	}
+
+	if err := system.validate(c); err != nil {
+		return fail("run", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	results, err := simulation.RunTraceFiles(ctx, c)
+	if err != nil {
+		return fail("run", err)
+	}
+
+	w, err := output.open()
+	if err != nil {
+		return fail("run", err)
+	}
+	defer w.Close()
+
+	if err := newReporter(format).Report(w, c.GetRunInfo(), results); err != nil {
+		return fail("run", err)
+	}
+	return 0
+}
@@ -0,0 +1,379 @@
+package cli
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/config"
+	"github.com/chriskheng/cs4223-assignment2/coherence/simulation"
+	"github.com/chriskheng/cs4223-assignment2/coherence/stats"
+)
+
+// sweepFlags are the values swept. A parameter which is not given keeps the value of the configuration.
+type sweepFlags struct {
+	protocols       *string
+	tracePrefixes   *string
+	cacheSizes      *string
+	associativities *string
+	blockSizes      *string
+	numJobs         *int
+}
+
+func newSweepFlags(flags *flag.FlagSet) *sweepFlags {
+	return &sweepFlags{
+		protocols: flags.String("protocol", "", "comma-separated `list` of protocols. MSI, MESI, MESIF, MOESI, "+
+			"Dragon, Firefly or DirMESI. Default: MESI"),
+		tracePrefixes: flags.String("trace", "", "comma-separated `list` of prefixes of the trace files, e.g. "+
+			"../benchmarks/blackscholes_four/blackscholes"),
+		cacheSizes: flags.String("cache-size", "", "cache sizes in bytes, as a comma-separated list or a "+
+			"start:end `range` of powers of 2. Default: 4096"),
+		associativities: flags.String("assoc", "", "associativities, as a comma-separated list or a start:end "+
+			"`range` of powers of 2. Default: 2"),
+		blockSizes: flags.String("block-size", "", "block sizes in bytes, as a comma-separated list or a "+
+			"start:end `range` of powers of 2. Default: 32"),
+		numJobs: flags.Int("jobs", runtime.NumCPU(), "number of simulations run at the same time"),
+	}
+}
+
+// The columns of the results table describing the simulated system, before the columns of the summary.
+var sweepColumns = []string{"protocol", "trace", "num_cores", "cache_size", "assoc", "block_size"}
+
+func runSweep(args []string) int {
+	flags := newFlagSet("sweep", "Simulate every combination of the given protocols, traces and cache "+
+		"configurations in parallel, and print a table of their results")
+	system := newSystemFlags(flags, false)
+	sweep := newSweepFlags(flags)
+	output := newOutputFlags(flags)
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+	system.recordSetFlags(flags)
+
+	format, err := output.getFormat()
+	if err != nil {
+		return fail("sweep", err)
+	}
+
+	if *sweep.numJobs < 1 {
+		return fail("sweep", fmt.Errorf("jobs needs to be a positive integer"))
+	}
+
+	base, err := system.loadBaseConfig()
+	if err != nil {
+		return fail("sweep", err)
+	}
+
+	if err := system.apply(&base); err != nil {
+		return fail("sweep", err)
+	}
+
+	configs, err := sweep.getConfigs(base)
+	if err != nil {
+		return fail("sweep", err)
+	}
+
+	if base.BusTrace.File != "" && len(configs) > 1 {
+		return fail("sweep", fmt.Errorf("bus-trace cannot be written by several simulations at once"))
+	}
+
+	// All the configurations are validated first, so that an invalid one does not stop the sweep halfway.
+	for _, c := range configs {
+		if err := system.validate(c); err != nil {
+			return fail("sweep", fmt.Errorf("%s: %s", getSweepLabel(c), err.Error()))
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	results := runConfigs(ctx, configs, *sweep.numJobs, os.Stderr)
+
+	w, err := output.open()
+	if err != nil {
+		return fail("sweep", err)
+	}
+	defer w.Close()
+
+	switch format {
+	case textFormat:
+		printSweepTable(w, configs, results)
+	case csvFormat:
+		printSweepTableCsv(w, configs, results)
+	case jsonFormat:
+		if err := printSweepJson(w, configs, results); err != nil {
+			return fail("sweep", err)
+		}
+	}
+
+	numFailed := 0
+	for _, result := range results {
+		if result.err != nil {
+			numFailed++
+		}
+	}
+	if numFailed > 0 {
+		return fail("sweep", fmt.Errorf("%d of the %d simulations failed, see their status", numFailed, len(results)))
+	}
+	return 0
+}
+
+// Return a configuration for every combination of the values swept, which are otherwise the same as base. The number
+// of cores is discovered for every trace.
+func (f *sweepFlags) getConfigs(base config.Config) ([]config.Config, error) {
+	protocols := []config.Protocol{base.Protocol}
+	if *f.protocols != "" {
+		protocols = nil
+		for _, name := range strings.Split(*f.protocols, ",") {
+			var protocol config.Protocol
+			if err := protocol.UnmarshalText([]byte(strings.TrimSpace(name))); err != nil {
+				return nil, fmt.Errorf("protocol %s is invalid", name)
+			}
+			protocols = append(protocols, protocol)
+		}
+	}
+
+	tracePrefixes := []string{base.TracePrefix}
+	if *f.tracePrefixes != "" {
+		tracePrefixes = strings.Split(*f.tracePrefixes, ",")
+	}
+
+	cacheSizes, err := parseIntValues("cache-size", *f.cacheSizes, base.L1.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	associativities, err := parseIntValues("assoc", *f.associativities, base.L1.Associativity)
+	if err != nil {
+		return nil, err
+	}
+
+	blockSizes, err := parseIntValues("block-size", *f.blockSizes, base.L1.BlockSize)
+	if err != nil {
+		return nil, err
+	}
+
+	configs := []config.Config{}
+	for _, tracePrefix := range tracePrefixes {
+		traceConfig := base
+		traceConfig.TracePrefix = strings.TrimSpace(tracePrefix)
+		if err := discoverNumCores(&traceConfig, os.Stderr); err != nil {
+			return nil, err
+		}
+
+		for _, protocol := range protocols {
+			for _, cacheSize := range cacheSizes {
+				for _, associativity := range associativities {
+					for _, blockSize := range blockSizes {
+						c := traceConfig
+						c.Protocol = protocol
+						c.L1.Size = cacheSize
+						c.L1.Associativity = associativity
+						c.L1.BlockSize = blockSize
+						configs = append(configs, c)
+					}
+				}
+			}
+		}
+	}
+
+	// The simulations run at the same time, so each of them writes its state to its own file.
+	if len(configs) > 1 && base.Watchdog.DumpFile != "" {
+		for i := range configs {
+			configs[i].Watchdog.DumpFile = getRowFileName(base.Watchdog.DumpFile, i+1)
+		}
+	}
+	return configs, nil
+}
+
+// Add the number of the row of a simulation in the results table to the name of a file, before its extension.
+func getRowFileName(path string, row int) string {
+	extension := filepath.Ext(path)
+	return fmt.Sprintf("%s_%d%s", strings.TrimSuffix(path, extension), row, extension)
+}
+
+// Parse a comma-separated list of integers, or a start:end range of the powers of 2 from start to end. Return only
+// defaultValue if values is empty.
+func parseIntValues(name string, values string, defaultValue int) ([]int, error) {
+	if values == "" {
+		return []int{defaultValue}, nil
+	}
+
+	if bounds := strings.Split(values, ":"); len(bounds) == 2 {
+		start, err1 := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		end, err2 := strconv.Atoi(strings.TrimSpace(bounds[1]))
+		if err1 != nil || err2 != nil || start < 1 || start > end {
+			return nil, fmt.Errorf("%s needs to be a range of positive integers from the lowest to the highest", name)
+		}
+		if start&(start-1) != 0 {
+			return nil, fmt.Errorf("%s needs to be a range starting at a power of 2", name)
+		}
+
+		result := []int{}
+		for value := start; value <= end; value *= 2 {
+			result = append(result, value)
+		}
+		return result, nil
+	}
+
+	result := []int{}
+	for _, item := range strings.Split(values, ",") {
+		value, err := strconv.Atoi(strings.TrimSpace(item))
+		if err != nil {
+			return nil, fmt.Errorf("%s needs to be a list of integers or a range", name)
+		}
+		result = append(result, value)
+	}
+	return result, nil
+}
+
+// sweepResult is the outcome of the simulation of a configuration.
+type sweepResult struct {
+	summary stats.Summary
+	err     error // nil if the simulation succeeded, in which case summary is set
+}
+
+// Return ok, or the error which stopped the simulation on a single line.
+func (r sweepResult) getStatus() string {
+	if r.err == nil {
+		return "ok"
+	}
+	return strings.Join(strings.Fields(r.err.Error()), " ")
+}
+
+// Run the simulations on numJobs workers and return their results in the order of the configurations. A line is
+// printed to progress whenever a simulation is done. A simulation which fails does not stop the others, but the ones
+// not started yet when ctx is cancelled fail with its error.
+func runConfigs(ctx context.Context, configs []config.Config, numJobs int, progress io.Writer) []sweepResult {
+	results := make([]sweepResult, len(configs))
+	indices := make(chan int)
+	var mutex sync.Mutex // Guards numDone and progress
+	numDone := 0
+
+	var wg sync.WaitGroup
+	for i := 0; i < numJobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indices {
+				simulationResults, err := simulation.RunTraceFiles(ctx, configs[index])
+				if err != nil {
+					results[index].err = err
+				} else {
+					results[index].summary = stats.Summarize(simulationResults)
+				}
+
+				mutex.Lock()
+				numDone++
+				fmt.Fprintf(progress, "[%d/%d] %s", numDone, len(configs), getSweepLabel(configs[index]))
+				if err != nil {
+					fmt.Fprintf(progress, ": %s", results[index].getStatus())
+				}
+				fmt.Fprintln(progress)
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	for i := range configs {
+		select {
+		case indices <- i:
+		case <-ctx.Done():
+			results[i].err = ctx.Err()
+		}
+	}
+	close(indices)
+	wg.Wait()
+	return results
+}
+
+func getSweepLabel(c config.Config) string {
+	return fmt.Sprintf("protocol=%s trace=%s cache-size=%d assoc=%d block-size=%d", c.Protocol, c.TracePrefix,
+		c.L1.Size, c.L1.Associativity, c.L1.BlockSize)
+}
+
+// The summary of a failed simulation is left empty, or is filled with missingValue.
+func getSweepRow(c config.Config, result sweepResult, missingValue string) []string {
+	row := []string{
+		c.Protocol.String(),
+		c.TracePrefix,
+		strconv.Itoa(c.NumCores),
+		strconv.Itoa(c.L1.Size),
+		strconv.Itoa(c.L1.Associativity),
+		strconv.Itoa(c.L1.BlockSize),
+	}
+	if result.err == nil {
+		row = append(row, result.summary.Values()...)
+	} else {
+		for range stats.SummaryColumns {
+			row = append(row, missingValue)
+		}
+	}
+	return append(row, result.getStatus())
+}
+
+func getSweepHeader() []string {
+	header := append([]string{}, sweepColumns...)
+	header = append(header, stats.SummaryColumns...)
+	return append(header, "status")
+}
+
+func printSweepTable(w io.Writer, configs []config.Config, results []sweepResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, strings.Join(getSweepHeader(), "\t")+"\t")
+	for i := range configs {
+		fmt.Fprintln(tw, strings.Join(getSweepRow(configs[i], results[i], "-"), "\t")+"\t")
+	}
+	tw.Flush()
+}
+
+func printSweepTableCsv(w io.Writer, configs []config.Config, results []sweepResult) {
+	cw := csv.NewWriter(w)
+	cw.Write(getSweepHeader())
+	for i := range configs {
+		cw.Write(getSweepRow(configs[i], results[i], ""))
+	}
+	cw.Flush()
+}
+
+// The statistics are left out of the rows of the failed simulations.
+type sweepJsonRow struct {
+	Run    stats.RunInfo `json:"run"`
+	Status string        `json:"status"`
+	*sweepJsonStats
+}
+
+type sweepJsonStats struct {
+	TimeMs        int64   `json:"time_ms"`
+	CacheMissRate float64 `json:"cache_miss_rate"`
+	stats.Summary
+}
+
+func printSweepJson(w io.Writer, configs []config.Config, results []sweepResult) error {
+	rows := []sweepJsonRow{}
+	for i := range configs {
+		row := sweepJsonRow{Run: configs[i].GetRunInfo(), Status: results[i].getStatus()}
+		if results[i].err == nil {
+			row.sweepJsonStats = &sweepJsonStats{
+				TimeMs:        results[i].summary.Duration.Milliseconds(),
+				CacheMissRate: results[i].summary.GetCacheMissRate(),
+				Summary:       results[i].summary,
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(rows)
+}
@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/testutils"
+)
+
+type parseIntValuesTest struct {
+	values string
+	result []int // nil if the values are invalid
+}
+
+var parseIntValuesTests = []parseIntValuesTest{
+	{values: "", result: []int{4096}},
+	{values: "1024", result: []int{1024}},
+	{values: "1024, 2048,8192", result: []int{1024, 2048, 8192}},
+	{values: "1024:8192", result: []int{1024, 2048, 4096, 8192}},
+	{values: " 16 : 16 ", result: []int{16}},
+	{values: "16:100", result: []int{16, 32, 64}},
+	{values: "3:10"},
+	{values: "0:16"},
+	{values: "32:16"},
+	{values: "16:x"},
+	{values: "16:32:64"},
+	{values: "16,x"},
+}
+
+func TestParseIntValues(t *testing.T) {
+	for _, test := range parseIntValuesTests {
+		result, err := parseIntValues("cache-size", test.values, 4096)
+		if test.result == nil {
+			if err == nil {
+				t.Errorf(testutils.GetErrorString(test.values, "an error", fmt.Sprint(result)))
+			} else if !strings.HasPrefix(err.Error(), "cache-size needs") {
+				t.Errorf(testutils.GetErrorString(test.values, "an error naming cache-size", err.Error()))
+			}
+		} else if err != nil {
+			t.Errorf(testutils.GetErrorString(test.values, fmt.Sprint(test.result), err.Error()))
+		} else if fmt.Sprint(result) != fmt.Sprint(test.result) {
+			t.Errorf(testutils.GetErrorString(test.values, fmt.Sprint(test.result), fmt.Sprint(result)))
+		}
+	}
+}
+
+func TestGetRowFileName(t *testing.T) {
+	tests := map[string]string{
+		"state_dump.txt":       "state_dump_3.txt",
+		"dumps/state.dump.txt": "dumps/state.dump_3.txt",
+		"state_dump":           "state_dump_3",
+		"../dumps/state":       "../dumps/state_3",
+	}
+	for path, expected := range tests {
+		if got := getRowFileName(path, 3); got != expected {
+			t.Errorf(testutils.GetErrorString(path, expected, got))
+		}
+	}
+}
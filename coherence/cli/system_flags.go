@@ -0,0 +1,508 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/config"
+)
+
+const defaultDumpFile = "state_dump.txt"
+
+// systemFlags are the flags describing the simulated system. They are only applied when they are given, so that they
+// override the configuration file.
+type systemFlags struct {
+	configPath *string
+	// The flags describing the protocol, the trace and the L1 caches are nil if they are not registered.
+	protocol          *string
+	tracePrefix       *string
+	cacheSize         *int
+	associativity     *int
+	blockSize         *int
+	numCores          *int
+	replacementPolicy *string
+	replacementSeed   *int64
+	busType           *string
+	busMaxOutstanding *int
+	arbitrationPolicy *string
+	arbitrationSeed   *int64
+	l2Size            *int
+	l2Associativity   *int
+	l2BlockSize       *int
+	l2Latency         *int
+	l2Policy          *string
+	l2Replacement     *string
+	dramBanks         *int
+	dramRowSize       *int
+	dramPagePolicy    *string
+	dramInterleaving  *string
+	dramCasLatency    *int
+	dramRcdLatency    *int
+	dramPrecharge     *int
+	checkCoherence    *bool
+	trackValues       *bool
+	stallCycles       *int
+	maxCycles         *int
+	dumpFile          *string
+	busTraceFile      *string
+	busTraceAddresses *string
+	busTraceFrom      *int
+	busTraceTo        *int
+	isSet             map[string]bool
+	fieldNames        map[string]string // Name of the flag or argument which sets a field of the configuration
+}
+
+// The names of the flags setting the fields of the configuration, used to name them in the validation errors. The
+// name is empty for the fields which only the configuration file sets.
+var fieldFlagNames = map[string]string{
+	"protocol":               "protocol",
+	"trace_prefix":           "trace",
+	"num_cores":              "num-cores",
+	"l1.size":                "cache-size",
+	"l1.associativity":       "assoc",
+	"l1.block_size":          "block-size",
+	"l1.replacement.policy":  "replacement",
+	"bus.split_transaction":  "bus",
+	"bus.max_outstanding":    "bus-max-outstanding",
+	"bus.arbitration.policy": "arbitration",
+	"l2":                     "l2-size",
+	"l2.size":                "l2-size",
+	"l2.associativity":       "l2-assoc",
+	"l2.block_size":          "l2-block-size",
+	"l2.latency":             "l2-latency",
+	"l2.replacement.policy":  "l2-replacement",
+	"memory.dram":            "dram-banks",
+	"memory.dram.banks":      "dram-banks",
+	"memory.dram.row_size":   "dram-row-size",
+	"memory.dram.cas":        "dram-cas",
+	"memory.dram.rcd":        "dram-rcd",
+	"memory.dram.precharge":  "dram-precharge",
+	"track_values":           "track-values",
+	"watchdog.stall_cycles":  "stall-cycles",
+	"watchdog.max_cycles":    "max-cycles",
+	"bus_trace.file":         "bus-trace",
+	"bus_trace.from_cycle":   "bus-trace-from",
+	"bus_trace.to_cycle":     "bus-trace-to",
+
+	"bus.transfer_cycles":     "",
+	"bus.width":               "",
+	"network.transfer_cycles": "",
+	"memory.latency":          "",
+}
+
+// Register the flags on the given flag set. The flags describing the protocol, the trace and the L1 caches are only
+// registered if withSystemShape is true, since the sweep takes lists of values for them instead.
+func newSystemFlags(flags *flag.FlagSet, withSystemShape bool) *systemFlags {
+	f := &systemFlags{isSet: map[string]bool{}, fieldNames: map[string]string{}}
+	for field, name := range fieldFlagNames {
+		f.fieldNames[field] = name
+	}
+
+	f.configPath = flags.String("config", "", "JSON `file` describing the simulated system. The flags given override it")
+	if withSystemShape {
+		f.protocol = flags.String("protocol", "", "MSI, MESI, MESIF, MOESI, Dragon, Firefly or DirMESI. Default: MESI")
+		f.tracePrefix = flags.String("trace", "", "`prefix` of the trace files, e.g. "+
+			"../benchmarks/blackscholes_four/blackscholes")
+		f.cacheSize = flags.Int("cache-size", 0, "cache size in bytes. Default: 4096")
+		f.associativity = flags.Int("assoc", 0, "associativity of the cache. Default: 2")
+		f.blockSize = flags.Int("block-size", 0, "block size in bytes. Default: 32")
+	}
+	f.numCores = flags.Int("num-cores", 0, "number of cores. Default: one core for every trace file found")
+	f.replacementPolicy = flags.String("replacement", "", "replacement policy of the caches. LRU, FIFO, Random, "+
+		"PLRU, LFU or SRRIP. Default: LRU")
+	f.replacementSeed = flags.Int64("replacement-seed", 0, "seed of the Random replacement policy. Default: 1")
+	f.busType = flags.String("bus", "", "atomic or split. Default: atomic")
+	f.busMaxOutstanding = flags.Int("bus-max-outstanding", 0, "maximum number of outstanding transactions on the "+
+		"split-transaction bus. Default: 4")
+	f.arbitrationPolicy = flags.String("arbitration", "", "arbitration policy of the bus. FIFO, RoundRobin, Priority "+
+		"or Random. Default: FIFO")
+	f.arbitrationSeed = flags.Int64("arbitration-seed", 0, "seed of the Random arbitration policy. Default: 1")
+	f.l2Size = flags.Int("l2-size", 0, "L2 cache size in bytes. No L2 cache is used if not provided")
+	f.l2Associativity = flags.Int("l2-assoc", 0, "associativity of the L2 cache. Default: 8")
+	f.l2BlockSize = flags.Int("l2-block-size", 0, "L2 block size in bytes. Default: the L1 block size")
+	f.l2Latency = flags.Int("l2-latency", 0, "cycles needed to access the L2 cache. Default: 10")
+	f.l2Policy = flags.String("l2-policy", "", "inclusive or non-inclusive. Default: inclusive")
+	f.l2Replacement = flags.String("l2-replacement", "", "replacement policy of the L2 cache. LRU, FIFO, Random, "+
+		"PLRU, LFU or SRRIP. Default: LRU")
+	f.dramBanks = flags.Int("dram-banks", 0, "number of DRAM banks. The DRAM model is not used if not provided")
+	f.dramRowSize = flags.Int("dram-row-size", 0, "row size of a DRAM bank in bytes. Default: 2048")
+	f.dramPagePolicy = flags.String("dram-page", "", "open or closed. Default: open")
+	f.dramInterleaving = flags.String("dram-interleave", "", "block or row. Default: block")
+	f.dramCasLatency = flags.Int("dram-cas", 0, "cycles to access a block of the open row. Default: 40")
+	f.dramRcdLatency = flags.Int("dram-rcd", 0, "cycles to open a row. Default: 40")
+	f.dramPrecharge = flags.Int("dram-precharge", 0, "cycles to close a row. Default: 40")
+	f.checkCoherence = flags.Bool("check-coherence", false, "check the coherence invariants after every cycle with "+
+		"bus or network transactions, and stop at the first violation")
+	f.trackValues = flags.Bool("track-values", false, "give every store a unique value and stop at the first load "+
+		"which does not return the value of the last store to its word (not supported by DirMESI)")
+	f.stallCycles = flags.Int("stall-cycles", 0, "stop when no instruction is retired and no transaction is "+
+		"completed for this many cycles, 0 to never stop. Default: 1000000")
+	f.maxCycles = flags.Int("max-cycles", 0, "stop after this many cycles, 0 for no limit. Default: 0")
+	f.dumpFile = flags.String("dump-file", "", "`file` the state of every component is written to when the "+
+		"simulation is stopped, none if empty. In a sweep, the row of the simulation is added to the name, e.g. "+
+		"state_dump_3.txt. Default: "+defaultDumpFile)
+	f.busTraceFile = flags.String("bus-trace", "", "JSON Lines `file` every grant, request, reply and release of "+
+		"the bus is written to (not supported by DirMESI)")
+	f.busTraceAddresses = flags.String("bus-trace-addr", "", "comma-separated `addresses`, only the bus events for "+
+		"their blocks are written. Default: every block")
+	f.busTraceFrom = flags.Int("bus-trace-from", 0, "first cycle whose bus events are written. Default: 0")
+	f.busTraceTo = flags.Int("bus-trace-to", 0, "last cycle whose bus events are written, 0 for no limit. Default: 0")
+	return f
+}
+
+// MUST call after the flags are parsed.
+func (f *systemFlags) recordSetFlags(flags *flag.FlagSet) {
+	flags.Visit(func(fl *flag.Flag) { f.isSet[fl.Name] = true })
+}
+
+// Return the default configuration, or the one of the configuration file if it is given. Unlike the simulation
+// package, the command line writes the state of a stopped simulation to defaultDumpFile by default.
+func (f *systemFlags) loadBaseConfig() (config.Config, error) {
+	if *f.configPath == "" {
+		c := config.Default()
+		c.Watchdog.DumpFile = defaultDumpFile
+		return c, nil
+	}
+	return config.Load(*f.configPath)
+}
+
+// Load the configuration and apply the flags given. The number of cores is discovered if it is not given, in which
+// case a message is printed to info. The configuration is not validated.
+func (f *systemFlags) loadConfig(info io.Writer) (config.Config, error) {
+	c, err := f.loadBaseConfig()
+	if err != nil {
+		return config.Config{}, err
+	}
+
+	if err := f.apply(&c); err != nil {
+		return config.Config{}, err
+	}
+
+	if err := discoverNumCores(&c, info); err != nil {
+		return config.Config{}, err
+	}
+	return c, nil
+}
+
+func discoverNumCores(c *config.Config, info io.Writer) error {
+	if c.TracePrefix == "" {
+		return nil
+	}
+
+	isDiscovered, err := c.DiscoverNumCores()
+	if err != nil {
+		return err
+	}
+	if isDiscovered {
+		fmt.Fprintf(info, "Found %d trace files => number of cores: %d\n", c.NumCores, c.NumCores)
+	}
+	return nil
+}
+
+func (f *systemFlags) apply(c *config.Config) error {
+	appliers := []func(c *config.Config) error{
+		f.applyShapeFlags, f.applyCacheFlags, f.applyBusFlags, f.applyL2Flags, f.applyDramFlags, f.applyWatchdogFlags,
+		f.applyBusTraceFlags,
+	}
+	for _, applyFlags := range appliers {
+		if err := applyFlags(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *systemFlags) applyShapeFlags(c *config.Config) error {
+	if f.isSet["num-cores"] {
+		if *f.numCores < 1 {
+			return errors.New("num-cores needs to be a positive integer")
+		}
+		c.NumCores = *f.numCores
+	}
+
+	if f.isSet["check-coherence"] {
+		c.CheckCoherence = *f.checkCoherence
+	}
+
+	if f.isSet["track-values"] {
+		c.TrackValues = *f.trackValues
+	}
+
+	if f.protocol == nil {
+		return nil
+	}
+
+	if f.isSet["protocol"] {
+		if err := c.Protocol.UnmarshalText([]byte(*f.protocol)); err != nil {
+			return errors.New("protocol is invalid")
+		}
+	}
+
+	if f.isSet["trace"] {
+		c.TracePrefix = *f.tracePrefix
+	}
+
+	if f.isSet["cache-size"] {
+		c.L1.Size = *f.cacheSize
+	}
+
+	if f.isSet["assoc"] {
+		c.L1.Associativity = *f.associativity
+	}
+
+	if f.isSet["block-size"] {
+		c.L1.BlockSize = *f.blockSize
+	}
+
+	return nil
+}
+
+func (f *systemFlags) applyCacheFlags(c *config.Config) error {
+	replacement := &c.L1.Replacement
+	if f.isSet["replacement"] {
+		if err := replacement.Policy.UnmarshalText([]byte(*f.replacementPolicy)); err != nil {
+			return errors.New("invalid replacement policy")
+		}
+	}
+
+	if f.isSet["replacement-seed"] {
+		replacement.Seed = *f.replacementSeed
+	}
+
+	return nil
+}
+
+func (f *systemFlags) applyBusFlags(c *config.Config) error {
+	bus := &c.Bus
+	if f.isSet["bus"] {
+		switch *f.busType {
+		case "atomic":
+			bus.IsSplitTransaction = false
+		case "split":
+			bus.IsSplitTransaction = true
+		default:
+			return errors.New("bus needs to be atomic or split")
+		}
+	}
+
+	if f.isSet["bus-max-outstanding"] {
+		bus.MaxOutstanding = *f.busMaxOutstanding
+	}
+
+	if f.isSet["arbitration"] {
+		if err := bus.Arbitration.Policy.UnmarshalText([]byte(*f.arbitrationPolicy)); err != nil {
+			return errors.New("invalid arbitration policy")
+		}
+	}
+
+	if f.isSet["arbitration-seed"] {
+		bus.Arbitration.Seed = *f.arbitrationSeed
+	}
+
+	return nil
+}
+
+// The block size of the L2 cache defaults to the block size of the L1 caches.
+func (f *systemFlags) applyL2Flags(c *config.Config) error {
+	if f.isSet["l2-size"] && c.L2 == nil {
+		l2 := config.DefaultL2()
+		c.L2 = &l2
+	}
+
+	l2 := c.L2
+	if l2 == nil {
+		for _, name := range []string{"l2-assoc", "l2-block-size", "l2-latency", "l2-policy", "l2-replacement"} {
+			if f.isSet[name] {
+				return fmt.Errorf("%s needs l2-size to be provided", name)
+			}
+		}
+		return nil
+	}
+
+	if f.isSet["l2-size"] {
+		l2.CacheSize = *f.l2Size
+	}
+
+	if f.isSet["l2-assoc"] {
+		l2.Associativity = *f.l2Associativity
+	}
+
+	if f.isSet["l2-block-size"] {
+		l2.BlockSize = *f.l2BlockSize
+	}
+	if l2.BlockSize == 0 {
+		l2.BlockSize = c.L1.BlockSize
+	}
+
+	if f.isSet["l2-latency"] {
+		l2.Latency = *f.l2Latency
+	}
+
+	if f.isSet["l2-policy"] {
+		switch *f.l2Policy {
+		case "inclusive":
+			l2.IsInclusive = true
+		case "non-inclusive":
+			l2.IsInclusive = false
+		default:
+			return errors.New("l2-policy needs to be inclusive or non-inclusive")
+		}
+	}
+
+	if f.isSet["l2-replacement"] {
+		if err := l2.Replacement.Policy.UnmarshalText([]byte(*f.l2Replacement)); err != nil {
+			return errors.New("invalid L2 replacement policy")
+		}
+	}
+
+	return nil
+}
+
+func (f *systemFlags) applyDramFlags(c *config.Config) error {
+	if f.isSet["dram-banks"] && c.Memory.Dram == nil {
+		dram := config.DefaultDram()
+		c.Memory.Dram = &dram
+	}
+
+	dram := c.Memory.Dram
+	if dram == nil {
+		names := []string{"dram-row-size", "dram-page", "dram-interleave", "dram-cas", "dram-rcd", "dram-precharge"}
+		for _, name := range names {
+			if f.isSet[name] {
+				return fmt.Errorf("%s needs dram-banks to be provided", name)
+			}
+		}
+		return nil
+	}
+
+	if f.isSet["dram-banks"] {
+		dram.NumBanks = *f.dramBanks
+	}
+
+	if f.isSet["dram-row-size"] {
+		dram.RowSize = *f.dramRowSize
+	}
+
+	if f.isSet["dram-page"] {
+		switch *f.dramPagePolicy {
+		case "open":
+			dram.IsOpenPage = true
+		case "closed":
+			dram.IsOpenPage = false
+		default:
+			return errors.New("dram-page needs to be open or closed")
+		}
+	}
+
+	if f.isSet["dram-interleave"] {
+		switch *f.dramInterleaving {
+		case "block":
+			dram.IsRowInterleaved = false
+		case "row":
+			dram.IsRowInterleaved = true
+		default:
+			return errors.New("dram-interleave needs to be block or row")
+		}
+	}
+
+	if f.isSet["dram-cas"] {
+		dram.CasLatency = *f.dramCasLatency
+	}
+
+	if f.isSet["dram-rcd"] {
+		dram.RcdLatency = *f.dramRcdLatency
+	}
+
+	if f.isSet["dram-precharge"] {
+		dram.PrechargeLatency = *f.dramPrecharge
+	}
+
+	return nil
+}
+
+func (f *systemFlags) applyWatchdogFlags(c *config.Config) error {
+	if f.isSet["stall-cycles"] {
+		c.Watchdog.StallCycles = *f.stallCycles
+	}
+
+	if f.isSet["max-cycles"] {
+		c.Watchdog.MaxCycles = *f.maxCycles
+	}
+
+	if f.isSet["dump-file"] {
+		c.Watchdog.DumpFile = *f.dumpFile
+	}
+
+	return nil
+}
+
+func (f *systemFlags) applyBusTraceFlags(c *config.Config) error {
+	busTrace := &c.BusTrace
+	if f.isSet["bus-trace"] {
+		busTrace.File = *f.busTraceFile
+	}
+
+	if busTrace.File == "" {
+		for _, name := range []string{"bus-trace-addr", "bus-trace-from", "bus-trace-to"} {
+			if f.isSet[name] {
+				return fmt.Errorf("%s needs bus-trace to be provided", name)
+			}
+		}
+		return nil
+	}
+
+	if f.isSet["bus-trace-addr"] {
+		busTrace.Addresses = nil
+		for _, s := range strings.Split(*f.busTraceAddresses, ",") {
+			address, err := strconv.ParseUint(strings.TrimSpace(s), 0, 32)
+			if err != nil {
+				return fmt.Errorf("bus-trace-addr has an invalid address %s", s)
+			}
+			busTrace.Addresses = append(busTrace.Addresses, uint32(address))
+		}
+	}
+
+	if f.isSet["bus-trace-from"] {
+		busTrace.FromCycle = *f.busTraceFrom
+	}
+
+	if f.isSet["bus-trace-to"] {
+		busTrace.ToCycle = *f.busTraceTo
+	}
+
+	return nil
+}
+
+// Validate the configuration. The invalid field is named after the flag or argument setting it, unless its value
+// comes from the configuration file.
+func (f *systemFlags) validate(c config.Config) error {
+	if c.TracePrefix == "" {
+		return errors.New(f.getName("trace_prefix") + " needs to be provided")
+	}
+
+	err := c.Validate()
+	var validationErr *config.ValidationError
+	if !errors.As(err, &validationErr) {
+		return err
+	}
+	return errors.New(f.getName(validationErr.Field) + " " + fieldPattern.ReplaceAllStringFunc(validationErr.Reason,
+		f.getName))
+}
+
+var fieldPattern = regexp.MustCompile(`\b(l1|l2|bus|bus_trace|memory)\.[a-z_.]+`)
+
+func (f *systemFlags) getName(field string) string {
+	name := f.fieldNames[field]
+	if name != "" && (f.isSet[name] || *f.configPath == "") {
+		return name
+	}
+	if *f.configPath == "" {
+		return field
+	}
+	return fmt.Sprintf("%s (in %s)", field, *f.configPath)
+}
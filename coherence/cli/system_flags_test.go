@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/testutils"
+)
+
+type validateTest struct {
+	name       string
+	configFile string // JSON of the configuration file, none if empty
+	args       []string
+	err        string // Empty if the configuration is valid. CONFIG stands for the path of the configuration file
+}
+
+var validateTests = []validateTest{
+	{name: "valid flags", args: []string{"-trace", "x", "-cache-size", "64"}},
+	{name: "valid configuration file", configFile: `{"trace_prefix": "x", "l1": {"size": 64}}`},
+	{name: "missing trace", err: "trace needs to be provided"},
+	{
+		name:       "missing trace in the configuration file",
+		configFile: `{"l1": {"size": 64}}`,
+		err:        "trace_prefix (in CONFIG) needs to be provided",
+	},
+	{name: "invalid flag", args: []string{"-trace", "x", "-cache-size", "100"}, err: "cache-size needs to be power of 2"},
+	{
+		name:       "invalid field of the configuration file",
+		configFile: `{"trace_prefix": "x", "l1": {"size": 100}}`,
+		err:        "l1.size (in CONFIG) needs to be power of 2",
+	},
+	{
+		name:       "field set only by the configuration file",
+		configFile: `{"trace_prefix": "x", "bus": {"width": 0}}`,
+		err:        "bus.width (in CONFIG) needs to be a positive integer",
+	},
+	{
+		name: "field of a flag in the reason",
+		args: []string{"-trace", "x", "-cache-size", "32", "-block-size", "64"},
+		err:  "cache-size needs to be divisible by block-size",
+	},
+	{
+		name:       "invalid flag overriding the configuration file",
+		configFile: `{"trace_prefix": "x", "l1": {"size": 4096, "block_size": 64}}`,
+		args:       []string{"-cache-size", "32"},
+		err:        "cache-size needs to be divisible by l1.block_size (in CONFIG)",
+	},
+	{
+		name:       "flag making the configuration file invalid",
+		configFile: `{"trace_prefix": "x", "l1": {"size": 32}}`,
+		args:       []string{"-block-size", "64"},
+		err:        "l1.size (in CONFIG) needs to be divisible by block-size",
+	},
+	{
+		name: "row of the DRAM smaller than a block of the L2 cache",
+		args: []string{"-trace", "x", "-l2-size", "4096", "-l2-block-size", "64", "-dram-banks", "2", "-dram-row-size",
+			"32"},
+		err: "dram-row-size needs to be a multiple of l2-block-size",
+	},
+	{
+		name: "flags of the bus trace in the reason",
+		args: []string{"-trace", "x", "-bus-trace", "trace.jsonl", "-bus-trace-from", "5", "-bus-trace-to", "2"},
+		err:  "bus-trace-to needs to be at least bus-trace-from",
+	},
+}
+
+func TestValidate(t *testing.T) {
+	for _, test := range validateTests {
+		args := test.args
+		configPath := filepath.Join(t.TempDir(), "config.json")
+		if test.configFile != "" {
+			if err := os.WriteFile(configPath, []byte(test.configFile), 0644); err != nil {
+				t.Fatal(err)
+			}
+			args = append([]string{"-config", configPath}, args...)
+		}
+
+		flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+		system := newSystemFlags(flags, true)
+		if err := flags.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		system.recordSetFlags(flags)
+		c, err := system.loadBaseConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := system.apply(&c); err != nil {
+			t.Fatal(err)
+		}
+		c.NumCores = 2 // As discovered from the trace files
+
+		got := ""
+		if err := system.validate(c); err != nil {
+			got = err.Error()
+		}
+		if expected := strings.ReplaceAll(test.err, "CONFIG", configPath); got != expected {
+			t.Errorf(testutils.GetErrorString(test.name, expected, got))
+		}
+	}
+}
+
+// Every field the validation of the configuration can report needs to be named after its flag, or be known to be set
+// only by the configuration file.
+func TestFieldFlagNames(t *testing.T) {
+	source, err := os.ReadFile(filepath.Join("..", "config", "validate.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields := regexp.MustCompile(`newValidationError\("([a-z0-9_.]+)"`).FindAllStringSubmatch(string(source), -1)
+	if len(fields) == 0 {
+		t.Fatal("no validation error found in config/validate.go")
+	}
+	for _, match := range fields {
+		if _, ok := fieldFlagNames[match[1]]; !ok {
+			t.Errorf("%s has no entry in fieldFlagNames", match[1])
+		}
+	}
+}
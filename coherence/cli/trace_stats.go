@@ -0,0 +1,145 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/core"
+)
+
+func runTraceStats(args []string) int {
+	flags := newFlagSet("trace-stats", "Print the statistics of the trace of every core, independently of the "+
+		"simulated system. The blocks are as large as the block size")
+	system := newSystemFlags(flags, true)
+	output := newOutputFlags(flags)
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+	system.recordSetFlags(flags)
+
+	format, err := output.getFormat()
+	if err != nil {
+		return fail("trace-stats", err)
+	}
+
+	c, err := system.loadConfig(os.Stderr)
+	if err != nil {
+		return fail("trace-stats", err)
+	}
+
+	if err := system.validate(c); err != nil {
+		return fail("trace-stats", err)
+	}
+
+	traceStats := []core.TraceStats{}
+	for i := 0; i < c.NumCores; i++ {
+		stats, err := readTraceStats(core.GetTraceFileName(c.TracePrefix, i), c.L1.BlockSize)
+		if err != nil {
+			return fail("trace-stats", err)
+		}
+		traceStats = append(traceStats, stats)
+	}
+
+	w, err := output.open()
+	if err != nil {
+		return fail("trace-stats", err)
+	}
+	defer w.Close()
+
+	switch format {
+	case textFormat:
+		printTraceStats(w, traceStats)
+	case csvFormat:
+		printTraceStatsCsv(w, traceStats)
+	case jsonFormat:
+		if err := printTraceStatsJson(w, traceStats); err != nil {
+			return fail("trace-stats", err)
+		}
+	}
+	return 0
+}
+
+func readTraceStats(path string, blockSize int) (core.TraceStats, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return core.TraceStats{}, err
+	}
+	defer file.Close()
+
+	stats, err := core.ReadTraceStats(file, blockSize)
+	if err != nil {
+		return core.TraceStats{}, fmt.Errorf("%s: %s", path, err.Error())
+	}
+	return stats, nil
+}
+
+func printTraceStats(w io.Writer, traceStats []core.TraceStats) {
+	for i, stats := range traceStats {
+		if i > 0 {
+			fmt.Fprintf(w, "======================================================\n")
+		}
+		fmt.Fprintf(w, "Core %d:\n", i)
+		fmt.Fprintf(w, "Num loads: %d\n", stats.NumLoads)
+		fmt.Fprintf(w, "Num stores: %d\n", stats.NumStores)
+		fmt.Fprintf(w, "Num other instructions: %d\n", stats.NumOthers)
+		fmt.Fprintf(w, "Compute cycles: %d\n", stats.NumComputeCycles)
+		fmt.Fprintf(w, "Num blocks accessed: %d\n", len(stats.BlocksAccessed))
+		fmt.Fprintf(w, "Num blocks written: %d\n", len(stats.BlocksWritten))
+		fmt.Fprintf(w, "Num shared blocks: %d\n", countSharedBlocks(traceStats, i))
+	}
+}
+
+func printTraceStatsCsv(w io.Writer, traceStats []core.TraceStats) {
+	fmt.Fprintf(w, "core,loads,stores,others,compute_cycles,blocks_accessed,blocks_written,shared_blocks\n")
+	for i, stats := range traceStats {
+		fmt.Fprintf(w, "%d,%d,%d,%d,%d,%d,%d,%d\n", i, stats.NumLoads, stats.NumStores, stats.NumOthers,
+			stats.NumComputeCycles, len(stats.BlocksAccessed), len(stats.BlocksWritten), countSharedBlocks(traceStats, i))
+	}
+}
+
+type traceStatsJson struct {
+	Core              int `json:"core"`
+	NumLoads          int `json:"loads"`
+	NumStores         int `json:"stores"`
+	NumOthers         int `json:"others"`
+	NumComputeCycles  int `json:"compute_cycles"`
+	NumBlocksAccessed int `json:"blocks_accessed"`
+	NumBlocksWritten  int `json:"blocks_written"`
+	NumSharedBlocks   int `json:"shared_blocks"`
+}
+
+func printTraceStatsJson(w io.Writer, traceStats []core.TraceStats) error {
+	rows := []traceStatsJson{}
+	for i, stats := range traceStats {
+		rows = append(rows, traceStatsJson{
+			Core:              i,
+			NumLoads:          stats.NumLoads,
+			NumStores:         stats.NumStores,
+			NumOthers:         stats.NumOthers,
+			NumComputeCycles:  stats.NumComputeCycles,
+			NumBlocksAccessed: len(stats.BlocksAccessed),
+			NumBlocksWritten:  len(stats.BlocksWritten),
+			NumSharedBlocks:   countSharedBlocks(traceStats, i),
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(rows)
+}
+
+// Return the number of blocks accessed by the given core which are also accessed by another core.
+func countSharedBlocks(traceStats []core.TraceStats, coreId int) int {
+	numShared := 0
+	for block := range traceStats[coreId].BlocksAccessed {
+		for i, stats := range traceStats {
+			if i != coreId && stats.BlocksAccessed[block] {
+				numShared++
+				break
+			}
+		}
+	}
+	return numShared
+}
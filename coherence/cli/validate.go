@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"encoding/json"
+	"os"
+)
+
+func runValidate(args []string) int {
+	flags := newFlagSet("validate", "Check the configuration of a system and print it as JSON")
+	system := newSystemFlags(flags, true)
+	path := flags.String("output", "", "`file` to write the configuration to. Default: the standard output")
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+	system.recordSetFlags(flags)
+
+	c, err := system.loadConfig(os.Stderr)
+	if err != nil {
+		return fail("validate", err)
+	}
+
+	if err := system.validate(c); err != nil {
+		return fail("validate", err)
+	}
+
+	output := outputFlags{path: path}
+	w, err := output.open()
+	if err != nil {
+		return fail("validate", err)
+	}
+	defer w.Close()
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(c); err != nil {
+		return fail("validate", err)
+	}
+	return 0
+}
@@ -0,0 +1,114 @@
+package bus
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// ArbitrationPolicy chooses which of the caches waiting for the bus is granted it next.
+type ArbitrationPolicy interface {
+	// Return the index of the requester to be granted the bus. requesterIds are the ids of the waiting caches in the
+	// order of their requests, and there is at least one.
+	GetNext(requesterIds []int) int
+}
+
+type ArbitrationPolicyType int
+
+const (
+	Fifo ArbitrationPolicyType = iota
+	RoundRobin
+	FixedPriority
+	Random
+)
+
+var arbitrationPolicyNames = [...]string{"FIFO", "RoundRobin", "Priority", "Random"}
+
+func (p ArbitrationPolicyType) String() string {
+	return arbitrationPolicyNames[p]
+}
+
+func (p ArbitrationPolicyType) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *ArbitrationPolicyType) UnmarshalText(text []byte) error {
+	for i, name := range arbitrationPolicyNames {
+		if name == string(text) {
+			*p = ArbitrationPolicyType(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid arbitration policy %s", text)
+}
+
+type ArbitrationConfig struct {
+	Policy ArbitrationPolicyType `json:"policy"`
+	Seed   int64                 `json:"seed"` // Only used by the random policy
+}
+
+func newArbitrationPolicy(config ArbitrationConfig) ArbitrationPolicy {
+	switch config.Policy {
+	case Fifo:
+		return &fifoArbitration{}
+	case RoundRobin:
+		return &roundRobinArbitration{lastGrantedId: -1}
+	case FixedPriority:
+		return &fixedPriorityArbitration{}
+	case Random:
+		return &randomArbitration{rng: rand.New(rand.NewSource(config.Seed))}
+	default:
+		panic(fmt.Sprintf("unknown arbitration policy %d", config.Policy))
+	}
+}
+
+// Grant the bus in the order of the requests.
+type fifoArbitration struct{}
+
+func (p *fifoArbitration) GetNext(requesterIds []int) int {
+	return 0
+}
+
+// Grant the bus to the cache with the next id after the one granted last, wrapping around to the lowest id.
+type roundRobinArbitration struct {
+	lastGrantedId int
+}
+
+func (p *roundRobinArbitration) GetNext(requesterIds []int) int {
+	next, lowest := -1, 0
+	for i, id := range requesterIds {
+		if id > p.lastGrantedId && (next == -1 || id < requesterIds[next]) {
+			next = i
+		}
+		if id < requesterIds[lowest] {
+			lowest = i
+		}
+	}
+
+	if next == -1 {
+		next = lowest
+	}
+	p.lastGrantedId = requesterIds[next]
+	return next
+}
+
+// Grant the bus to the cache with the lowest id. The caches with higher ids may starve.
+type fixedPriorityArbitration struct{}
+
+func (p *fixedPriorityArbitration) GetNext(requesterIds []int) int {
+	next := 0
+	for i, id := range requesterIds {
+		if id < requesterIds[next] {
+			next = i
+		}
+	}
+	return next
+}
+
+// Grant the bus to a cache chosen at random.
+type randomArbitration struct {
+	rng *rand.Rand
+}
+
+func (p *randomArbitration) GetNext(requesterIds []int) int {
+	return p.rng.Intn(len(requesterIds))
+}
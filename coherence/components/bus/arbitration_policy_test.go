@@ -0,0 +1,84 @@
+package bus
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/testutils"
+)
+
+type arbitrationRound struct {
+	requesterIds []int // Ids of the waiting caches in the order of their requests
+	granted      int   // Expected id of the cache granted the bus
+}
+
+type arbitrationTest struct {
+	policy ArbitrationPolicyType
+	rounds []arbitrationRound // The policy keeps its state from a round to the next
+}
+
+var arbitrationTests = []arbitrationTest{
+	{
+		policy: Fifo,
+		rounds: []arbitrationRound{
+			{requesterIds: []int{2, 0, 1}, granted: 2},
+			{requesterIds: []int{0, 1}, granted: 0},
+		},
+	},
+	{
+		policy: RoundRobin,
+		rounds: []arbitrationRound{
+			{requesterIds: []int{2, 0, 1}, granted: 0},
+			{requesterIds: []int{2, 0, 1}, granted: 1},
+			{requesterIds: []int{2, 0, 1}, granted: 2},
+			{requesterIds: []int{2, 0, 1}, granted: 0}, // Wraps around to the lowest id
+			{requesterIds: []int{3, 0, 2}, granted: 2},
+			{requesterIds: []int{1, 3}, granted: 3},
+			{requesterIds: []int{1, 3}, granted: 1},
+		},
+	},
+	{
+		policy: FixedPriority,
+		rounds: []arbitrationRound{
+			{requesterIds: []int{2, 0, 1}, granted: 0},
+			{requesterIds: []int{2, 0, 1}, granted: 0},
+			{requesterIds: []int{3, 2, 1}, granted: 1},
+			{requesterIds: []int{3}, granted: 3},
+		},
+	},
+}
+
+func TestArbitrationPolicy(t *testing.T) {
+	for _, test := range arbitrationTests {
+		policy := newArbitrationPolicy(ArbitrationConfig{Policy: test.policy})
+		for i, round := range test.rounds {
+			granted := round.requesterIds[policy.GetNext(round.requesterIds)]
+			if granted != round.granted {
+				identifier := fmt.Sprintf("granted cache in round %d (%s)", i, test.policy)
+				t.Errorf(testutils.GetErrorString(identifier, fmt.Sprint(round.granted), fmt.Sprint(granted)))
+			}
+		}
+	}
+}
+
+// The random policy grants every cache and makes the same choices with the same seed.
+func TestRandomArbitration(t *testing.T) {
+	requesterIds := []int{0, 1, 2, 3}
+	policy := newArbitrationPolicy(ArbitrationConfig{Policy: Random, Seed: 7})
+	samePolicy := newArbitrationPolicy(ArbitrationConfig{Policy: Random, Seed: 7})
+	numGrants := make([]int, len(requesterIds))
+	for i := 0; i < 300; i++ {
+		next := policy.GetNext(requesterIds)
+		if sameNext := samePolicy.GetNext(requesterIds); next != sameNext {
+			t.Fatalf(testutils.GetErrorString(fmt.Sprintf("grant %d with the same seed", i), fmt.Sprint(next),
+				fmt.Sprint(sameNext)))
+		}
+		numGrants[requesterIds[next]]++
+	}
+
+	for id, n := range numGrants {
+		if n == 0 {
+			t.Errorf("cache %d is never granted the bus out of 300 grants", id)
+		}
+	}
+}
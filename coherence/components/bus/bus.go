@@ -5,25 +5,48 @@ package bus
 
 import (
 	"fmt"
-	"time"
+	"io"
 
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/clock"
 	"github.com/chriskheng/cs4223-assignment2/coherence/components/xact"
 	"github.com/chriskheng/cs4223-assignment2/coherence/constants"
+	"github.com/chriskheng/cs4223-assignment2/coherence/simerror"
 )
 
-const transferCycles int = 2 // Cycles needed to send a word from a cache to another. Must be at least 2.
-
 type Bus struct {
-	state                 BusState
-	onRequestGrantedFuncs []xact.OnRequestGrantedCallBack
-	snoopingCallBacks     []xact.SnoopingCallBack
-	hasCopyCallBacks      []xact.HasCopyCallBack
-	counter               int
-	requestBeingProcessed xact.Transaction
-	replyToSend           xact.Transaction
-	busAcquiredTimestamp  time.Time
-	stats                 BusStats
-	iter                  int
+	config                  Config
+	clock                   *clock.Clock
+	state                   BusState
+	requesters              []requester
+	snoopingCallBacks       []xact.SnoopingCallBack
+	eventObservers          []EventObserver
+	hasCopyCallBacks        []xact.HasCopyCallBack
+	willSupplyCallBacks     []xact.WillSupplyCallBack
+	writeBackCallBacks      []xact.PendingWriteBacksCallBack
+	backInvalidateCallBacks []xact.BackInvalidateCallBack
+	counter                 int
+	requestBeingProcessed   xact.Transaction
+	replyToSend             xact.Transaction
+	grantCycle              int // Cycle of the last grant, which identifies the holder of the bus
+	stats                   BusStats
+	isSplitTransaction      bool
+	split                   splitTransactionState // Only used by a split-transaction bus
+	arbitration             ArbitrationPolicy
+}
+
+type requester struct {
+	id               int
+	requestCycle     int
+	onRequestGranted xact.OnRequestGrantedCallBack
+	getTransaction   xact.GetTransactionCallBack
+}
+
+type Config struct {
+	IsSplitTransaction bool              `json:"split_transaction"`
+	MaxOutstanding     int               `json:"max_outstanding"` // Only used by a split-transaction bus
+	Arbitration        ArbitrationConfig `json:"arbitration"`
+	TransferCycles     int               `json:"transfer_cycles"` // Cycles needed to send Width words. Must be at least 2
+	Width              int               `json:"width"`           // Number of words sent at once
 }
 
 type BusState int
@@ -36,57 +59,129 @@ const (
 	ReplySent
 )
 
+func (s BusState) String() string {
+	return [...]string{"Ready", "ProcessingRequest", "RequestSent", "ProcessingReply", "ReplySent"}[s]
+}
+
+type EventType int
+
+const (
+	GrantEvent   EventType = iota // The bus is granted to a cache, whose transaction is given
+	RequestEvent                  // A request is broadcast to the caches and memory
+	ReplyEvent                    // A reply is broadcast to the caches and memory
+	ReleaseEvent                  // The holder of the transaction given releases the bus
+)
+
+func (e EventType) String() string {
+	return [...]string{"grant", "request", "reply", "release"}[e]
+}
+
+// EventObserver is notified of every event of the bus. The caches handle the event between BeforeEvent and
+// AfterEvent, so that an observer can tell which caches changed state in response. A cache may release the bus while
+// it snoops a reply, in which case the release is notified between the BeforeEvent and AfterEvent of the reply.
+type EventObserver interface {
+	BeforeEvent(eventType EventType, transaction xact.Transaction)
+	AfterEvent(eventType EventType, transaction xact.Transaction)
+}
+
 type BusStats struct {
 	DataTraffic      int
 	NumInvalidations int
 	NumUpdates       int
+	NumWriteBacks    int              // Number of blocks written back to memory
+	Requesters       []RequesterStats // Indexed by cache id
+}
+
+type RequesterStats struct {
+	NumGrants     int
+	NumWaitCycles int // Cycles between requesting the bus and being granted it
+	MaxWaitCycles int
 }
 
-func NewBus() *Bus {
+// blockSize is in bytes and is only used by a split-transaction bus.
+func NewBus(config Config, blockSize int, clock *clock.Clock) *Bus {
 	bus := &Bus{
-		state: Ready,
+		config:      config,
+		clock:       clock,
+		state:       Ready,
+		grantCycle:  -1,
+		arbitration: newArbitrationPolicy(config.Arbitration),
+	}
+	if config.IsSplitTransaction {
+		bus.enableSplitTransaction(config.MaxOutstanding, blockSize)
 	}
 
 	return bus
 }
 
 func (b *Bus) Execute() {
-	b.iter++
+	if b.isSplitTransaction {
+		b.executeSplitTransaction()
+		return
+	}
+
 	switch b.state {
 	case Ready:
-		if len(b.onRequestGrantedFuncs) == 0 {
+		transaction, isGranted := b.grantRequest()
+		if !isGranted {
 			return
 		}
-		b.busAcquiredTimestamp = time.Now()
-		transaction := b.onRequestGrantedFuncs[0](b.busAcquiredTimestamp)
 		b.requestBeingProcessed = transaction
-		b.onRequestGrantedFuncs = b.onRequestGrantedFuncs[1:]
 
 		b.transferDataAndRecordStats(transaction)
 		b.state = ProcessingRequest
 	case ProcessingRequest:
 		b.counter--
 		if b.counter <= 0 {
-			for _, snoopingCallback := range b.snoopingCallBacks {
-				snoopingCallback(b.requestBeingProcessed)
-			}
+			b.snoop(RequestEvent, b.requestBeingProcessed)
 			b.state = RequestSent
 		}
 	case ProcessingReply:
 		b.counter--
 		if b.counter <= 0 {
 			b.state = ReplySent // MUST be before callback!
-			for _, snoopingCallback := range b.snoopingCallBacks {
-				snoopingCallback(b.replyToSend)
-			}
+			b.snoop(ReplyEvent, b.replyToSend)
+		}
+	}
+}
+
+// Return the number of next cycles in which Execute does nothing but transfer the current transaction, or wait for a
+// reply or a request.
+func (b *Bus) GetNumIdleCycles() int {
+	if b.isSplitTransaction {
+		return b.getSplitNumIdleCycles()
+	}
+
+	switch b.state {
+	case Ready:
+		if len(b.requesters) > 0 {
+			return 0
 		}
+	case ProcessingRequest, ProcessingReply:
+		return getNumTransferIdleCycles(b.counter)
 	}
+	return constants.IdleForever
 }
 
-func (b *Bus) ReleaseBus(timestamp time.Time) {
-	if timestamp != b.busAcquiredTimestamp {
-		panic("given timestamp to ReleaseBus() is not the same as busAcquiredTimestamp")
+// Advance by the given number of cycles, which must be idle cycles.
+func (b *Bus) SkipIdleCycles(numCycles int) {
+	if b.isSplitTransaction {
+		b.skipSplitIdleCycles(numCycles)
+	} else if b.state == ProcessingRequest || b.state == ProcessingReply {
+		b.counter -= numCycles
 	}
+}
+
+func (b *Bus) ReleaseBus(grantCycle int) {
+	if b.isSplitTransaction {
+		b.completeOutstanding(grantCycle)
+		return
+	}
+
+	if grantCycle != b.grantCycle {
+		panic(simerror.New("bus", nil, "bus is released by a cache which does not hold it"))
+	}
+	b.notifyEvent(ReleaseEvent, b.requestBeingProcessed)
 	b.requestBeingProcessed = xact.Transaction{TransactionType: xact.Nil}
 	b.replyToSend = xact.Transaction{TransactionType: xact.Nil}
 	b.state = Ready
@@ -96,24 +191,63 @@ func (b *Bus) RegisterSnoopingCallBack(callback xact.SnoopingCallBack) {
 	b.snoopingCallBacks = append(b.snoopingCallBacks, callback)
 }
 
-func (b *Bus) RequestAccess(onRequestGranted xact.OnRequestGrantedCallBack) {
-	b.onRequestGrantedFuncs = append(b.onRequestGrantedFuncs, onRequestGranted)
+func (b *Bus) RegisterEventObserver(observer EventObserver) {
+	b.eventObservers = append(b.eventObservers, observer)
 }
 
+// getTransaction must return the transaction the requester would send if it were granted the bus now.
+func (b *Bus) RequestAccess(onRequestGranted xact.OnRequestGrantedCallBack, getTransaction xact.GetTransactionCallBack) {
+	b.requesters = append(b.requesters, requester{
+		id:               getTransaction().SenderId,
+		requestCycle:     b.clock.GetCycle(),
+		onRequestGranted: onRequestGranted,
+		getTransaction:   getTransaction,
+	})
+}
+
+// A cache replying with a block must set the RequesterId of the transaction to the id of the cache whose request is
+// replied to. On an atomic bus, the bus sets it since there is a single request to reply to.
 func (b *Bus) Reply(transaction xact.Transaction) {
+	if b.isSplitTransaction {
+		b.replySplitTransaction(transaction)
+		return
+	}
+
+	transaction.RequesterId = b.requestBeingProcessed.RequesterId
 	if b.state == ProcessingReply {
 		// Bus would only send the first reply it receives.
 		return
 	} else if !(b.state == RequestSent || b.state == ReplySent) {
-		panic(fmt.Sprintf("bus's reply() is called when bus is in %d state\n", b.state))
+		panic(simerror.New("bus", &transaction, "reply is sent when no request was sent"))
 	}
 
 	b.transferDataAndRecordStats(transaction)
-	b.recordStats(transaction)
 	b.replyToSend = transaction
 	b.state = ProcessingReply
 }
 
+// Return the state of the bus, which is given by its outstanding transactions on a split-transaction bus.
+func (b *Bus) GetStateDescription() string {
+	if b.isSplitTransaction {
+		return b.getSplitStateDescription()
+	}
+	if b.state == Ready {
+		return b.state.String()
+	}
+	return b.state.String() + " " + simerror.FormatTransaction(b.requestBeingProcessed)
+}
+
+// Write the state of the bus and the requesters waiting for it, in the order they requested it.
+func (b *Bus) WriteState(w io.Writer) {
+	fmt.Fprintf(w, "bus: %s\n", b.GetStateDescription())
+	if b.isSplitTransaction {
+		b.writeSplitState(w)
+	}
+	for _, r := range b.requesters {
+		fmt.Fprintf(w, "  requester cache %d since cycle %d\n", r.id, r.requestCycle)
+	}
+}
+
 func (b *Bus) RegisterHasCopy(callback xact.HasCopyCallBack) {
 	b.hasCopyCallBacks = append(b.hasCopyCallBacks, callback)
 }
@@ -127,16 +261,157 @@ func (b *Bus) CheckHasCopy(address uint32) bool {
 	return false
 }
 
+func (b *Bus) RegisterWillSupply(callback xact.WillSupplyCallBack) {
+	b.willSupplyCallBacks = append(b.willSupplyCallBacks, callback)
+}
+
+// Return true if a cache is going to reply with the block to the given request, in which case memory does not have to
+// read it.
+func (b *Bus) CheckWillSupply(request xact.Transaction) bool {
+	for i := range b.willSupplyCallBacks {
+		if b.willSupplyCallBacks[i](request) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Bus) RegisterPendingWriteBacks(callback xact.PendingWriteBacksCallBack) {
+	b.writeBackCallBacks = append(b.writeBackCallBacks, callback)
+}
+
+// Return the ids of the caches to which a cache is going to reply with a Flush of the block of the given address, or
+// whose Flush is not snooped yet. Memory must snoop these Flushes before reading the block, since they write back
+// the latest values of the block.
+func (b *Bus) GetPendingWriteBacks(address uint32) []int {
+	requesterIds := []int{}
+	for i := range b.writeBackCallBacks {
+		requesterIds = append(requesterIds, b.writeBackCallBacks[i](address)...)
+	}
+	if b.isSplitTransaction {
+		requesterIds = append(requesterIds, b.getSplitPendingWriteBacks(address)...)
+	}
+	return requesterIds
+}
+
+// Return true if the access of the cache holding the bus since the given grant cycle can complete. On a
+// split-transaction bus, the accesses to a block complete in the order of their requests on the bus.
+func (b *Bus) CanComplete(grantCycle int) bool {
+	if !b.isSplitTransaction {
+		return true
+	}
+	return b.canCompleteSplitTransaction(grantCycle)
+}
+
+func (b *Bus) RegisterBackInvalidate(callback xact.BackInvalidateCallBack) {
+	b.backInvalidateCallBacks = append(b.backInvalidateCallBacks, callback)
+}
+
+// Invalidate the copies of the given address in every cache, as needed when an inclusive L2 cache evicts a block.
+// Return the number of copies invalidated and whether any of them was dirty.
+func (b *Bus) BackInvalidate(address uint32) (int, bool) {
+	numInvalidated := 0
+	isDirty := false
+	for i := range b.backInvalidateCallBacks {
+		hadCopy, wasDirty := b.backInvalidateCallBacks[i](address)
+		if hadCopy {
+			numInvalidated++
+		}
+		isDirty = isDirty || wasDirty
+	}
+	return numInvalidated, isDirty
+}
+
 func (b *Bus) GetStatistics() BusStats {
 	return b.stats
 }
 
+// Grant the bus to the requester chosen by the arbitration policy.
+func (b *Bus) grantRequest() (xact.Transaction, bool) {
+	if len(b.requesters) == 0 {
+		return xact.Transaction{TransactionType: xact.Nil}, false
+	}
+	requesterIds := make([]int, len(b.requesters))
+	for i, r := range b.requesters {
+		requesterIds[i] = r.id
+	}
+	next := b.arbitration.GetNext(requesterIds)
+
+	r := b.requesters[next]
+	b.requesters = append(b.requesters[:next], b.requesters[next+1:]...)
+	b.recordGrant(r)
+
+	if len(b.eventObservers) > 0 {
+		b.beforeEvent(GrantEvent, r.getTransaction())
+	}
+	// At most one request is granted per cycle, so the grant cycle identifies the holder.
+	b.grantCycle = b.clock.GetCycle()
+	transaction := r.onRequestGranted(b.grantCycle)
+	transaction.RequesterId = transaction.SenderId
+	b.afterEvent(GrantEvent, transaction)
+	return transaction, true
+}
+
+// The bus may grant a request in the cycle it is made, since the caches execute before the bus.
+func (b *Bus) recordGrant(r requester) {
+	for len(b.stats.Requesters) <= r.id {
+		b.stats.Requesters = append(b.stats.Requesters, RequesterStats{})
+	}
+
+	waitCycles := b.clock.GetCycle() - r.requestCycle
+	stats := &b.stats.Requesters[r.id]
+	stats.NumGrants++
+	stats.NumWaitCycles += waitCycles
+	if waitCycles > stats.MaxWaitCycles {
+		stats.MaxWaitCycles = waitCycles
+	}
+}
+
+func (b *Bus) snoop(eventType EventType, transaction xact.Transaction) {
+	b.beforeEvent(eventType, transaction)
+	for _, snoopingCallback := range b.snoopingCallBacks {
+		snoopingCallback(transaction)
+	}
+	b.afterEvent(eventType, transaction)
+}
+
+// Notify an event in which the caches do nothing.
+func (b *Bus) notifyEvent(eventType EventType, transaction xact.Transaction) {
+	b.beforeEvent(eventType, transaction)
+	b.afterEvent(eventType, transaction)
+}
+
+func (b *Bus) beforeEvent(eventType EventType, transaction xact.Transaction) {
+	for _, observer := range b.eventObservers {
+		observer.BeforeEvent(eventType, transaction)
+	}
+}
+
+func (b *Bus) afterEvent(eventType EventType, transaction xact.Transaction) {
+	for _, observer := range b.eventObservers {
+		observer.AfterEvent(eventType, transaction)
+	}
+}
+
 func (b *Bus) transferDataAndRecordStats(transaction xact.Transaction) {
-	// b.counter +1 to leave the send reply logic to Execute() cuz counter may be zero here if without +1.
-	b.counter = transferCycles*(int(transaction.SendDataSize)) + 1
+	b.counter = b.getTransferCycles(transaction)
 	b.recordStats(transaction)
 }
 
+// A transfer is done in the cycle its counter reaches 0, the cycles before only count down.
+func getNumTransferIdleCycles(counter int) int {
+	if counter <= 1 {
+		return 0
+	}
+	return counter - 1
+}
+
+// +1 to leave the send reply logic to Execute() cuz the number of cycles may be zero here if without +1.
+func (b *Bus) getTransferCycles(transaction xact.Transaction) int {
+	numTransfers := (int(transaction.SendDataSize) + b.config.Width - 1) / b.config.Width
+	return b.config.TransferCycles*numTransfers + 1
+}
+
 func (b *Bus) recordStats(transaction xact.Transaction) {
 	b.stats.DataTraffic += int(transaction.SendDataSize) * int(constants.WordSize)
 	switch transaction.TransactionType {
@@ -144,5 +419,7 @@ func (b *Bus) recordStats(transaction xact.Transaction) {
 		b.stats.NumInvalidations++
 	case xact.BusUpd:
 		b.stats.NumUpdates++
+	case xact.Flush:
+		b.stats.NumWriteBacks++
 	}
 }
@@ -0,0 +1,304 @@
+package bus
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/xact"
+	"github.com/chriskheng/cs4223-assignment2/coherence/constants"
+	"github.com/chriskheng/cs4223-assignment2/coherence/simerror"
+)
+
+/*
+A split-transaction bus has separate request and response phases, which are arbitrated separately. A granted request is
+outstanding until the requester releases the bus, and the bus is free for other requests while memory works on the
+reply. Requests are snooped one at a time in the order they are granted, which orders the accesses to a block. Several
+outstanding requests may be for the same block: the caches waiting for the block keep serving the requests snooped
+after theirs in transient states, and the accesses to the block complete in the order of their requests.
+
+A cache sets the RequesterId of its replies, since it may only reply once it gets the block itself, long after it
+snooped the request. Memory sets the RequesterId of its replies too.
+*/
+type splitTransactionState struct {
+	maxOutstanding     int
+	offsetNumBits      uint32
+	outstanding        []*outstandingTransaction // In the order the requests were granted
+	requestInTransfer  *outstandingTransaction
+	requestCounter     int
+	responses          []xact.Transaction // Waiting for the response phase
+	responseInTransfer xact.Transaction
+	responseCounter    int
+}
+
+type outstandingTransaction struct {
+	transaction              xact.Transaction
+	grantCycle               int
+	orderCycle               int  // Cycle in which the request for the block is snooped, -1 until then
+	isWaitingForRequestPhase bool // The holder has sent its next request with Reply, e.g. after an evict write back
+}
+
+// Make the bus a split-transaction bus which allows up to maxOutstanding outstanding transactions. blockSize is in
+// bytes and is used to find the requests for the same block.
+func (b *Bus) enableSplitTransaction(maxOutstanding int, blockSize int) {
+	b.isSplitTransaction = true
+	b.split = splitTransactionState{
+		maxOutstanding: maxOutstanding,
+		offsetNumBits:  uint32(math.Log2(float64(blockSize))),
+	}
+}
+
+// At most one transaction is snooped per cycle, so that a cache never has to reply to two transactions at once. The
+// request phase waits for a cycle if a response is snooped in the same cycle.
+func (b *Bus) executeSplitTransaction() {
+	hasSnoopedResponse := b.executeResponsePhase()
+	b.executeRequestPhase(hasSnoopedResponse)
+}
+
+func (b *Bus) executeResponsePhase() bool {
+	s := &b.split
+	if s.responseInTransfer.TransactionType == xact.Nil {
+		if len(s.responses) == 0 {
+			return false
+		}
+		s.responseInTransfer = s.responses[0]
+		s.responses = s.responses[1:]
+		// Same timing as a reply on an atomic bus, whose transfer starts as soon as it is sent.
+		s.responseCounter = b.getTransferCycles(s.responseInTransfer)
+		b.recordStats(s.responseInTransfer)
+	}
+
+	s.responseCounter--
+	if s.responseCounter > 0 {
+		return false
+	}
+
+	response := s.responseInTransfer
+	s.responseInTransfer = xact.Transaction{TransactionType: xact.Nil}
+	if response.SenderId != constants.MemoryId {
+		b.dropMemReadDone(response)
+	}
+	b.snoop(ReplyEvent, response)
+	return true
+}
+
+func (b *Bus) executeRequestPhase(hasSnoopedResponse bool) {
+	s := &b.split
+	if s.requestInTransfer == nil {
+		b.grantNextRequest()
+		return
+	}
+
+	if s.requestCounter > 0 {
+		s.requestCounter--
+	}
+	if s.requestCounter > 0 || hasSnoopedResponse {
+		return
+	}
+
+	outstanding := s.requestInTransfer
+	s.requestInTransfer = nil
+	// An evict write back is not a request for the block of the access.
+	if outstanding.orderCycle == -1 && outstanding.transaction.TransactionType != xact.Flush {
+		outstanding.orderCycle = b.clock.GetCycle()
+	}
+	b.snoop(RequestEvent, outstanding.transaction)
+}
+
+// The next requests of the holders go first since they don't need another outstanding transaction.
+func (b *Bus) grantNextRequest() {
+	s := &b.split
+	for _, outstanding := range s.outstanding {
+		if outstanding.isWaitingForRequestPhase {
+			outstanding.isWaitingForRequestPhase = false
+			b.startRequestPhase(outstanding)
+			return
+		}
+	}
+
+	if len(s.outstanding) >= s.maxOutstanding {
+		return
+	}
+
+	transaction, isGranted := b.grantRequest()
+	if !isGranted {
+		return
+	}
+	outstanding := &outstandingTransaction{transaction: transaction, grantCycle: b.grantCycle, orderCycle: -1}
+	s.outstanding = append(s.outstanding, outstanding)
+	b.startRequestPhase(outstanding)
+}
+
+func (b *Bus) startRequestPhase(outstanding *outstandingTransaction) {
+	b.split.requestInTransfer = outstanding
+	b.split.requestCounter = b.getTransferCycles(outstanding.transaction)
+	b.recordStats(outstanding.transaction)
+}
+
+// The response phase is idle while a response is transferred or there is none to send. The request phase is idle
+// while a request is transferred or none can be granted, which does not change until a transaction completes or a
+// cache requests the bus.
+func (b *Bus) getSplitNumIdleCycles() int {
+	s := &b.split
+	numIdleCycles := constants.IdleForever
+	if s.responseInTransfer.TransactionType != xact.Nil {
+		numIdleCycles = getNumTransferIdleCycles(s.responseCounter)
+	} else if len(s.responses) > 0 {
+		return 0
+	}
+
+	if s.requestInTransfer != nil {
+		if requestIdleCycles := getNumTransferIdleCycles(s.requestCounter); requestIdleCycles < numIdleCycles {
+			numIdleCycles = requestIdleCycles
+		}
+	} else if b.canGrantRequest() {
+		return 0
+	}
+	return numIdleCycles
+}
+
+func (b *Bus) canGrantRequest() bool {
+	s := &b.split
+	for _, outstanding := range s.outstanding {
+		if outstanding.isWaitingForRequestPhase {
+			return true
+		}
+	}
+	return len(s.outstanding) < s.maxOutstanding && len(b.requesters) > 0
+}
+
+func (b *Bus) skipSplitIdleCycles(numCycles int) {
+	s := &b.split
+	if s.responseInTransfer.TransactionType != xact.Nil {
+		s.responseCounter -= numCycles
+	}
+	if s.requestInTransfer != nil {
+		s.requestCounter -= numCycles
+	}
+}
+
+func (b *Bus) replySplitTransaction(transaction xact.Transaction) {
+	s := &b.split
+	switch transaction.TransactionType {
+	case xact.BusRead, xact.BusReadX, xact.BusUpgr, xact.BusUpd:
+		outstanding := b.getOutstanding(transaction.SenderId)
+		if outstanding == nil {
+			panic(simerror.New("bus", &transaction, "cache sends a request with Reply() without holding the bus"))
+		}
+		transaction.RequesterId = transaction.SenderId
+		outstanding.transaction = transaction
+		outstanding.isWaitingForRequestPhase = true
+		return
+	}
+
+	if transaction.SenderId != constants.MemoryId && b.getOutstanding(transaction.RequesterId) == nil {
+		panic(simerror.New("bus", &transaction, "cache replies to cache %d which has no outstanding request",
+			transaction.RequesterId))
+	}
+	s.responses = append(s.responses, transaction)
+}
+
+// Memory may finish reading a block before it snoops the reply of a cache with the same block, in which case its
+// reply is not needed anymore.
+func (b *Bus) dropMemReadDone(cacheReply xact.Transaction) {
+	s := &b.split
+	responses := s.responses[:0]
+	for _, response := range s.responses {
+		isNotNeeded := response.TransactionType == xact.MemReadDone &&
+			response.RequesterId == cacheReply.RequesterId &&
+			b.isSameBlock(response.Address, cacheReply.Address)
+		if !isNotNeeded {
+			responses = append(responses, response)
+		}
+	}
+	s.responses = responses
+}
+
+func (b *Bus) completeOutstanding(grantCycle int) {
+	s := &b.split
+	for i, outstanding := range s.outstanding {
+		if outstanding.grantCycle == grantCycle {
+			b.notifyEvent(ReleaseEvent, outstanding.transaction)
+			s.outstanding = append(s.outstanding[:i], s.outstanding[i+1:]...)
+			return
+		}
+	}
+	panic(simerror.New("bus", nil, "bus is released by a cache which has no outstanding transaction"))
+}
+
+// Return the outstanding transaction of the given cache, or nil if it has none.
+func (b *Bus) getOutstanding(requesterId int) *outstandingTransaction {
+	for _, outstanding := range b.split.outstanding {
+		if outstanding.transaction.RequesterId == requesterId {
+			return outstanding
+		}
+	}
+	return nil
+}
+
+// An access waits for the accesses to its block whose requests were snooped before its own.
+func (b *Bus) canCompleteSplitTransaction(grantCycle int) bool {
+	var current *outstandingTransaction
+	for _, outstanding := range b.split.outstanding {
+		if outstanding.grantCycle == grantCycle {
+			current = outstanding
+		}
+	}
+	if current == nil || current.orderCycle == -1 {
+		panic(simerror.New("bus", nil, "cache completes an access whose request is not snooped"))
+	}
+
+	for _, outstanding := range b.split.outstanding {
+		isEarlier := outstanding.orderCycle != -1 && outstanding.orderCycle < current.orderCycle
+		if isEarlier && b.isSameBlock(outstanding.transaction.Address, current.transaction.Address) {
+			return false
+		}
+	}
+	return true
+}
+
+// Return the ids of the caches to which a Flush of the block of the given address waits for the response phase or is
+// transferred in it.
+func (b *Bus) getSplitPendingWriteBacks(address uint32) []int {
+	s := &b.split
+	responses := s.responses
+	if s.responseInTransfer.TransactionType != xact.Nil {
+		responses = append([]xact.Transaction{s.responseInTransfer}, responses...)
+	}
+
+	requesterIds := []int{}
+	for _, response := range responses {
+		if response.TransactionType == xact.Flush && b.isSameBlock(response.Address, address) {
+			requesterIds = append(requesterIds, response.RequesterId)
+		}
+	}
+	return requesterIds
+}
+
+func (b *Bus) getSplitStateDescription() string {
+	transactions := []string{}
+	for _, outstanding := range b.split.outstanding {
+		transactions = append(transactions, simerror.FormatTransaction(outstanding.transaction))
+	}
+	return fmt.Sprintf("%d outstanding [%s]", len(transactions), strings.Join(transactions, "; "))
+}
+
+func (b *Bus) writeSplitState(w io.Writer) {
+	s := &b.split
+	if s.requestInTransfer != nil {
+		fmt.Fprintf(w, "  request phase: %s, %d cycles left\n",
+			simerror.FormatTransaction(s.requestInTransfer.transaction), s.requestCounter)
+	}
+	if s.responseInTransfer.TransactionType != xact.Nil {
+		fmt.Fprintf(w, "  response phase: %s, %d cycles left\n", simerror.FormatTransaction(s.responseInTransfer),
+			s.responseCounter)
+	}
+	for _, response := range s.responses {
+		fmt.Fprintf(w, "  response waiting: %s\n", simerror.FormatTransaction(response))
+	}
+}
+
+func (b *Bus) isSameBlock(address1 uint32, address2 uint32) bool {
+	return address1>>b.split.offsetNumBits == address2>>b.split.offsetNumBits
+}
@@ -9,10 +9,15 @@ developed for simulating a particular cache coherence protocol, e.g. MesiCacheCo
 package cache
 
 import (
-	"time"
+	"fmt"
+	"strings"
+	"unicode"
 
 	"github.com/chriskheng/cs4223-assignment2/coherence/components/bus"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/values"
 	"github.com/chriskheng/cs4223-assignment2/coherence/components/xact"
+	"github.com/chriskheng/cs4223-assignment2/coherence/constants"
+	"github.com/chriskheng/cs4223-assignment2/coherence/simerror"
 )
 
 type BaseCacheController struct {
@@ -24,13 +29,29 @@ type BaseCacheController struct {
 	currentTransaction             xact.Transaction
 	needToReply                    bool
 	transactionToSendWhenReplying  xact.Transaction
-	busAcquiredTimestamp           time.Time
+	busGrantCycle                  int
 	isHoldingBus                   bool
 	id                             int
 	stats                          CacheControllerStats
 	updateAccessStatsCallback      UpdateAccessStatsCallback
-	iter                           int
 	xactToIssueAfterEvictWriteBack xact.Transaction
+	getLineState                   func(index int) LineState // Set by the protocol to describe its state of a cache line
+	isWriteRequest                 bool
+	isMiss                         bool            // Whether the current request misses, which is only counted once it completes
+	values                         *values.Tracker // nil if the values are not tracked
+	lineValues                     [][]uint32      // Values of the words of every cache line, indexed like the cache array
+	storeValue                     uint32          // Value written by the current write request
+	isStorePerformed               bool            // True once the store of the current write request is visible
+
+	// State of the request while it is pending on a split-transaction bus, see snoop.
+	isPending                bool               // The request is snooped on the bus but not complete
+	isDataPending            bool               // The block requested is not received yet
+	orderedState             string             // State of the line once the request is snooped
+	deferredReplies          []xact.Transaction // Replies with the block, sent once the request is complete
+	isEvictionDeferred       bool               // The line is invalidated while the request is pending
+	isBackInvalidateDeferred bool               // The line is back invalidated while the cache holds the bus for it
+	backInvalidate           xact.BackInvalidateCallBack
+	updatedWords             []bool // Words updated by a BusUpd before the block is received, if values are tracked
 }
 
 type CacheControllerState int
@@ -45,14 +66,24 @@ const (
 	WaitForEvictWriteBack
 )
 
-func NewBaseCache(id int, bus *bus.Bus, blockSize, associativity, cacheSize int) *BaseCacheController {
+func (s CacheControllerState) String() string {
+	return [...]string{"Ready", "CacheHit", "RequestForBus", "WaitForBus", "WaitForRequestToComplete",
+		"WaitForWriteBack", "WaitForEvictWriteBack"}[s]
+}
+
+// The seed of the replacement policy is offset by the id so that the caches don't make the same random choices.
+func NewBaseCache(id int, bus *bus.Bus, blockSize, associativity, cacheSize int,
+	replacement ReplacementConfig) *BaseCacheController {
+	replacement.Seed += int64(id)
 	baseCacheController := &BaseCacheController{
 		bus:   bus,
-		cache: NewCacheDs(blockSize, associativity, cacheSize),
+		cache: NewCacheDsWithPolicy(blockSize, associativity, cacheSize, replacement),
 		id:    id,
 	}
 
 	bus.RegisterHasCopy(baseCacheController.HasCopy)
+	bus.RegisterWillSupply(baseCacheController.WillSupply)
+	bus.RegisterPendingWriteBacks(baseCacheController.getPendingWriteBacks)
 
 	return baseCacheController
 }
@@ -63,36 +94,62 @@ func (cc *BaseCacheController) RegisterUpdateAccessStatsCallback(callback Update
 
 func (cc *BaseCacheController) Execute() {
 	if cc.needToReply {
-		cc.bus.Reply(cc.transactionToSendWhenReplying)
+		cc.bus.Reply(cc.attachValues(cc.transactionToSendWhenReplying))
 		cc.needToReply = false
 		cc.transactionToSendWhenReplying = xact.Transaction{TransactionType: xact.Nil}
 	}
 
-	cc.iter++
-	cc.cache.currentCycle++
-
 	switch cc.state {
 	case CacheHit:
+		if cc.isHoldingBus && !cc.bus.CanComplete(cc.busGrantCycle) {
+			return
+		}
 		cc.stats.NumCacheAccesses++
+		if cc.isMiss {
+			cc.stats.NumCacheMisses++
+		}
 		cc.cache.Access(cc.requestedAddress)
+		if cc.values != nil {
+			cc.accessValues()
+		}
 		cc.onClientRequestComplete()
+		for _, reply := range cc.deferredReplies {
+			cc.bus.Reply(cc.attachValues(reply))
+		}
+		cc.deferredReplies = nil
 		if cc.isHoldingBus {
-			cc.bus.ReleaseBus(cc.busAcquiredTimestamp)
+			cc.bus.ReleaseBus(cc.busGrantCycle)
 			cc.isHoldingBus = false
 		}
 
-		cc.updateAccessStatsCallback(cc.requestedAddress)
+		// The line may have been invalidated by the request of another cache snooped after the request.
+		if cc.GetLineState(cc.requestedAddress).IsValid {
+			cc.updateAccessStatsCallback(cc.requestedAddress)
+		} else {
+			cc.stats.NumAccessesToSharedData++
+		}
+		cc.completePendingLine()
 		cc.currentTransaction = xact.Transaction{TransactionType: xact.Nil}
 		cc.state = Ready
 	case RequestForBus:
-		cc.bus.RequestAccess(cc.OnBusAccessGranted)
+		cc.bus.RequestAccess(cc.OnBusAccessGranted, cc.getTransactionToSend)
 		cc.state = WaitForBus
 	}
 }
 
-func (cc *BaseCacheController) OnBusAccessGranted(timestamp time.Time) xact.Transaction {
-	cc.busAcquiredTimestamp = timestamp
+// Return the number of next cycles in which Execute does nothing, which is until the cache controller snoops a
+// transaction if it has no reply to send nor a request to complete or to send.
+func (cc *BaseCacheController) GetNumIdleCycles() int {
+	if cc.needToReply || cc.state == CacheHit || cc.state == RequestForBus {
+		return 0
+	}
+	return constants.IdleForever
+}
+
+func (cc *BaseCacheController) OnBusAccessGranted(grantCycle int) xact.Transaction {
+	cc.busGrantCycle = grantCycle
 	cc.isHoldingBus = true
+	cc.currentTransaction = cc.attachValues(cc.currentTransaction)
 
 	if cc.currentTransaction.TransactionType != xact.Flush {
 		cc.state = WaitForRequestToComplete
@@ -103,16 +160,297 @@ func (cc *BaseCacheController) OnBusAccessGranted(timestamp time.Time) xact.Tran
 	return cc.currentTransaction
 }
 
-// MUST call in RequestRead and RequestWrite
+func (cc *BaseCacheController) getTransactionToSend() xact.Transaction {
+	return cc.currentTransaction
+}
+
+// Return true if the transaction is the request of the cache controller or a reply to it. On a split-transaction bus,
+// the cache controller also snoops the transactions of other caches while it waits for its request to complete, and
+// its replies to them are not its own transactions.
+func (cc *BaseCacheController) isOwnTransaction(transaction xact.Transaction) bool {
+	return transaction.RequesterId == cc.id
+}
+
+/*
+Handle a transaction snooped on the bus with the snooping callback of the protocol.
+
+On a split-transaction bus, the requests for a block are ordered by the order they are snooped in, while the caches
+get the block later. The protocol puts the line in the state the request leads to once it snoops its own request,
+e.g. Modified for a BusReadX. Until the access is done, the request is pending: the cache handles the requests of
+other caches for the block as if its access were done, but its replies with the block are deferred until then, as is
+the eviction of the line if one of these requests invalidates it. The line is in a transient state until the block
+is received, e.g. IM_D, or IM_D_S if a BusRead of another cache made it Shared in the meantime.
+
+The replies to the requests of other caches are not given to the protocol, since they do not change the state of the
+line while they may be snooped in any state of it.
+*/
+func (cc *BaseCacheController) snoop(transaction xact.Transaction, onSnoop xact.SnoopingCallBack) {
+	if transaction.RequesterId != cc.id && transaction.RequesterId != transaction.SenderId {
+		return
+	}
+
+	isRequestOfOther := transaction.SenderId != cc.id &&
+		(transaction.TransactionType == xact.BusRead || transaction.TransactionType == xact.BusReadX)
+	isSupplied := isRequestOfOther && cc.bus.CheckWillSupply(transaction)
+	isOwnRequest := transaction.SenderId == cc.id && transaction.TransactionType != xact.Flush
+	isOwnBlock := cc.isDataPending && transaction.SenderId != cc.id &&
+		cc.cache.isSamePrefix(transaction.Address, cc.requestedAddress)
+
+	onSnoop(transaction)
+
+	if isOwnRequest {
+		cc.isPending = true
+		cc.isDataPending = transaction.TransactionType == xact.BusRead || transaction.TransactionType == xact.BusReadX
+		cc.orderedState = cc.GetLineState(cc.requestedAddress).Name
+	} else if isOwnBlock && isBlockReply(transaction) {
+		cc.isDataPending = false
+	}
+
+	if !isRequestOfOther || !cc.needToReply || !isBlockReply(cc.transactionToSendWhenReplying) {
+		return
+	}
+	reply := cc.transactionToSendWhenReplying
+	reply.RequesterId = transaction.RequesterId
+	if isSupplied {
+		// Only the first cache replies, e.g. when several Firefly caches hold a clean copy.
+		cc.needToReply = false
+		cc.transactionToSendWhenReplying = xact.Transaction{TransactionType: xact.Nil}
+	} else if cc.isPendingLine(transaction.Address) {
+		cc.deferredReplies = append(cc.deferredReplies, reply)
+		cc.needToReply = false
+		cc.transactionToSendWhenReplying = xact.Transaction{TransactionType: xact.Nil}
+	} else {
+		cc.transactionToSendWhenReplying = reply
+	}
+}
+
+// Return true if the line of the given address is the one of the pending request.
+func (cc *BaseCacheController) isPendingLine(address uint32) bool {
+	return cc.isPending && cc.cache.isSamePrefix(address, cc.requestedAddress)
+}
+
+// Remove the line of the given address from the cache. The line of the pending request is only removed once the
+// request is complete, since the access is done on it and the deferred replies send its block.
+func (cc *BaseCacheController) evict(address uint32) {
+	if cc.isPendingLine(address) {
+		cc.isEvictionDeferred = true
+		return
+	}
+	cc.cache.Evict(address)
+}
+
+// The line of the block requested is back invalidated once the request is complete, so that the protocol does not
+// lose the line while it holds the bus for it. The L2 cache does not count the write back of the line if it is dirty.
+func (cc *BaseCacheController) deferBackInvalidate(address uint32) (bool, bool) {
+	isValid := cc.GetLineState(address).IsValid
+	if isValid {
+		cc.isBackInvalidateDeferred = true
+	}
+	return isValid, false
+}
+
+func (cc *BaseCacheController) completePendingLine() {
+	cc.isPending = false
+	if cc.isEvictionDeferred {
+		cc.cache.Evict(cc.requestedAddress)
+		cc.isEvictionDeferred = false
+	}
+	if cc.isBackInvalidateDeferred {
+		cc.backInvalidate(cc.requestedAddress)
+		cc.isBackInvalidateDeferred = false
+	}
+}
+
+// Update the transaction waiting for the bus after the cache line of the given address is back invalidated. A write
+// back of the line is no longer needed and an upgrade of the line has to read the block again.
+func (cc *BaseCacheController) onBackInvalidate(address uint32) {
+	if cc.state != WaitForBus || !cc.cache.isSamePrefix(cc.currentTransaction.Address, address) {
+		return
+	}
+
+	switch cc.currentTransaction.TransactionType {
+	case xact.Flush:
+		cc.currentTransaction = cc.xactToIssueAfterEvictWriteBack
+		cc.xactToIssueAfterEvictWriteBack = xact.Transaction{TransactionType: xact.Nil}
+	case xact.BusUpgr:
+		cc.currentTransaction = xact.Transaction{
+			TransactionType:   xact.BusReadX,
+			Address:           cc.currentTransaction.Address,
+			RequestedDataSize: cc.cache.blockSizeInWords,
+			SenderId:          cc.id,
+		}
+	}
+}
+
+// MUST call in RequestRead, and prepareForWrite in RequestWrite
 func (cc *BaseCacheController) prepareForRequest(address uint32, callback func()) {
 	cc.onClientRequestComplete = callback
 	cc.requestedAddress = address
+	cc.isWriteRequest = false
+	cc.isMiss = false
+}
+
+func (cc *BaseCacheController) prepareForWrite(address uint32, callback func()) {
+	cc.prepareForRequest(address, callback)
+	cc.isWriteRequest = true
+	if cc.values != nil {
+		cc.storeValue = cc.values.NewValue(cc.id)
+		cc.isStorePerformed = false
+	}
 }
 
 func (cc *BaseCacheController) GetStats() CacheControllerStats {
-	return cc.stats
+	stats := cc.stats
+	stats.NumEvictions = cc.cache.GetNumEvictions()
+	return stats
+}
+
+// Return the state of the cache line of the given address, which is not valid if the block is not cached.
+func (cc *BaseCacheController) GetLineState(address uint32) LineState {
+	index := cc.cache.GetIndexInArray(address)
+	if index == -1 {
+		return LineState{}
+	}
+	state := cc.getLineState(index)
+	if cc.isDataPending && cc.isPendingLine(address) {
+		state.Transient = "I" + getInitials(cc.orderedState) + "_D"
+		if state.Name != cc.orderedState {
+			state.Transient += "_" + getInitials(state.Name)
+		}
+	}
+	return state
 }
 
+// Return the capital letters of the name of a state, e.g. SC for SharedClean.
+func getInitials(name string) string {
+	initials := []rune{}
+	for _, r := range name {
+		if unicode.IsUpper(r) {
+			initials = append(initials, r)
+		}
+	}
+	return string(initials)
+}
+
+// Return the state of the controller, its current request and the transactions it is working on.
+func (cc *BaseCacheController) GetStateDescription() string {
+	details := []string{cc.state.String()}
+	if cc.state != Ready {
+		op := "load"
+		if cc.isWriteRequest {
+			op = "store"
+		}
+		details = append(details, fmt.Sprintf("%s of 0x%x", op, cc.requestedAddress))
+	}
+	if cc.currentTransaction.TransactionType != xact.Nil {
+		details = append(details, "transaction "+simerror.FormatTransaction(cc.currentTransaction))
+	}
+	if cc.xactToIssueAfterEvictWriteBack.TransactionType != xact.Nil {
+		details = append(details, "then "+simerror.FormatTransaction(cc.xactToIssueAfterEvictWriteBack))
+	}
+	if cc.isHoldingBus {
+		details = append(details, fmt.Sprintf("holding the bus granted in cycle %d", cc.busGrantCycle))
+	}
+	if cc.needToReply {
+		details = append(details, "reply "+simerror.FormatTransaction(cc.transactionToSendWhenReplying))
+	}
+	for _, reply := range cc.deferredReplies {
+		details = append(details, "deferred reply "+simerror.FormatTransaction(reply))
+	}
+	if cc.isEvictionDeferred || cc.isBackInvalidateDeferred {
+		details = append(details, "line invalidated once the request is complete")
+	}
+	return strings.Join(details, ", ")
+}
+
+func (cc *BaseCacheController) GetNumSets() int {
+	return cc.cache.GetNumSets()
+}
+
+// Return the lines of the given set, in the order of their ways.
+func (cc *BaseCacheController) GetSet(set int) []SetLine {
+	lines := []SetLine{}
+	for way := 0; way < int(cc.cache.associativity); way++ {
+		index := cc.cache.getLineIndex(uint32(set), way)
+		cacheLine := cc.cache.cacheArray[index]
+		line := SetLine{Way: way, IsValid: cacheLine.isValid}
+		if cacheLine.isValid {
+			line.Tag = cacheLine.tag
+			line.Address = cc.cache.GetBlockAddress(cacheLine.address)
+			line.State = cc.GetLineState(cacheLine.address).GetDisplayName()
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// Return the bookkeeping of the replacement policy for the line of the given way of the given set, e.g. its LRU
+// timestamp.
+func (cc *BaseCacheController) DescribeReplacement(set int, way int) string {
+	return cc.cache.policy.DescribeLine(uint32(set), way)
+}
+
+// The line of a pending request stays in the cache once it is invalidated, until the request is complete.
 func (cc *BaseCacheController) HasCopy(address uint32) bool {
-	return cc.cache.Contain(address)
+	return cc.GetLineState(address).IsValid
+}
+
+// Return true if the cache is going to reply with the block to the given request, now or once its own request is
+// complete.
+func (cc *BaseCacheController) WillSupply(request xact.Transaction) bool {
+	if cc.needToReply && cc.isBlockReplyTo(cc.transactionToSendWhenReplying, request) {
+		return true
+	}
+	for _, reply := range cc.deferredReplies {
+		if cc.isBlockReplyTo(reply, request) {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the ids of the caches to which the cache is going to reply with a Flush of the block of the given address.
+func (cc *BaseCacheController) getPendingWriteBacks(address uint32) []int {
+	replies := cc.deferredReplies
+	if cc.needToReply {
+		replies = append([]xact.Transaction{cc.transactionToSendWhenReplying}, replies...)
+	}
+
+	requesterIds := []int{}
+	for _, reply := range replies {
+		if reply.TransactionType == xact.Flush && cc.cache.isSamePrefix(reply.Address, address) {
+			requesterIds = append(requesterIds, reply.RequesterId)
+		}
+	}
+	return requesterIds
+}
+
+func (cc *BaseCacheController) isBlockReplyTo(reply xact.Transaction, request xact.Transaction) bool {
+	return isBlockReply(reply) && reply.RequesterId == request.RequesterId &&
+		cc.cache.isSamePrefix(reply.Address, request.Address)
+}
+
+func isBlockReply(transaction xact.Transaction) bool {
+	switch transaction.TransactionType {
+	case xact.Flush, xact.FlushOpt, xact.MemReadDone:
+		return true
+	}
+	return false
+}
+
+// Return an error describing the cache controller and its cache line of the block of the given transaction, or of
+// the requested block if there is no transaction.
+func (cc *BaseCacheController) newError(transaction *xact.Transaction, format string, a ...interface{}) *simerror.Error {
+	err := simerror.New("cache", transaction, format, a...)
+	err.Id = cc.id
+	err.ControllerState = cc.state.String()
+
+	address := cc.requestedAddress
+	if transaction != nil {
+		address = transaction.Address
+	}
+	err.SetAddress(cc.cache.GetBlockAddress(address))
+
+	err.LineState = cc.GetLineState(address).GetDisplayName()
+	return err
 }
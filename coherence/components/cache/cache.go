@@ -1,9 +1,7 @@
 package cache
 
 import (
-	"fmt"
 	"math"
-	"time"
 
 	"github.com/chriskheng/cs4223-assignment2/coherence/constants"
 )
@@ -15,20 +13,27 @@ type Cache struct {
 	numSets          uint32
 	blockSizeInWords uint32
 	cacheArray       []CacheLine
-	currentCycle     int64
+	policy           ReplacementPolicy
+	numEvictions     int
 }
 
 type CacheLine struct {
-	tag       uint32
-	address   uint32
-	timestamp int64 // logical counter
+	tag     uint32
+	address uint32
+	isValid bool
 }
 
 // Return a new Cache struct based on the given parameters.
 // All parameters given should NOT be in the form of log2(x), where x is the value of the parameter,
 // i.e. the value given should be x, not log2(x).
 // blockSize and cacheSize are in unit of bytes.
+// The cache uses LRU replacement policy.
 func NewCacheDs(blockSize, associativity, cacheSize int) Cache {
+	return NewCacheDsWithPolicy(blockSize, associativity, cacheSize, ReplacementConfig{Policy: Lru})
+}
+
+// Same as NewCacheDs but the cache uses the given replacement policy.
+func NewCacheDsWithPolicy(blockSize, associativity, cacheSize int, replacement ReplacementConfig) Cache {
 	numBlocks := cacheSize / blockSize
 	numSets := uint32(numBlocks / associativity)
 
@@ -39,6 +44,7 @@ func NewCacheDs(blockSize, associativity, cacheSize int) Cache {
 		numSets:          numSets,
 		blockSizeInWords: uint32(blockSize) / constants.WordSize,
 		cacheArray:       make([]CacheLine, numBlocks),
+		policy:           newReplacementPolicy(replacement, numSets, associativity),
 	}
 }
 
@@ -50,7 +56,7 @@ func (cacheDs *Cache) GetIndexInArray(address uint32) int {
 	for i := 0; i < int(cacheDs.associativity); i++ {
 		absoluteIndex := cacheDs.getAbsoluteIndex(address, i)
 		cacheLine := &cacheDs.cacheArray[absoluteIndex]
-		if cacheLine.timestamp != 0 && cacheLine.tag == tag {
+		if cacheLine.isValid && cacheLine.tag == tag {
 			return int(absoluteIndex)
 		}
 	}
@@ -74,14 +80,14 @@ func (cacheDs *Cache) Insert(address uint32) (bool, uint32, int) {
 	isToBeEvicted, evictedAddress, index := cacheDs.GetAddressToBeEvicted(address)
 
 	cacheDs.cacheArray[index] = CacheLine{
-		tag:       cacheDs.GetTag(address),
-		address:   address,
-		timestamp: cacheDs.currentCycle,
+		tag:     cacheDs.GetTag(address),
+		address: address,
+		isValid: true,
+	}
+	cacheDs.policy.OnInsert(cacheDs.GetCacheSetIndex(address), cacheDs.getWay(index))
+	if isToBeEvicted {
+		cacheDs.numEvictions++
 	}
-
-	// This is needed to add some delay between two consecutive accesses, otherwise the test cases may fail some time
-	// as the time between two consecutive accesses would become the same
-	time.Sleep(time.Microsecond * 1)
 
 	return isToBeEvicted, evictedAddress, index
 }
@@ -92,43 +98,55 @@ func (cacheDs *Cache) Insert(address uint32) (bool, uint32, int) {
 // uint32 -> the address of the address to be evicted if bool is true
 // int -> where the given address would be inserted to in the array
 func (cacheDs *Cache) GetAddressToBeEvicted(address uint32) (bool, uint32, int) {
-	index := cacheDs.getAbsoluteIndex(address, 0)
-	leastTimestamp := cacheDs.cacheArray[index].timestamp
-
-	// LRU eviction policy
-	for i := 1; i < int(cacheDs.associativity); i++ {
+	// An invalid cache line is used before evicting any valid one.
+	for i := 0; i < int(cacheDs.associativity); i++ {
 		absoluteIndex := cacheDs.getAbsoluteIndex(address, i)
-		cacheLine := &cacheDs.cacheArray[absoluteIndex]
-		if cacheLine.timestamp < leastTimestamp {
-			leastTimestamp = cacheLine.timestamp
-			index = absoluteIndex
+		if !cacheDs.cacheArray[absoluteIndex].isValid {
+			return false, 0, int(absoluteIndex)
 		}
 	}
 
-	if leastTimestamp > 0 {
-		return true, cacheDs.cacheArray[index].address, int(index)
-	} else if leastTimestamp == 0 {
-		return false, 0, int(index)
-	} else {
-		panic(fmt.Sprintf("leastTimestamp is not 0 or positive! Value of timestamp: %d", leastTimestamp))
-	}
+	way := cacheDs.policy.GetVictim(cacheDs.GetCacheSetIndex(address))
+	index := cacheDs.getAbsoluteIndex(address, way)
+	return true, cacheDs.cacheArray[index].address, int(index)
 }
 
-// Access the cache line of the given address and update the cache line timestamp.
+// Access the cache line of the given address and let the replacement policy know about it.
 // Return true if the data at the address is cached, otherwise false.
 func (cacheDs *Cache) Access(address uint32) bool {
 	index := cacheDs.GetIndexInArray(address)
 	if index == -1 {
 		return false
 	}
-	cacheDs.cacheArray[index].timestamp = cacheDs.currentCycle
+	cacheDs.policy.OnAccess(cacheDs.GetCacheSetIndex(address), cacheDs.getWay(index))
 	return true
 }
 
-// Remove a cache line from the cache.
+// Remove a cache line from the cache. It is not counted as an eviction, which only counts the cache lines replaced
+// on insertion.
 func (cacheDs *Cache) Evict(address uint32) {
 	index := cacheDs.GetIndexInArray(address)
-	cacheDs.cacheArray[index].timestamp = 0
+	cacheDs.cacheArray[index].isValid = false
+}
+
+// Count an eviction of a cache line which is removed with Evict before another one is inserted in its place.
+func (cacheDs *Cache) recordEviction() {
+	cacheDs.numEvictions++
+}
+
+// Return the number of sets of the cache.
+func (cacheDs *Cache) GetNumSets() int {
+	return int(cacheDs.numSets)
+}
+
+// Return the index in the underlying array of the line of the given way of the given set.
+func (cacheDs *Cache) getLineIndex(set uint32, way int) int {
+	return getLineIndex(cacheDs.numSets, set, way)
+}
+
+// Return the number of cache lines replaced by another one since the cache was created.
+func (cacheDs *Cache) GetNumEvictions() int {
+	return cacheDs.numEvictions
 }
 
 // Return the tag of the given address.
@@ -136,6 +154,11 @@ func (cacheDs *Cache) GetTag(address uint32) uint32 {
 	return address >> (cacheDs.setIndexNumBits + cacheDs.offsetNumBits)
 }
 
+// Return the address of the first byte of the block containing the given address.
+func (cacheDs *Cache) GetBlockAddress(address uint32) uint32 {
+	return address >> cacheDs.offsetNumBits << cacheDs.offsetNumBits
+}
+
 // Return the set index of the given address.
 func (cacheDs *Cache) GetCacheSetIndex(address uint32) uint32 {
 	return (address >> (cacheDs.offsetNumBits)) & ((1 << cacheDs.setIndexNumBits) - 1)
@@ -148,6 +171,11 @@ func (cacheDs *Cache) getAbsoluteIndex(address uint32, round int) uint32 {
 	return normalizedIndex + uint32(round)*cacheDs.numSets
 }
 
+// Return the way in its cache set of the cache line at the given index of the underlying array.
+func (cacheDs *Cache) getWay(absoluteIndex int) int {
+	return absoluteIndex / int(cacheDs.numSets)
+}
+
 // Prefix is defined as tag + set index
 func (cacheDs *Cache) isSamePrefix(address1 uint32, address2 uint32) bool {
 	return cacheDs.GetTag(address1) == cacheDs.GetTag(address2) &&
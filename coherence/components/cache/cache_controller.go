@@ -1,6 +1,9 @@
 package cache
 
-import "github.com/chriskheng/cs4223-assignment2/coherence/components/xact"
+import (
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/values"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/xact"
+)
 
 type CacheController interface {
 	Execute()
@@ -10,6 +13,39 @@ type CacheController interface {
 	HasCopy(address uint32) bool
 	GetStats() CacheControllerStats
 	UpdateAccessStats(address uint32)
+	GetLineState(address uint32) LineState
+	EnableValueTracking(tracker *values.Tracker)
+	GetNumIdleCycles() int
+	GetStateDescription() string
+	GetNumSets() int
+	GetSet(set int) []SetLine
+	DescribeReplacement(set int, way int) string
+}
+
+// LineState describes the state of a cache line in terms of the coherence invariants, whatever the protocol.
+type LineState struct {
+	Name        string // Name of the state in the protocol, empty if the block is not cached
+	Transient   string // Name of the transient state while the cache waits for the block, e.g. IM_D. Empty otherwise
+	IsValid     bool
+	IsExclusive bool // No other cache may hold a valid copy, e.g. Modified or Exclusive
+	IsOwner     bool // At most one cache may hold the block in this state, e.g. Owned, SharedModified or Forward
+}
+
+// Return the name of the transient state of the line if it is in one, or else the name of its state.
+func (s LineState) GetDisplayName() string {
+	if s.Transient != "" {
+		return s.Transient
+	}
+	return s.Name
+}
+
+// SetLine describes a cache line of a cache set, e.g. to be printed by a debugger.
+type SetLine struct {
+	Way     int
+	IsValid bool
+	Tag     uint32
+	Address uint32 // Address of the block
+	State   string // Name of the state in the protocol
 }
 
 type UpdateAccessStatsCallback func(address uint32)
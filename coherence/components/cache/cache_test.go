@@ -221,3 +221,93 @@ func TestInsert(t *testing.T) {
 		}
 	}
 }
+
+type replacementPolicyTest struct {
+	policy       ReplacementPolicyType
+	evictedAddrs []uint32 // Possible addresses evicted when 0x1E3 is inserted
+}
+
+// 0xFEC, 0xDE0 and 0x1E3 are in the same set. 0xFEC is inserted first and accessed again after 0xDE0 is inserted.
+var testsReplacementPolicy = []replacementPolicyTest{
+	{policy: Lru, evictedAddrs: []uint32{0xDE0}},
+	{policy: Fifo, evictedAddrs: []uint32{0xFEC}},
+	{policy: Random, evictedAddrs: []uint32{0xFEC, 0xDE0}},
+	{policy: TreePlru, evictedAddrs: []uint32{0xDE0}},
+	{policy: Lfu, evictedAddrs: []uint32{0xDE0}},
+	{policy: Srrip, evictedAddrs: []uint32{0xDE0}},
+}
+
+func TestReplacementPolicy(t *testing.T) {
+	for _, test := range testsReplacementPolicy {
+		cacheDs := NewCacheDsWithPolicy(16, 2, 1024, ReplacementConfig{Policy: test.policy, Seed: 1})
+		cacheDs.Insert(0xFEC)
+		cacheDs.Insert(0xDE0)
+		cacheDs.Access(0xFEC)
+
+		_, addressToBeEvicted, _ := cacheDs.GetAddressToBeEvicted(0x1E3)
+		isEvicted, address, _ := cacheDs.Insert(0x1E3)
+		if !isEvicted || address != addressToBeEvicted {
+			identifier := fmt.Sprintf("evicted address (%s)", test.policy)
+			expected := fmt.Sprintf("%x", addressToBeEvicted)
+			got := fmt.Sprintf("%x", address)
+			t.Fatalf(testutils.GetErrorString(identifier, expected, got))
+		}
+
+		isExpected := false
+		for _, evictedAddr := range test.evictedAddrs {
+			isExpected = isExpected || address == evictedAddr
+		}
+		if !isExpected {
+			identifier := fmt.Sprintf("evicted address (%s)", test.policy)
+			expected := fmt.Sprintf("%x", test.evictedAddrs)
+			got := fmt.Sprintf("%x", address)
+			t.Fatalf(testutils.GetErrorString(identifier, expected, got))
+		}
+
+		if cacheDs.GetNumEvictions() != 1 {
+			identifier := fmt.Sprintf("num evictions (%s)", test.policy)
+			t.Fatalf(testutils.GetErrorString(identifier, "1", strconv.Itoa(cacheDs.GetNumEvictions())))
+		}
+	}
+}
+
+type replacementPatternTest struct {
+	policy   ReplacementPolicyType
+	accesses []uint32 // Accesses to the full set of 0x000, 0x100, 0x200 and 0x300, inserted in this order
+	evicted  uint32   // Address evicted when 0x400 is inserted, which LRU does not evict
+}
+
+// 0x000 to 0x400 are in the same set of a 4-way cache. In every pattern the policy picks another victim than LRU.
+var testsReplacementPattern = []replacementPatternTest{
+	// Every line is used once more after the insertions, 0x000 twice: the least used ties are broken by the lowest way.
+	{policy: Lfu, accesses: []uint32{0x000, 0x000, 0x100, 0x200, 0x300}, evicted: 0x100},
+	// Every line is promoted, so they are all aged to a distant re-reference interval together.
+	{policy: Srrip, accesses: []uint32{0x100, 0x200, 0x300, 0x000}, evicted: 0x000},
+	// The tree only remembers that 0x200 was used after 0x000 and 0x100, and not that 0x300 is the oldest.
+	{policy: TreePlru, accesses: []uint32{0x000, 0x100, 0x200}, evicted: 0x000},
+	{policy: Fifo, accesses: []uint32{0x000}, evicted: 0x000},
+}
+
+func TestReplacementPattern(t *testing.T) {
+	getVictim := func(policy ReplacementPolicyType, accesses []uint32) uint32 {
+		cacheDs := NewCacheDsWithPolicy(16, 4, 1024, ReplacementConfig{Policy: policy})
+		for _, address := range []uint32{0x000, 0x100, 0x200, 0x300} {
+			cacheDs.Insert(address)
+		}
+		for _, address := range accesses {
+			cacheDs.Access(address)
+		}
+		_, address, _ := cacheDs.Insert(0x400)
+		return address
+	}
+
+	for _, test := range testsReplacementPattern {
+		if lruVictim := getVictim(Lru, test.accesses); lruVictim == test.evicted {
+			t.Fatalf("pattern of %s does not tell it from LRU, which also evicts %x", test.policy, lruVictim)
+		}
+		if address := getVictim(test.policy, test.accesses); address != test.evicted {
+			identifier := fmt.Sprintf("evicted address (%s)", test.policy)
+			t.Errorf(testutils.GetErrorString(identifier, fmt.Sprintf("%x", test.evicted), fmt.Sprintf("%x", address)))
+		}
+	}
+}
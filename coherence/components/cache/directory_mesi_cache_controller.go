@@ -0,0 +1,256 @@
+package cache
+
+import (
+	"fmt"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/network"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/xact"
+)
+
+// DirectoryMesiCacheController simulates a MESI cache controller of directory-based cache coherence. Instead of
+// snooping a bus, it sends its requests point-to-point to the directory and only receives the transactions addressed
+// to it, which are delivered to OnSnoop by the network.
+type DirectoryMesiCacheController struct {
+	*BaseCacheController
+	network         *network.Network
+	directoryId     int
+	cacheStates     []mesiCacheState
+	hasReceivedData bool // True once the data or the UpgrAck of the current request is received
+	numAcksNeeded   int
+	numAcksReceived int
+}
+
+func NewDirectoryMesiCache(id int, network *network.Network, directoryId int, blockSize, associativity,
+	cacheSize int, replacement ReplacementConfig) *DirectoryMesiCacheController {
+	// The base cache controller is created without a bus since there is none in directory-based coherence.
+	replacement.Seed += int64(id)
+	directoryCC := &DirectoryMesiCacheController{
+		BaseCacheController: &BaseCacheController{
+			cache: NewCacheDsWithPolicy(blockSize, associativity, cacheSize, replacement),
+			id:    id,
+		},
+		network:     network,
+		directoryId: directoryId,
+	}
+	directoryCC.RegisterUpdateAccessStatsCallback(directoryCC.UpdateAccessStats)
+
+	directoryCC.cacheStates = make([]mesiCacheState, len(directoryCC.cache.cacheArray))
+	for i := range directoryCC.cacheStates {
+		directoryCC.cacheStates[i] = mesiInvalid
+	}
+	directoryCC.getLineState = func(index int) LineState { return directoryCC.cacheStates[index].lineState() }
+
+	network.RegisterReceiver(id, directoryCC.OnSnoop)
+	return directoryCC
+}
+
+func (cc *DirectoryMesiCacheController) RequestRead(address uint32, callback func()) {
+	cc.prepareForRequest(address, callback)
+
+	if cc.cache.Contain(address) {
+		cc.state = CacheHit
+	} else {
+		cc.isMiss = true
+		cc.requestForMiss(xact.BusRead, address)
+	}
+}
+
+func (cc *DirectoryMesiCacheController) RequestWrite(address uint32, callback func()) {
+	cc.prepareForWrite(address, callback)
+
+	if cc.cache.Contain(address) {
+		index := cc.cache.GetIndexInArray(address)
+		state := cc.cacheStates[index]
+		switch state {
+		case mesiModified:
+			cc.state = CacheHit
+		case mesiExclusive:
+			cc.state = CacheHit
+			cc.cacheStates[index] = mesiModified
+		case mesiShared:
+			cc.sendRequest(xact.BusUpgr, address)
+		default:
+			panic(cc.newError(nil, "cache line is in unknown state %d", state))
+		}
+	} else {
+		cc.isMiss = true
+		cc.requestForMiss(xact.BusReadX, address)
+	}
+}
+
+// A Shared block to be evicted is dropped silently, the directory may then send Inv for it later which is simply
+// acknowledged. Exclusive and Modified blocks need to be put back to the directory before the request is sent.
+func (cc *DirectoryMesiCacheController) requestForMiss(transactionType xact.TransactionType, address uint32) {
+	isToBeEvicted, evictedAddress, index := cc.cache.GetAddressToBeEvicted(address)
+	if !isToBeEvicted || cc.cacheStates[index] == mesiInvalid {
+		cc.sendRequest(transactionType, address)
+		return
+	}
+
+	// The block is removed before the insertion, so the eviction is not counted by the cache itself.
+	cc.cache.recordEviction()
+	switch cc.cacheStates[index] {
+	case mesiShared:
+		cc.invalidateCache(evictedAddress, index)
+		cc.sendRequest(transactionType, address)
+	case mesiModified, mesiExclusive:
+		putType := xact.PutE
+		sendDataSize := uint32(0)
+		if cc.cacheStates[index] == mesiModified {
+			putType = xact.PutM
+			sendDataSize = cc.cache.blockSizeInWords
+		}
+
+		cc.xactToIssueAfterEvictWriteBack = xact.Transaction{TransactionType: transactionType, Address: address}
+		cc.currentTransaction = cc.send(putType, evictedAddress, cc.directoryId, sendDataSize)
+		cc.state = WaitForEvictWriteBack
+	}
+}
+
+func (cc *DirectoryMesiCacheController) sendRequest(transactionType xact.TransactionType, address uint32) {
+	cc.hasReceivedData = false
+	cc.numAcksNeeded = 0
+	cc.numAcksReceived = 0
+	cc.currentTransaction = cc.send(transactionType, address, cc.directoryId, 0)
+	cc.state = WaitForRequestToComplete
+}
+
+// The acknowledgements received are added to the state of the base controller while a request is in progress.
+func (cc *DirectoryMesiCacheController) GetStateDescription() string {
+	description := cc.BaseCacheController.GetStateDescription()
+	if cc.state == WaitForRequestToComplete {
+		description += fmt.Sprintf(", data received %t, %d of %d acks", cc.hasReceivedData, cc.numAcksReceived,
+			cc.numAcksNeeded)
+	}
+	return description
+}
+
+func (cc *DirectoryMesiCacheController) OnSnoop(transaction xact.Transaction) {
+	switch transaction.TransactionType {
+	case xact.FwdBusRead, xact.FwdBusReadX:
+		cc.handleForwardedRequest(transaction)
+	case xact.Inv:
+		if cc.cache.Contain(transaction.Address) {
+			index := cc.cache.GetIndexInArray(transaction.Address)
+			if cc.cacheStates[index] != mesiShared {
+				panic(cc.newError(&transaction, "unexpected snooped transaction"))
+			}
+			cc.invalidateCache(transaction.Address, index)
+		}
+		cc.send(xact.InvAck, transaction.Address, transaction.RequesterId, 0)
+	case xact.Data, xact.DataExclusive, xact.UpgrAck:
+		cc.checkIsWaitingFor(transaction)
+		cc.hasReceivedData = true
+		cc.numAcksNeeded = transaction.NumAcks
+		cc.completeRequestIfDone(transaction.TransactionType)
+	case xact.InvAck:
+		cc.checkIsWaitingFor(transaction)
+		cc.numAcksReceived++
+		cc.completeRequestIfDone(xact.Nil)
+	case xact.PutAck:
+		if cc.state != WaitForEvictWriteBack || transaction.Address != cc.currentTransaction.Address {
+			panic(cc.newError(&transaction, "PutAck is not for the evicted block"))
+		}
+
+		// The block may have been invalidated by a forwarded BusReadX in the meantime.
+		if cc.cache.Contain(transaction.Address) {
+			cc.invalidateCache(transaction.Address, cc.cache.GetIndexInArray(transaction.Address))
+		}
+		toIssue := cc.xactToIssueAfterEvictWriteBack
+		cc.xactToIssueAfterEvictWriteBack = xact.Transaction{TransactionType: xact.Nil}
+		cc.sendRequest(toIssue.TransactionType, toIssue.Address)
+	default:
+		panic(cc.newError(&transaction, "unexpected transaction"))
+	}
+}
+
+// The cache controller is the owner of the block, so it sends the block to the requester directly.
+func (cc *DirectoryMesiCacheController) handleForwardedRequest(transaction xact.Transaction) {
+	index := cc.cache.GetIndexInArray(transaction.Address)
+	if index == -1 {
+		panic(cc.newError(&transaction, "forwarded request is for a block which is not in the cache"))
+	}
+
+	state := cc.cacheStates[index]
+	if state != mesiModified && state != mesiExclusive {
+		panic(cc.newError(&transaction, "unexpected snooped transaction"))
+	}
+
+	cc.send(xact.Data, transaction.Address, transaction.RequesterId, cc.cache.blockSizeInWords)
+	if transaction.TransactionType == xact.FwdBusReadX {
+		cc.invalidateCache(transaction.Address, index)
+		return
+	}
+
+	writeBackSize := uint32(0)
+	if state == mesiModified {
+		writeBackSize = cc.cache.blockSizeInWords
+	}
+	cc.send(xact.WriteBackData, transaction.Address, cc.directoryId, writeBackSize)
+	cc.cacheStates[index] = mesiShared
+}
+
+func (cc *DirectoryMesiCacheController) checkIsWaitingFor(transaction xact.Transaction) {
+	if cc.state != WaitForRequestToComplete || !cc.cache.isSamePrefix(transaction.Address, cc.currentTransaction.Address) {
+		panic(cc.newError(&transaction, "reply is not for the requested block"))
+	}
+}
+
+// The request completes once the data (or UpgrAck) and all the InvAck are received. dataType is the type of the
+// transaction which carried the data, or Nil if the data was received earlier.
+func (cc *DirectoryMesiCacheController) completeRequestIfDone(dataType xact.TransactionType) {
+	if dataType != xact.Nil {
+		address := cc.currentTransaction.Address
+		_, _, index := cc.cache.Insert(address)
+		if index == -1 {
+			index = cc.cache.GetIndexInArray(address)
+		}
+
+		switch {
+		case cc.currentTransaction.TransactionType != xact.BusRead:
+			cc.cacheStates[index] = mesiModified
+		case dataType == xact.DataExclusive:
+			cc.cacheStates[index] = mesiExclusive
+		default:
+			cc.cacheStates[index] = mesiShared
+		}
+	}
+
+	if !cc.hasReceivedData || cc.numAcksReceived != cc.numAcksNeeded {
+		return
+	}
+
+	cc.send(xact.Unblock, cc.currentTransaction.Address, cc.directoryId, 0)
+	cc.state = CacheHit
+}
+
+func (cc *DirectoryMesiCacheController) send(transactionType xact.TransactionType, address uint32, receiverId int,
+	sendDataSize uint32) xact.Transaction {
+	transaction := xact.Transaction{
+		TransactionType: transactionType,
+		Address:         address,
+		SendDataSize:    sendDataSize,
+		SenderId:        cc.id,
+		ReceiverId:      receiverId,
+		RequesterId:     cc.id,
+	}
+	cc.network.Send(transaction)
+	return transaction
+}
+
+func (cc *DirectoryMesiCacheController) invalidateCache(address uint32, absoluteIndex int) {
+	cc.cacheStates[absoluteIndex] = mesiInvalid
+	cc.cache.Evict(address)
+}
+
+func (cc *DirectoryMesiCacheController) UpdateAccessStats(address uint32) {
+	index := cc.cache.GetIndexInArray(address)
+	switch cc.cacheStates[index] {
+	case mesiExclusive, mesiModified:
+		cc.stats.NumAccessesToPrivateData++
+	case mesiShared:
+		cc.stats.NumAccessesToSharedData++
+	default:
+		panic(cc.newError(nil, "accessed cache line is not valid"))
+	}
+}
@@ -1,8 +1,6 @@
 package cache
 
 import (
-	"fmt"
-
 	"github.com/chriskheng/cs4223-assignment2/coherence/components/bus"
 	"github.com/chriskheng/cs4223-assignment2/coherence/components/xact"
 )
@@ -23,6 +21,19 @@ const (
 	DragonSharedModified
 )
 
+func (c DragonCacheState) String() string {
+	return [...]string{"Modified", "Exclusive", "SharedClean", "SharedModified"}[c]
+}
+
+func (c DragonCacheState) lineState() LineState {
+	return LineState{
+		Name:        c.String(),
+		IsValid:     true,
+		IsExclusive: c == DragonModified || c == DragonExclusive,
+		IsOwner:     c == DragonSharedModified,
+	}
+}
+
 type RequestTypes int
 
 const (
@@ -30,9 +41,10 @@ const (
 	DragonRequestWrite
 )
 
-func NewDragonCache(id int, bus *bus.Bus, blockSize, associativity, cacheSize int) *DragonCacheController {
+func NewDragonCache(id int, bus *bus.Bus, blockSize, associativity, cacheSize int,
+	replacement ReplacementConfig) *DragonCacheController {
 	dragonCC := &DragonCacheController{
-		BaseCacheController: NewBaseCache(id, bus, blockSize, associativity, cacheSize),
+		BaseCacheController: NewBaseCache(id, bus, blockSize, associativity, cacheSize, replacement),
 	}
 	dragonCC.RegisterUpdateAccessStatsCallback(dragonCC.UpdateAccessStats)
 
@@ -40,8 +52,9 @@ func NewDragonCache(id int, bus *bus.Bus, blockSize, associativity, cacheSize in
 	for i := range dragonCC.cacheStates {
 		dragonCC.cacheStates[i] = DragonModified
 	}
+	dragonCC.getLineState = func(index int) LineState { return dragonCC.cacheStates[index].lineState() }
 
-	bus.RegisterSnoopingCallBack(dragonCC.OnSnoop)
+	dragonCC.registerOnBus(dragonCC.OnSnoop, dragonCC.BackInvalidate)
 	return dragonCC
 }
 
@@ -53,7 +66,7 @@ func (cc *DragonCacheController) RequestRead(address uint32, callback func()) {
 	} else {
 		cc.state = RequestForBus
 		cc.requestType = DragonRequestRead
-		cc.stats.NumCacheMisses++
+		cc.isMiss = true
 
 		busReadXact := xact.Transaction{
 			TransactionType:   xact.BusRead,
@@ -79,7 +92,7 @@ func (cc *DragonCacheController) RequestRead(address uint32, callback func()) {
 }
 
 func (cc *DragonCacheController) RequestWrite(address uint32, callback func()) {
-	cc.prepareForRequest(address, callback)
+	cc.prepareForWrite(address, callback)
 
 	if cc.cache.Contain(address) {
 		index := cc.cache.GetIndexInArray(address)
@@ -100,12 +113,12 @@ func (cc *DragonCacheController) RequestWrite(address uint32, callback func()) {
 		case DragonModified:
 			cc.state = CacheHit
 		default:
-			panic(fmt.Sprintf("cache state is in %d when cache data structure contains the address", state))
+			panic(cc.newError(nil, "cache line is in unknown state %d", state))
 		}
 	} else {
 		cc.state = RequestForBus
 		cc.requestType = DragonRequestWrite
-		cc.stats.NumCacheMisses++
+		cc.isMiss = true
 		busReadXact := xact.Transaction{
 			TransactionType:   xact.BusRead,
 			Address:           address,
@@ -130,6 +143,11 @@ func (cc *DragonCacheController) RequestWrite(address uint32, callback func()) {
 }
 
 func (cc *DragonCacheController) OnSnoop(transaction xact.Transaction) {
+	if !cc.isOwnTransaction(transaction) {
+		cc.handleSnoopOtherCases(transaction)
+		return
+	}
+
 	switch cc.state {
 	case WaitForEvictWriteBack:
 		cc.handleSnoopWaitForEvictWriteBack(transaction)
@@ -150,7 +168,7 @@ func (cc *DragonCacheController) handleSnoopWaitForEvictWriteBack(transaction xa
 	switch transaction.TransactionType {
 	case xact.MemWriteDone:
 		if transaction.Address != cc.currentTransaction.Address {
-			panic("address evicted for write back is not the same as the address received for memwritedone")
+			panic(cc.newError(&transaction, "MemWriteDone is not for the evicted block"))
 		}
 
 		cc.transactionToSendWhenReplying = cc.xactToIssueAfterEvictWriteBack
@@ -159,16 +177,15 @@ func (cc *DragonCacheController) handleSnoopWaitForEvictWriteBack(transaction xa
 		cc.needToReply = true
 		cc.state = WaitForRequestToComplete
 	default:
-		panic(fmt.Sprintf("Xact of type %d is received when cache controller is waiting for evict write back",
-			transaction.TransactionType))
+		panic(cc.newError(&transaction, "unexpected transaction while waiting for the write back of the evicted block"))
 	}
 }
 
 func (cc *DragonCacheController) handleSnoopWaitForRequestToComplete(transaction xact.Transaction) {
-	hasCopy := cc.bus.CheckHasCopy(cc.currentTransaction.Address)
-
 	if transaction.SenderId == cc.id {
-		if cc.currentTransaction.TransactionType == xact.BusUpd {
+		switch cc.currentTransaction.TransactionType {
+		case xact.BusUpd:
+			hasCopy := cc.bus.CheckHasCopy(cc.currentTransaction.Address)
 			cc.state = CacheHit
 			absoluteIndex := cc.cache.GetIndexInArray(cc.currentTransaction.Address)
 			if hasCopy {
@@ -176,50 +193,54 @@ func (cc *DragonCacheController) handleSnoopWaitForRequestToComplete(transaction
 			} else {
 				cc.cacheStates[absoluteIndex] = DragonModified
 			}
+		case xact.BusRead:
+			cc.insertRequestedLine()
 		}
 		return
 	}
 
 	if !cc.cache.isSamePrefix(transaction.Address, cc.currentTransaction.Address) {
-		panic("prefix of address received by cache controller is different than the prefix of the requested address while waiting for read to complete")
+		panic(cc.newError(&transaction, "reply is not for the requested block"))
 	}
 
+	switch transaction.TransactionType {
+	case xact.Flush:
+		// Sender must be other cache
+		cc.state = WaitForWriteBack
+	case xact.MemReadDone:
+		cc.checkIfNeedToSendBusUpd()
+	default:
+		panic(cc.newError(&transaction, "unexpected reply to %s", cc.currentTransaction.TransactionType))
+	}
+}
+
+// The line is inserted when the BusRead is snooped, so that the requests of other caches snooped before the block is
+// received see it in the state it ends up in.
+func (cc *DragonCacheController) insertRequestedLine() {
+	hasCopy := cc.bus.CheckHasCopy(cc.currentTransaction.Address)
 	_, _, absoluteIndex := cc.cache.Insert(cc.currentTransaction.Address)
 
-	switch cc.currentTransaction.TransactionType {
-	case xact.BusRead:
-		if hasCopy {
-			if cc.requestType == DragonRequestRead {
-				cc.cacheStates[absoluteIndex] = DragonSharedClean
-			} else {
-				cc.cacheStates[absoluteIndex] = DragonSharedModified
-				cc.needToSendBusUpdAfterWriteBack = true
-			}
-		} else {
-			if cc.requestType == DragonRequestRead {
-				cc.cacheStates[absoluteIndex] = DragonExclusive
-			} else {
-				cc.cacheStates[absoluteIndex] = DragonModified
-			}
+	if hasCopy {
+		// The block stays SharedClean on a write until its BusUpd makes it SharedModified, since the cache which
+		// supplied it is SharedModified until then.
+		cc.cacheStates[absoluteIndex] = DragonSharedClean
+		if cc.requestType == DragonRequestWrite {
+			cc.needToSendBusUpdAfterWriteBack = true
 		}
-
-		switch transaction.TransactionType {
-		case xact.Flush:
-			// Sender must be other cache
-			cc.state = WaitForWriteBack
-		case xact.MemReadDone:
-			cc.checkIfNeedToSendBusUpd()
-		default:
-			panic(fmt.Sprintf("transaction of type %d was received when cache controller is waiting for BusRead result", transaction.TransactionType))
+	} else {
+		if cc.requestType == DragonRequestRead {
+			cc.cacheStates[absoluteIndex] = DragonExclusive
+		} else {
+			cc.cacheStates[absoluteIndex] = DragonModified
 		}
 	}
 }
 
 func (cc *DragonCacheController) handleSnoopWriteBack(transaction xact.Transaction) {
 	if transaction.TransactionType != xact.MemWriteDone {
-		panic(fmt.Sprintf("transaction of type %d is received when cache controller %d is waiting for writeback, sender id: %d", transaction.TransactionType, cc.id, transaction.SenderId))
+		panic(cc.newError(&transaction, "unexpected transaction while waiting for the write back of the flushed block"))
 	} else if !cc.cache.isSamePrefix(transaction.Address, cc.currentTransaction.Address) {
-		panic("tag of address written is not equal to the tag of address requested by cache controller")
+		panic(cc.newError(&transaction, "write back is not for the requested block"))
 	}
 	cc.checkIfNeedToSendBusUpd()
 }
@@ -264,19 +285,46 @@ func (cc *DragonCacheController) handleSnoopOtherCases(transaction xact.Transact
 			cc.needToReply = true
 			cc.cacheStates[absoluteIndex] = DragonSharedModified
 		default:
-			panic("handleSnoopOtherCases BusRead undefined cacheStates")
+			panic(cc.newError(&transaction, "cache line is in unknown state %d", cc.cacheStates[absoluteIndex]))
 		}
 	case xact.BusUpd:
 		switch cc.cacheStates[absoluteIndex] {
 		case DragonSharedClean, DragonSharedModified:
 			cc.cacheStates[absoluteIndex] = DragonSharedClean
 		default:
-			panic(fmt.Sprintf("busUpd is received when cache line is in %d state",
-				cc.cacheStates[absoluteIndex]))
+			panic(cc.newError(&transaction, "unexpected snooped transaction"))
 		}
 	}
 }
 
+// Invalidate the cache line of the given address because the inclusive L2 cache evicts it. An update of the line
+// waiting for the bus becomes a write miss since the block has to be read again.
+func (cc *DragonCacheController) BackInvalidate(address uint32) (bool, bool) {
+	if !cc.cache.Contain(address) {
+		return false, false
+	}
+
+	state := cc.cacheStates[cc.cache.GetIndexInArray(address)]
+	isDirty := state == DragonModified || state == DragonSharedModified
+	cc.cache.Evict(address)
+
+	isWaitingToUpdate := cc.state == WaitForBus &&
+		cc.currentTransaction.TransactionType == xact.BusUpd &&
+		cc.cache.isSamePrefix(cc.currentTransaction.Address, address)
+	if isWaitingToUpdate {
+		cc.requestType = DragonRequestWrite
+		cc.currentTransaction = xact.Transaction{
+			TransactionType:   xact.BusRead,
+			Address:           cc.currentTransaction.Address,
+			RequestedDataSize: cc.cache.blockSizeInWords,
+			SenderId:          cc.id,
+		}
+	} else {
+		cc.onBackInvalidate(address)
+	}
+	return true, isDirty
+}
+
 func (cc *DragonCacheController) UpdateAccessStats(address uint32) {
 	index := cc.cache.GetIndexInArray(address)
 	switch cc.cacheStates[index] {
@@ -285,6 +333,6 @@ func (cc *DragonCacheController) UpdateAccessStats(address uint32) {
 	case DragonSharedModified, DragonSharedClean:
 		cc.stats.NumAccessesToSharedData++
 	default:
-		panic(fmt.Sprintf("Cache line is in %d state while updating access stats", cc.cacheStates[index]))
+		panic(cc.newError(nil, "accessed cache line is not valid"))
 	}
 }
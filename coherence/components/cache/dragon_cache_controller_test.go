@@ -0,0 +1,193 @@
+package cache_test
+
+import (
+	"testing"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/bus"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/cache"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/xact"
+	"github.com/chriskheng/cs4223-assignment2/coherence/testutils/scenario"
+)
+
+func newDragonCache(id int, bus *bus.Bus, blockSize, associativity, cacheSize int,
+	replacement cache.ReplacementConfig) cache.CacheController {
+	return cache.NewDragonCache(id, bus, blockSize, associativity, cacheSize, replacement)
+}
+
+// Dragon has no Invalid state: the blocks which are not cached are Invalid in the scenarios.
+var dragonTests = map[string]scenario.Scenario{
+	"Exclusive on a read miss without copies": {
+		NumCores: 2,
+		Accesses: []scenario.Access{{Core: 0, Op: scenario.Load, Address: 0x0, Done: 110}},
+		States:   []scenario.State{{Core: 0, Address: 0x0, Name: "Exclusive"}},
+		Transactions: []scenario.Transaction{
+			{Type: xact.BusRead, SenderId: 0, Address: 0x0},
+			{Type: xact.MemReadDone, SenderId: memoryId, Address: 0x0},
+		},
+	},
+	"SharedClean on a read miss, the Exclusive copy becomes SharedClean": {
+		NumCores: 2,
+		Accesses: []scenario.Access{
+			{Core: 0, Op: scenario.Load, Address: 0x0},
+			{Cycle: 200, Core: 1, Op: scenario.Load, Address: 0x0, Done: 310},
+		},
+		States: []scenario.State{
+			{Core: 0, Address: 0x0, Name: "SharedClean"},
+			{Core: 1, Address: 0x0, Name: "SharedClean"},
+		},
+		Transactions: []scenario.Transaction{
+			{Type: xact.BusRead, SenderId: 0, Address: 0x0},
+			{Type: xact.MemReadDone, SenderId: memoryId, Address: 0x0},
+			{Type: xact.BusRead, SenderId: 1, Address: 0x0},
+			{Type: xact.MemReadDone, SenderId: memoryId, Address: 0x0},
+		},
+	},
+	"Modified on a write miss without copies": {
+		NumCores: 2,
+		Accesses: []scenario.Access{{Core: 0, Op: scenario.Store, Address: 0x0, Done: 110}},
+		States:   []scenario.State{{Core: 0, Address: 0x0, Name: "Modified"}},
+		Transactions: []scenario.Transaction{
+			{Type: xact.BusRead, SenderId: 0, Address: 0x0},
+			{Type: xact.MemReadDone, SenderId: memoryId, Address: 0x0},
+		},
+	},
+	"SharedModified on a write miss with copies, the block is updated after it is read": {
+		NumCores: 2,
+		Accesses: []scenario.Access{
+			{Core: 0, Op: scenario.Load, Address: 0x0},
+			{Cycle: 200, Core: 1, Op: scenario.Store, Address: 0x0, Done: 319},
+		},
+		States: []scenario.State{
+			{Core: 0, Address: 0x0, Name: "SharedClean"},
+			{Core: 1, Address: 0x0, Name: "SharedModified"},
+		},
+		Transactions: []scenario.Transaction{
+			{Type: xact.BusRead, SenderId: 0, Address: 0x0},
+			{Type: xact.MemReadDone, SenderId: memoryId, Address: 0x0},
+			{Type: xact.BusRead, SenderId: 1, Address: 0x0},
+			{Type: xact.MemReadDone, SenderId: memoryId, Address: 0x0},
+			{Type: xact.BusUpd, SenderId: 1, Address: 0x0},
+		},
+	},
+	"Exclusive to Modified on a write hit without transaction": {
+		NumCores: 2,
+		Accesses: []scenario.Access{
+			{Core: 0, Op: scenario.Load, Address: 0x0},
+			{Core: 0, Op: scenario.Store, Address: 0x0, Done: 111},
+		},
+		States: []scenario.State{{Core: 0, Address: 0x0, Name: "Modified"}},
+		Transactions: []scenario.Transaction{
+			{Type: xact.BusRead, SenderId: 0, Address: 0x0},
+			{Type: xact.MemReadDone, SenderId: memoryId, Address: 0x0},
+		},
+	},
+	"SharedClean to SharedModified on a write hit, the other copy stays SharedClean": {
+		NumCores: 2,
+		Accesses: []scenario.Access{
+			{Core: 0, Op: scenario.Load, Address: 0x0},
+			{Cycle: 200, Core: 1, Op: scenario.Load, Address: 0x0},
+			{Cycle: 400, Core: 0, Op: scenario.Store, Address: 0x0, Done: 410},
+		},
+		States: []scenario.State{
+			{Core: 0, Address: 0x0, Name: "SharedModified"},
+			{Core: 1, Address: 0x0, Name: "SharedClean"},
+		},
+		Transactions: []scenario.Transaction{
+			{Type: xact.BusRead, SenderId: 0, Address: 0x0},
+			{Type: xact.MemReadDone, SenderId: memoryId, Address: 0x0},
+			{Type: xact.BusRead, SenderId: 1, Address: 0x0},
+			{Type: xact.MemReadDone, SenderId: memoryId, Address: 0x0},
+			{Type: xact.BusUpd, SenderId: 0, Address: 0x0},
+		},
+	},
+	"SharedModified to SharedClean on BusUpd, the writer becomes SharedModified": {
+		NumCores: 2,
+		Accesses: []scenario.Access{
+			{Core: 0, Op: scenario.Load, Address: 0x0},
+			{Cycle: 200, Core: 1, Op: scenario.Load, Address: 0x0},
+			{Cycle: 400, Core: 0, Op: scenario.Store, Address: 0x0},
+			{Cycle: 600, Core: 1, Op: scenario.Store, Address: 0x0, Done: 610},
+		},
+		States: []scenario.State{
+			{Core: 0, Address: 0x0, Name: "SharedClean"},
+			{Core: 1, Address: 0x0, Name: "SharedModified"},
+		},
+		Transactions: []scenario.Transaction{
+			{Type: xact.BusRead, SenderId: 0, Address: 0x0},
+			{Type: xact.MemReadDone, SenderId: memoryId, Address: 0x0},
+			{Type: xact.BusRead, SenderId: 1, Address: 0x0},
+			{Type: xact.MemReadDone, SenderId: memoryId, Address: 0x0},
+			{Type: xact.BusUpd, SenderId: 0, Address: 0x0},
+			{Type: xact.BusUpd, SenderId: 1, Address: 0x0},
+		},
+	},
+	"Modified to SharedModified on BusRead, the block is supplied and written back": {
+		NumCores: 2,
+		Accesses: []scenario.Access{
+			{Core: 0, Op: scenario.Store, Address: 0x0},
+			{Cycle: 200, Core: 1, Op: scenario.Load, Address: 0x0, Done: 311},
+		},
+		States: []scenario.State{
+			{Core: 0, Address: 0x0, Name: "SharedModified"},
+			{Core: 1, Address: 0x0, Name: "SharedClean"},
+		},
+		Transactions: []scenario.Transaction{
+			{Type: xact.BusRead, SenderId: 0, Address: 0x0},
+			{Type: xact.MemReadDone, SenderId: memoryId, Address: 0x0},
+			{Type: xact.BusRead, SenderId: 1, Address: 0x0},
+			{Type: xact.Flush, SenderId: 0, Address: 0x0},
+			{Type: xact.MemWriteDone, SenderId: memoryId, Address: 0x0},
+		},
+	},
+	"Modified is written back on eviction before the miss": {
+		NumCores: 1,
+		Accesses: []scenario.Access{
+			{Core: 0, Op: scenario.Store, Address: 0x0},
+			{Core: 0, Op: scenario.Load, Address: 0x20},
+			{Core: 0, Op: scenario.Load, Address: 0x40, Done: 441},
+		},
+		States: []scenario.State{
+			{Core: 0, Address: 0x0, Name: "Invalid"},
+			{Core: 0, Address: 0x20, Name: "Exclusive"},
+			{Core: 0, Address: 0x40, Name: "Exclusive"},
+		},
+		Transactions: []scenario.Transaction{
+			{Type: xact.BusRead, SenderId: 0, Address: 0x0},
+			{Type: xact.MemReadDone, SenderId: memoryId, Address: 0x0},
+			{Type: xact.BusRead, SenderId: 0, Address: 0x20},
+			{Type: xact.MemReadDone, SenderId: memoryId, Address: 0x20},
+			{Type: xact.Flush, SenderId: 0, Address: 0x0},
+			{Type: xact.MemWriteDone, SenderId: memoryId, Address: 0x0},
+			{Type: xact.BusRead, SenderId: 0, Address: 0x40},
+			{Type: xact.MemReadDone, SenderId: memoryId, Address: 0x40},
+		},
+	},
+	"Split bus: IM_D to IM_D_SM on a BusRead snooped before the block, which is flushed once the write is done": {
+		NumCores: 2,
+		Accesses: []scenario.Access{
+			{Core: 0, Op: scenario.Store, Address: 0x0, Done: 110},
+			{Cycle: 1, Core: 1, Op: scenario.Load, Address: 0x0, Done: 219},
+		},
+		States: []scenario.State{
+			{Cycle: 1, Core: 0, Address: 0x0, Name: "IM_D"},
+			{Cycle: 3, Core: 0, Address: 0x0, Name: "IM_D_SM"},
+			{Cycle: 3, Core: 1, Address: 0x0, Name: "ISC_D"},
+			{Core: 0, Address: 0x0, Name: "SharedModified"},
+			{Core: 1, Address: 0x0, Name: "SharedClean"},
+		},
+		Transactions: []scenario.Transaction{
+			{Type: xact.BusRead, SenderId: 0, Address: 0x0},
+			{Type: xact.BusRead, SenderId: 1, Address: 0x0},
+			{Type: xact.MemReadDone, SenderId: memoryId, Address: 0x0},
+			{Type: xact.Flush, SenderId: 0, Address: 0x0},
+			{Type: xact.MemWriteDone, SenderId: memoryId, Address: 0x0},
+		},
+		IsSplitTransaction: true,
+	},
+}
+
+func TestDragonTransitions(t *testing.T) {
+	for name, s := range dragonTests {
+		t.Run(name, func(t *testing.T) { scenario.Run(t, newDragonCache, s) })
+	}
+}
@@ -0,0 +1,326 @@
+package cache
+
+import (
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/bus"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/xact"
+)
+
+// FireflyCacheController simulates the Firefly update protocol. Unlike Dragon, writes to a shared block are written
+// through to memory, so a block is only ever dirty when the cache holds the sole copy of it.
+type FireflyCacheController struct {
+	*BaseCacheController
+	cacheStates                    []fireflyCacheState
+	isWriteMiss                    bool
+	needToSendBusUpdAfterWriteBack bool
+}
+
+type fireflyCacheState int
+
+const (
+	fireflyValidExclusive fireflyCacheState = iota
+	fireflyShared
+	fireflyDirty
+)
+
+func (c fireflyCacheState) String() string {
+	return [...]string{"ValidExclusive", "Shared", "Dirty"}[c]
+}
+
+func (c fireflyCacheState) lineState() LineState {
+	return LineState{
+		Name:        c.String(),
+		IsValid:     true,
+		IsExclusive: c == fireflyValidExclusive || c == fireflyDirty,
+	}
+}
+
+func NewFireflyCache(id int, bus *bus.Bus, blockSize, associativity, cacheSize int,
+	replacement ReplacementConfig) *FireflyCacheController {
+	fireflyCC := &FireflyCacheController{
+		BaseCacheController: NewBaseCache(id, bus, blockSize, associativity, cacheSize, replacement),
+	}
+	fireflyCC.RegisterUpdateAccessStatsCallback(fireflyCC.UpdateAccessStats)
+
+	fireflyCC.cacheStates = make([]fireflyCacheState, len(fireflyCC.cache.cacheArray))
+	for i := range fireflyCC.cacheStates {
+		fireflyCC.cacheStates[i] = fireflyValidExclusive
+	}
+	fireflyCC.getLineState = func(index int) LineState { return fireflyCC.cacheStates[index].lineState() }
+
+	fireflyCC.registerOnBus(fireflyCC.OnSnoop, fireflyCC.BackInvalidate)
+	return fireflyCC
+}
+
+func (cc *FireflyCacheController) RequestRead(address uint32, callback func()) {
+	cc.prepareForRequest(address, callback)
+
+	if cc.cache.Contain(address) {
+		cc.state = CacheHit
+	} else {
+		cc.state = RequestForBus
+		cc.isWriteMiss = false
+		cc.isMiss = true
+		cc.setTransactionForMiss(address)
+	}
+}
+
+func (cc *FireflyCacheController) RequestWrite(address uint32, callback func()) {
+	cc.prepareForWrite(address, callback)
+
+	if cc.cache.Contain(address) {
+		index := cc.cache.GetIndexInArray(address)
+		state := cc.cacheStates[index]
+
+		switch state {
+		case fireflyValidExclusive:
+			cc.state = CacheHit
+			cc.cacheStates[index] = fireflyDirty
+		case fireflyShared:
+			cc.state = RequestForBus
+			cc.currentTransaction = xact.Transaction{
+				TransactionType: xact.BusUpd,
+				Address:         address,
+				SendDataSize:    cc.cache.blockSizeInWords,
+				SenderId:        cc.id,
+			}
+		case fireflyDirty:
+			cc.state = CacheHit
+		default:
+			panic(cc.newError(nil, "cache line is in unknown state %d", state))
+		}
+	} else {
+		cc.state = RequestForBus
+		cc.isWriteMiss = true
+		cc.isMiss = true
+		cc.setTransactionForMiss(address)
+	}
+}
+
+// Only a Dirty block has to be written back to memory before it is evicted, as shared blocks are kept up to date in
+// memory by the write through of every BusUpd.
+func (cc *FireflyCacheController) setTransactionForMiss(address uint32) {
+	busReadXact := xact.Transaction{
+		TransactionType:   xact.BusRead,
+		Address:           address,
+		RequestedDataSize: cc.cache.blockSizeInWords,
+		SenderId:          cc.id,
+	}
+
+	isToBeEvicted, evictedAddress, index := cc.cache.GetAddressToBeEvicted(address)
+	if !isToBeEvicted || cc.cacheStates[index] != fireflyDirty {
+		cc.currentTransaction = busReadXact
+	} else {
+		cc.xactToIssueAfterEvictWriteBack = busReadXact
+		cc.currentTransaction = xact.Transaction{
+			TransactionType: xact.Flush,
+			Address:         evictedAddress,
+			SendDataSize:    cc.cache.blockSizeInWords,
+			SenderId:        cc.id,
+		}
+	}
+}
+
+func (cc *FireflyCacheController) OnSnoop(transaction xact.Transaction) {
+	if !cc.isOwnTransaction(transaction) {
+		cc.handleSnoopOtherCases(transaction)
+		return
+	}
+
+	switch cc.state {
+	case WaitForEvictWriteBack:
+		cc.handleSnoopWaitForEvictWriteBack(transaction)
+	case WaitForRequestToComplete:
+		cc.handleSnoopWaitForRequestToComplete(transaction)
+	case WaitForWriteBack:
+		cc.handleSnoopWriteBack(transaction)
+	default:
+		cc.handleSnoopOtherCases(transaction)
+	}
+}
+
+func (cc *FireflyCacheController) handleSnoopWaitForEvictWriteBack(transaction xact.Transaction) {
+	if transaction.SenderId == cc.id {
+		return
+	}
+
+	switch transaction.TransactionType {
+	case xact.MemWriteDone:
+		if transaction.Address != cc.currentTransaction.Address {
+			panic(cc.newError(&transaction, "MemWriteDone is not for the evicted block"))
+		}
+
+		cc.transactionToSendWhenReplying = cc.xactToIssueAfterEvictWriteBack
+		cc.currentTransaction = cc.xactToIssueAfterEvictWriteBack
+		cc.xactToIssueAfterEvictWriteBack = xact.Transaction{TransactionType: xact.Nil}
+		cc.needToReply = true
+		cc.state = WaitForRequestToComplete
+	default:
+		panic(cc.newError(&transaction, "unexpected transaction while waiting for the write back of the evicted block"))
+	}
+}
+
+func (cc *FireflyCacheController) handleSnoopWaitForRequestToComplete(transaction xact.Transaction) {
+	if transaction.SenderId == cc.id {
+		switch cc.currentTransaction.TransactionType {
+		case xact.BusUpd:
+			hasCopy := cc.bus.CheckHasCopy(cc.currentTransaction.Address)
+			// The update is written through to memory, so the block stays clean. As with Dragon, the write
+			// completes once the update is on the bus, while memory writes it in the background.
+			cc.state = CacheHit
+			absoluteIndex := cc.cache.GetIndexInArray(cc.currentTransaction.Address)
+			if hasCopy {
+				cc.cacheStates[absoluteIndex] = fireflyShared
+			} else {
+				cc.cacheStates[absoluteIndex] = fireflyValidExclusive
+			}
+		case xact.BusRead:
+			cc.insertRequestedLine()
+		}
+		return
+	}
+
+	if !cc.cache.isSamePrefix(transaction.Address, cc.currentTransaction.Address) {
+		panic(cc.newError(&transaction, "reply is not for the requested block"))
+	}
+
+	switch transaction.TransactionType {
+	case xact.Flush:
+		// Sender must be other cache
+		cc.state = WaitForWriteBack
+	case xact.MemReadDone, xact.FlushOpt:
+		cc.checkIfNeedToSendBusUpd()
+	default:
+		panic(cc.newError(&transaction, "unexpected reply to %s", cc.currentTransaction.TransactionType))
+	}
+}
+
+// A write miss loads the block as Dirty when no other cache has it, or else writes it through with a BusUpd once the
+// block is received. The line is inserted when the BusRead is snooped, so that the requests of other caches snooped
+// before the block is received see it in that state.
+func (cc *FireflyCacheController) insertRequestedLine() {
+	hasCopy := cc.bus.CheckHasCopy(cc.currentTransaction.Address)
+	_, _, absoluteIndex := cc.cache.Insert(cc.currentTransaction.Address)
+
+	if hasCopy {
+		cc.cacheStates[absoluteIndex] = fireflyShared
+		cc.needToSendBusUpdAfterWriteBack = cc.isWriteMiss
+	} else if cc.isWriteMiss {
+		cc.cacheStates[absoluteIndex] = fireflyDirty
+	} else {
+		cc.cacheStates[absoluteIndex] = fireflyValidExclusive
+	}
+}
+
+func (cc *FireflyCacheController) handleSnoopWriteBack(transaction xact.Transaction) {
+	if transaction.TransactionType != xact.MemWriteDone {
+		panic(cc.newError(&transaction, "unexpected transaction while waiting for the write back of the flushed block"))
+	} else if !cc.cache.isSamePrefix(transaction.Address, cc.currentTransaction.Address) {
+		panic(cc.newError(&transaction, "write back is not for the requested block"))
+	}
+
+	cc.checkIfNeedToSendBusUpd()
+}
+
+func (cc *FireflyCacheController) checkIfNeedToSendBusUpd() {
+	if cc.needToSendBusUpdAfterWriteBack {
+		cc.state = WaitForRequestToComplete
+		cc.transactionToSendWhenReplying = xact.Transaction{
+			TransactionType: xact.BusUpd,
+			Address:         cc.currentTransaction.Address,
+			SendDataSize:    cc.cache.blockSizeInWords,
+			SenderId:        cc.id,
+		}
+		cc.needToReply = true
+		cc.currentTransaction = cc.transactionToSendWhenReplying
+		cc.needToSendBusUpdAfterWriteBack = false
+	} else {
+		cc.state = CacheHit
+	}
+}
+
+func (cc *FireflyCacheController) handleSnoopOtherCases(transaction xact.Transaction) {
+	if transaction.SenderId == cc.id || !cc.cache.Contain(transaction.Address) {
+		return
+	}
+
+	absoluteIndex := cc.cache.GetIndexInArray(transaction.Address)
+
+	switch transaction.TransactionType {
+	case xact.BusRead:
+		switch cc.cacheStates[absoluteIndex] {
+		case fireflyValidExclusive, fireflyShared:
+			// Caches holding a clean copy supply the block. Only the first reply is sent by the bus.
+			cc.transactionToSendWhenReplying = xact.Transaction{
+				TransactionType: xact.FlushOpt,
+				Address:         transaction.Address,
+				SendDataSize:    transaction.RequestedDataSize,
+				SenderId:        cc.id,
+			}
+		case fireflyDirty:
+			cc.transactionToSendWhenReplying = xact.Transaction{
+				TransactionType: xact.Flush,
+				Address:         transaction.Address,
+				SendDataSize:    transaction.RequestedDataSize,
+				SenderId:        cc.id,
+			}
+		default:
+			panic(cc.newError(&transaction, "unexpected snooped transaction"))
+		}
+		cc.needToReply = true
+		cc.cacheStates[absoluteIndex] = fireflyShared
+
+		// The Dirty block is written back to memory by the Flush above, so there is no need to write it back again
+		// when the cache controller gets the ownership of the bus.
+		isWaitingToFlush := cc.state == WaitForBus &&
+			cc.currentTransaction.TransactionType == xact.Flush &&
+			cc.cache.isSamePrefix(cc.currentTransaction.Address, transaction.Address)
+		if isWaitingToFlush {
+			cc.currentTransaction = cc.xactToIssueAfterEvictWriteBack
+			cc.xactToIssueAfterEvictWriteBack = xact.Transaction{TransactionType: xact.Nil}
+		}
+	case xact.BusUpd:
+		if cc.cacheStates[absoluteIndex] != fireflyShared {
+			panic(cc.newError(&transaction, "unexpected snooped transaction"))
+		}
+	}
+}
+
+// Invalidate the cache line of the given address because the inclusive L2 cache evicts it. An update of the line
+// waiting for the bus becomes a write miss since the block has to be read again.
+func (cc *FireflyCacheController) BackInvalidate(address uint32) (bool, bool) {
+	if !cc.cache.Contain(address) {
+		return false, false
+	}
+
+	state := cc.cacheStates[cc.cache.GetIndexInArray(address)]
+	isDirty := state == fireflyDirty
+	cc.cache.Evict(address)
+
+	isWaitingToUpdate := cc.state == WaitForBus &&
+		cc.currentTransaction.TransactionType == xact.BusUpd &&
+		cc.cache.isSamePrefix(cc.currentTransaction.Address, address)
+	if isWaitingToUpdate {
+		cc.isWriteMiss = true
+		cc.currentTransaction = xact.Transaction{
+			TransactionType:   xact.BusRead,
+			Address:           cc.currentTransaction.Address,
+			RequestedDataSize: cc.cache.blockSizeInWords,
+			SenderId:          cc.id,
+		}
+	} else {
+		cc.onBackInvalidate(address)
+	}
+	return true, isDirty
+}
+
+func (cc *FireflyCacheController) UpdateAccessStats(address uint32) {
+	index := cc.cache.GetIndexInArray(address)
+	switch cc.cacheStates[index] {
+	case fireflyValidExclusive, fireflyDirty:
+		cc.stats.NumAccessesToPrivateData++
+	case fireflyShared:
+		cc.stats.NumAccessesToSharedData++
+	default:
+		panic(cc.newError(nil, "accessed cache line is not valid"))
+	}
+}
@@ -0,0 +1,53 @@
+package cache_test
+
+import (
+	"testing"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/bus"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/cache"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/xact"
+	"github.com/chriskheng/cs4223-assignment2/coherence/testutils/scenario"
+)
+
+func newFireflyCache(id int, bus *bus.Bus, blockSize, associativity, cacheSize int,
+	replacement cache.ReplacementConfig) cache.CacheController {
+	return cache.NewFireflyCache(id, bus, blockSize, associativity, cacheSize, replacement)
+}
+
+var fireflyTests = map[string]scenario.Scenario{
+	"Dirty on a write miss without copies": {
+		NumCores: 2,
+		Accesses: []scenario.Access{{Core: 0, Op: scenario.Store, Address: 0x0, Done: 110}},
+		States:   []scenario.State{{Core: 0, Address: 0x0, Name: "Dirty"}},
+		Transactions: []scenario.Transaction{
+			{Type: xact.BusRead, SenderId: 0, Address: 0x0},
+			{Type: xact.MemReadDone, SenderId: memoryId, Address: 0x0},
+		},
+	},
+	// Memory writes the update in the background, so the write takes as long as with Dragon.
+	"Shared stays Shared on a write hit, the update is written through once it is on the bus": {
+		NumCores: 2,
+		Accesses: []scenario.Access{
+			{Core: 0, Op: scenario.Load, Address: 0x0},
+			{Cycle: 200, Core: 1, Op: scenario.Load, Address: 0x0},
+			{Cycle: 400, Core: 0, Op: scenario.Store, Address: 0x0, Done: 410},
+		},
+		States: []scenario.State{
+			{Core: 0, Address: 0x0, Name: "Shared"},
+			{Core: 1, Address: 0x0, Name: "Shared"},
+		},
+		Transactions: []scenario.Transaction{
+			{Type: xact.BusRead, SenderId: 0, Address: 0x0},
+			{Type: xact.MemReadDone, SenderId: memoryId, Address: 0x0},
+			{Type: xact.BusRead, SenderId: 1, Address: 0x0},
+			{Type: xact.FlushOpt, SenderId: 0, Address: 0x0},
+			{Type: xact.BusUpd, SenderId: 0, Address: 0x0},
+		},
+	},
+}
+
+func TestFireflyTransitions(t *testing.T) {
+	for name, s := range fireflyTests {
+		t.Run(name, func(t *testing.T) { scenario.Run(t, newFireflyCache, s) })
+	}
+}
@@ -1,8 +1,6 @@
 package cache
 
 import (
-	"fmt"
-
 	"github.com/chriskheng/cs4223-assignment2/coherence/components/bus"
 	"github.com/chriskheng/cs4223-assignment2/coherence/components/xact"
 )
@@ -21,13 +19,22 @@ const (
 	mesiShared
 )
 
-func (c mesiCacheState) string() string {
+func (c mesiCacheState) String() string {
 	return [...]string{"Invalid", "Modified", "Exclusive", "Shared"}[c]
 }
 
-func NewMesiCache(id int, bus *bus.Bus, blockSize, associativity, cacheSize int) *MesiCacheController {
+func (c mesiCacheState) lineState() LineState {
+	return LineState{
+		Name:        c.String(),
+		IsValid:     c != mesiInvalid,
+		IsExclusive: c == mesiModified || c == mesiExclusive,
+	}
+}
+
+func NewMesiCache(id int, bus *bus.Bus, blockSize, associativity, cacheSize int,
+	replacement ReplacementConfig) *MesiCacheController {
 	mesiCC := &MesiCacheController{
-		BaseCacheController: NewBaseCache(id, bus, blockSize, associativity, cacheSize),
+		BaseCacheController: NewBaseCache(id, bus, blockSize, associativity, cacheSize, replacement),
 	}
 	mesiCC.RegisterUpdateAccessStatsCallback(mesiCC.UpdateAccessStats)
 
@@ -35,8 +42,9 @@ func NewMesiCache(id int, bus *bus.Bus, blockSize, associativity, cacheSize int)
 	for i := range mesiCC.cacheStates {
 		mesiCC.cacheStates[i] = mesiInvalid
 	}
+	mesiCC.getLineState = func(index int) LineState { return mesiCC.cacheStates[index].lineState() }
 
-	bus.RegisterSnoopingCallBack(mesiCC.OnSnoop)
+	mesiCC.registerOnBus(mesiCC.OnSnoop, mesiCC.BackInvalidate)
 	return mesiCC
 }
 
@@ -47,7 +55,7 @@ func (cc *MesiCacheController) RequestRead(address uint32, callback func()) {
 		cc.state = CacheHit
 	} else {
 		cc.state = RequestForBus
-		cc.stats.NumCacheMisses++
+		cc.isMiss = true
 		busReadXact := xact.Transaction{
 			TransactionType:   xact.BusRead,
 			Address:           address,
@@ -71,7 +79,7 @@ func (cc *MesiCacheController) RequestRead(address uint32, callback func()) {
 }
 
 func (cc *MesiCacheController) RequestWrite(address uint32, callback func()) {
-	cc.prepareForRequest(address, callback)
+	cc.prepareForWrite(address, callback)
 
 	if cc.cache.Contain(address) {
 		index := cc.cache.GetIndexInArray(address)
@@ -90,11 +98,11 @@ func (cc *MesiCacheController) RequestWrite(address uint32, callback func()) {
 				SenderId:        cc.id,
 			}
 		default:
-			panic(fmt.Sprintf("cache state is in %d when cache data structure contains the address", state))
+			panic(cc.newError(nil, "cache line is in unknown state %d", state))
 		}
 	} else {
 		cc.state = RequestForBus
-		cc.stats.NumCacheMisses++
+		cc.isMiss = true
 		busReadXXact := xact.Transaction{
 			TransactionType:   xact.BusReadX,
 			Address:           address,
@@ -118,6 +126,11 @@ func (cc *MesiCacheController) RequestWrite(address uint32, callback func()) {
 }
 
 func (cc *MesiCacheController) OnSnoop(transaction xact.Transaction) {
+	if !cc.isOwnTransaction(transaction) {
+		cc.handleSnoopOtherCases(transaction)
+		return
+	}
+
 	switch cc.state {
 	case WaitForEvictWriteBack:
 		cc.handleSnoopWaitForEvictWriteBack(transaction)
@@ -138,7 +151,7 @@ func (cc *MesiCacheController) handleSnoopWaitForEvictWriteBack(transaction xact
 	switch transaction.TransactionType {
 	case xact.MemWriteDone:
 		if transaction.Address != cc.currentTransaction.Address {
-			panic("address evicted for write back is not the same as the address received for memwritedone")
+			panic(cc.newError(&transaction, "MemWriteDone is not for the evicted block"))
 		}
 
 		cc.transactionToSendWhenReplying = cc.xactToIssueAfterEvictWriteBack
@@ -147,8 +160,7 @@ func (cc *MesiCacheController) handleSnoopWaitForEvictWriteBack(transaction xact
 		cc.needToReply = true
 		cc.state = WaitForRequestToComplete
 	default:
-		panic(fmt.Sprintf("Xact of type %d is received when cache controller is waiting for evict write back",
-			transaction.TransactionType))
+		panic(cc.newError(&transaction, "unexpected transaction while waiting for the write back of the evicted block"))
 	}
 }
 
@@ -157,12 +169,12 @@ func (cc *MesiCacheController) handleSnoopWaitForRequestToComplete(transaction x
 	if transaction.SenderId == cc.id && transaction.TransactionType == xact.BusUpgr {
 		// Should have the same address (since the message is from the current sender itself (loopback))
 		if transaction.Address != cc.currentTransaction.Address {
-			panic("cache controller receives a different address than the address in BusUpgr")
+			panic(cc.newError(&transaction, "BusUpgr is not for the requested block"))
 		}
 		cc.state = CacheHit
 		index := cc.cache.GetIndexInArray(cc.currentTransaction.Address)
 		if index == -1 {
-			panic(fmt.Sprintf("index returned is -1, current iter %d", cc.iter))
+			panic(cc.newError(&transaction, "upgraded block is not in the cache"))
 		}
 
 		cc.cacheStates[index] = mesiModified
@@ -170,15 +182,27 @@ func (cc *MesiCacheController) handleSnoopWaitForRequestToComplete(transaction x
 	}
 
 	if transaction.SenderId == cc.id {
+		cc.insertRequestedLine()
 		return
 	}
 
 	// only for reply cases
 	if !cc.cache.isSamePrefix(transaction.Address, cc.currentTransaction.Address) {
-		fmt.Printf("iter: %d\n", cc.iter)
-		panic("Prefix of address received by cache controller is different than the prefix of the requested address while waiting for read to complete")
+		panic(cc.newError(&transaction, "reply is not for the requested block"))
 	}
 
+	if transaction.TransactionType == xact.Flush {
+		cc.state = WaitForWriteBack
+	} else if transaction.TransactionType == xact.MemReadDone || transaction.TransactionType == xact.FlushOpt {
+		cc.state = CacheHit
+	} else {
+		panic(cc.newError(&transaction, "unexpected reply to %s", cc.currentTransaction.TransactionType))
+	}
+}
+
+// The line is inserted when the read request is snooped, in the state it ends up in, so that the requests of other
+// caches snooped before the block is received see it in that state.
+func (cc *MesiCacheController) insertRequestedLine() {
 	hasCopy := cc.bus.CheckHasCopy(cc.currentTransaction.Address)
 	_, _, absoluteIndex := cc.cache.Insert(cc.currentTransaction.Address)
 
@@ -189,32 +213,17 @@ func (cc *MesiCacheController) handleSnoopWaitForRequestToComplete(transaction x
 		} else {
 			cc.cacheStates[absoluteIndex] = mesiExclusive
 		}
-
-		if transaction.TransactionType == xact.Flush {
-			cc.state = WaitForWriteBack
-		} else if transaction.TransactionType == xact.MemReadDone || transaction.TransactionType == xact.FlushOpt {
-			cc.state = CacheHit
-		} else {
-			panic(fmt.Sprintf("transaction of type %d was received when cache controller is waiting for BusRead result", transaction.TransactionType))
-		}
 	case xact.BusReadX:
 		cc.cacheStates[absoluteIndex] = mesiModified
-		if transaction.TransactionType == xact.Flush {
-			cc.state = WaitForWriteBack
-		} else if transaction.TransactionType == xact.MemReadDone || transaction.TransactionType == xact.FlushOpt {
-			cc.state = CacheHit
-		} else {
-			panic(fmt.Sprintf("transaction of type %d was received when cache controller is waiting for BusReadX result", transaction.TransactionType))
-		}
 	}
 }
 
 // write to memory
 func (cc *MesiCacheController) handleSnoopWriteBack(transaction xact.Transaction) {
 	if transaction.TransactionType != xact.MemWriteDone {
-		panic(fmt.Sprintf("transaction of type %d is received when cache controller %d is waiting for writeback, sender id: %d", transaction.TransactionType, cc.id, transaction.SenderId))
+		panic(cc.newError(&transaction, "unexpected transaction while waiting for the write back of the flushed block"))
 	} else if !cc.cache.isSamePrefix(transaction.Address, cc.currentTransaction.Address) {
-		panic("tag of address written is not equal to the tag of address requested by cache controller")
+		panic(cc.newError(&transaction, "write back is not for the requested block"))
 	}
 
 	cc.state = CacheHit
@@ -256,7 +265,7 @@ func (cc *MesiCacheController) handleSnoopOtherCases(transaction xact.Transactio
 				cc.xactToIssueAfterEvictWriteBack = xact.Transaction{TransactionType: xact.Nil}
 			}
 		default:
-			panic(getPanicMsgMesiCacheState(transaction, mesiModified))
+			panic(cc.newError(&transaction, "unexpected snooped transaction"))
 		}
 	case mesiExclusive:
 		switch transaction.TransactionType {
@@ -274,7 +283,7 @@ func (cc *MesiCacheController) handleSnoopOtherCases(transaction xact.Transactio
 				cc.invalidateCache(transaction.Address, absoluteIndex)
 			}
 		default:
-			panic(getPanicMsgMesiCacheState(transaction, mesiExclusive))
+			panic(cc.newError(&transaction, "unexpected snooped transaction"))
 		}
 	case mesiShared:
 		switch transaction.TransactionType {
@@ -290,18 +299,27 @@ func (cc *MesiCacheController) handleSnoopOtherCases(transaction xact.Transactio
 			}
 			cc.invalidateCache(transaction.Address, absoluteIndex)
 		case xact.Flush:
-			panic(getPanicMsgMesiCacheState(transaction, mesiShared))
+			panic(cc.newError(&transaction, "unexpected snooped transaction"))
 		}
 	}
 }
 
-func (cc *MesiCacheController) invalidateCache(address uint32, absoluteIndex int) {
-	cc.cacheStates[absoluteIndex] = mesiInvalid
-	cc.cache.Evict(address)
+// Invalidate the cache line of the given address because the inclusive L2 cache evicts it.
+func (cc *MesiCacheController) BackInvalidate(address uint32) (bool, bool) {
+	if !cc.cache.Contain(address) {
+		return false, false
+	}
+
+	index := cc.cache.GetIndexInArray(address)
+	isDirty := cc.cacheStates[index] == mesiModified
+	cc.invalidateCache(address, index)
+	cc.onBackInvalidate(address)
+	return true, isDirty
 }
 
-func getPanicMsgMesiCacheState(transaction xact.Transaction, state mesiCacheState) string {
-	return fmt.Sprintf("xact of type %d is received when cache is in %s state", transaction.TransactionType, state.string())
+func (cc *MesiCacheController) invalidateCache(address uint32, absoluteIndex int) {
+	cc.cacheStates[absoluteIndex] = mesiInvalid
+	cc.evict(address)
 }
 
 func (cc *MesiCacheController) UpdateAccessStats(address uint32) {
@@ -312,6 +330,6 @@ func (cc *MesiCacheController) UpdateAccessStats(address uint32) {
 	case mesiShared:
 		cc.stats.NumAccessesToSharedData++
 	default:
-		panic(fmt.Sprintf("Cache line is in %d state while updating access stats", cc.cacheStates[index]))
+		panic(cc.newError(nil, "accessed cache line is not valid"))
 	}
 }
@@ -0,0 +1,222 @@
+package cache_test
+
+import (
+	"testing"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/bus"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/cache"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/xact"
+	"github.com/chriskheng/cs4223-assignment2/coherence/constants"
+	"github.com/chriskheng/cs4223-assignment2/coherence/testutils/scenario"
+)
+
+const memoryId = constants.MemoryId
+
+func newMesiCache(id int, bus *bus.Bus, blockSize, associativity, cacheSize int,
+	replacement cache.ReplacementConfig) cache.CacheController {
+	return cache.NewMesiCache(id, bus, blockSize, associativity, cacheSize, replacement)
+}
+
+var mesiTests = map[string]scenario.Scenario{
+	"Invalid to Exclusive on a read miss without copies": {
+		NumCores: 2,
+		Accesses: []scenario.Access{{Core: 0, Op: scenario.Load, Address: 0x0, Done: 110}},
+		States:   []scenario.State{{Core: 0, Address: 0x0, Name: "Exclusive"}},
+		Transactions: []scenario.Transaction{
+			{Type: xact.BusRead, SenderId: 0, Address: 0x0},
+			{Type: xact.MemReadDone, SenderId: memoryId, Address: 0x0},
+		},
+	},
+	"Invalid to Shared on a read miss, Exclusive copy supplies the block": {
+		NumCores: 2,
+		Accesses: []scenario.Access{
+			{Core: 0, Op: scenario.Load, Address: 0x0},
+			{Cycle: 200, Core: 1, Op: scenario.Load, Address: 0x0, Done: 211},
+		},
+		States: []scenario.State{{Core: 0, Address: 0x0, Name: "Shared"}, {Core: 1, Address: 0x0, Name: "Shared"}},
+		Transactions: []scenario.Transaction{
+			{Type: xact.BusRead, SenderId: 0, Address: 0x0},
+			{Type: xact.MemReadDone, SenderId: memoryId, Address: 0x0},
+			{Type: xact.BusRead, SenderId: 1, Address: 0x0},
+			{Type: xact.FlushOpt, SenderId: 0, Address: 0x0},
+		},
+	},
+	"Modified to Shared on BusRead, the block is written back": {
+		NumCores: 2,
+		Accesses: []scenario.Access{
+			{Core: 0, Op: scenario.Store, Address: 0x0},
+			{Cycle: 200, Core: 1, Op: scenario.Load, Address: 0x0, Done: 311},
+		},
+		States: []scenario.State{{Core: 0, Address: 0x0, Name: "Shared"}, {Core: 1, Address: 0x0, Name: "Shared"}},
+		Transactions: []scenario.Transaction{
+			{Type: xact.BusReadX, SenderId: 0, Address: 0x0},
+			{Type: xact.MemReadDone, SenderId: memoryId, Address: 0x0},
+			{Type: xact.BusRead, SenderId: 1, Address: 0x0},
+			{Type: xact.Flush, SenderId: 0, Address: 0x0},
+			{Type: xact.MemWriteDone, SenderId: memoryId, Address: 0x0},
+		},
+	},
+	"Invalid to Modified on a write miss": {
+		NumCores: 2,
+		Accesses: []scenario.Access{{Core: 0, Op: scenario.Store, Address: 0x0, Done: 110}},
+		States:   []scenario.State{{Core: 0, Address: 0x0, Name: "Modified"}},
+		Transactions: []scenario.Transaction{
+			{Type: xact.BusReadX, SenderId: 0, Address: 0x0},
+			{Type: xact.MemReadDone, SenderId: memoryId, Address: 0x0},
+		},
+	},
+	"Exclusive to Modified on a write hit without transaction": {
+		NumCores: 2,
+		Accesses: []scenario.Access{
+			{Core: 0, Op: scenario.Load, Address: 0x0},
+			{Core: 0, Op: scenario.Store, Address: 0x0, Done: 111},
+		},
+		States: []scenario.State{{Core: 0, Address: 0x0, Name: "Modified"}},
+		Transactions: []scenario.Transaction{
+			{Type: xact.BusRead, SenderId: 0, Address: 0x0},
+			{Type: xact.MemReadDone, SenderId: memoryId, Address: 0x0},
+		},
+	},
+	"Shared to Modified on a write hit, the other copies are invalidated": {
+		NumCores: 3,
+		Accesses: []scenario.Access{
+			{Core: 0, Op: scenario.Load, Address: 0x0},
+			{Cycle: 200, Core: 1, Op: scenario.Load, Address: 0x0},
+			{Cycle: 400, Core: 0, Op: scenario.Store, Address: 0x0, Done: 402},
+		},
+		States: []scenario.State{
+			{Core: 0, Address: 0x0, Name: "Modified"},
+			{Core: 1, Address: 0x0, Name: "Invalid"},
+			{Core: 2, Address: 0x0, Name: "Invalid"},
+		},
+		Transactions: []scenario.Transaction{
+			{Type: xact.BusRead, SenderId: 0, Address: 0x0},
+			{Type: xact.MemReadDone, SenderId: memoryId, Address: 0x0},
+			{Type: xact.BusRead, SenderId: 1, Address: 0x0},
+			{Type: xact.FlushOpt, SenderId: 0, Address: 0x0},
+			{Type: xact.BusUpgr, SenderId: 0, Address: 0x0},
+		},
+	},
+	"Modified to Invalid on BusReadX, the block is written back": {
+		NumCores: 2,
+		Accesses: []scenario.Access{
+			{Core: 0, Op: scenario.Store, Address: 0x0},
+			{Cycle: 200, Core: 1, Op: scenario.Store, Address: 0x0, Done: 311},
+		},
+		States: []scenario.State{{Core: 0, Address: 0x0, Name: "Invalid"}, {Core: 1, Address: 0x0, Name: "Modified"}},
+		Transactions: []scenario.Transaction{
+			{Type: xact.BusReadX, SenderId: 0, Address: 0x0},
+			{Type: xact.MemReadDone, SenderId: memoryId, Address: 0x0},
+			{Type: xact.BusReadX, SenderId: 1, Address: 0x0},
+			{Type: xact.Flush, SenderId: 0, Address: 0x0},
+			{Type: xact.MemWriteDone, SenderId: memoryId, Address: 0x0},
+		},
+	},
+	"Exclusive to Invalid on BusReadX": {
+		NumCores: 2,
+		Accesses: []scenario.Access{
+			{Core: 0, Op: scenario.Load, Address: 0x0},
+			{Cycle: 200, Core: 1, Op: scenario.Store, Address: 0x0, Done: 211},
+		},
+		States: []scenario.State{{Core: 0, Address: 0x0, Name: "Invalid"}, {Core: 1, Address: 0x0, Name: "Modified"}},
+		Transactions: []scenario.Transaction{
+			{Type: xact.BusRead, SenderId: 0, Address: 0x0},
+			{Type: xact.MemReadDone, SenderId: memoryId, Address: 0x0},
+			{Type: xact.BusReadX, SenderId: 1, Address: 0x0},
+			{Type: xact.FlushOpt, SenderId: 0, Address: 0x0},
+		},
+	},
+	"Shared to Invalid on BusReadX": {
+		NumCores: 3,
+		Accesses: []scenario.Access{
+			{Core: 0, Op: scenario.Load, Address: 0x0},
+			{Cycle: 200, Core: 1, Op: scenario.Load, Address: 0x0},
+			{Cycle: 400, Core: 2, Op: scenario.Store, Address: 0x0, Done: 510},
+		},
+		States: []scenario.State{
+			{Core: 0, Address: 0x0, Name: "Invalid"},
+			{Core: 1, Address: 0x0, Name: "Invalid"},
+			{Core: 2, Address: 0x0, Name: "Modified"},
+		},
+		Transactions: []scenario.Transaction{
+			{Type: xact.BusRead, SenderId: 0, Address: 0x0},
+			{Type: xact.MemReadDone, SenderId: memoryId, Address: 0x0},
+			{Type: xact.BusRead, SenderId: 1, Address: 0x0},
+			{Type: xact.FlushOpt, SenderId: 0, Address: 0x0},
+			{Type: xact.BusReadX, SenderId: 2, Address: 0x0},
+			{Type: xact.MemReadDone, SenderId: memoryId, Address: 0x0},
+		},
+	},
+	"Modified to Invalid on eviction, the block is written back before the miss": {
+		NumCores: 1,
+		Accesses: []scenario.Access{
+			{Core: 0, Op: scenario.Store, Address: 0x0},
+			{Core: 0, Op: scenario.Load, Address: 0x20},
+			{Core: 0, Op: scenario.Load, Address: 0x40, Done: 441},
+		},
+		States: []scenario.State{
+			{Core: 0, Address: 0x0, Name: "Invalid"},
+			{Core: 0, Address: 0x20, Name: "Exclusive"},
+			{Core: 0, Address: 0x40, Name: "Exclusive"},
+		},
+		Transactions: []scenario.Transaction{
+			{Type: xact.BusReadX, SenderId: 0, Address: 0x0},
+			{Type: xact.MemReadDone, SenderId: memoryId, Address: 0x0},
+			{Type: xact.BusRead, SenderId: 0, Address: 0x20},
+			{Type: xact.MemReadDone, SenderId: memoryId, Address: 0x20},
+			{Type: xact.Flush, SenderId: 0, Address: 0x0},
+			{Type: xact.MemWriteDone, SenderId: memoryId, Address: 0x0},
+			{Type: xact.BusRead, SenderId: 0, Address: 0x40},
+			{Type: xact.MemReadDone, SenderId: memoryId, Address: 0x40},
+		},
+	},
+	"Split bus: IM_D to IM_D_S on a BusRead snooped before the block, which is flushed once the write is done": {
+		NumCores: 2,
+		Accesses: []scenario.Access{
+			{Core: 0, Op: scenario.Store, Address: 0x0, Done: 110},
+			{Cycle: 1, Core: 1, Op: scenario.Load, Address: 0x0, Done: 219},
+		},
+		States: []scenario.State{
+			{Cycle: 1, Core: 0, Address: 0x0, Name: "IM_D"},
+			{Cycle: 3, Core: 0, Address: 0x0, Name: "IM_D_S"},
+			{Cycle: 3, Core: 1, Address: 0x0, Name: "IS_D"},
+			{Core: 0, Address: 0x0, Name: "Shared"},
+			{Core: 1, Address: 0x0, Name: "Shared"},
+		},
+		Transactions: []scenario.Transaction{
+			{Type: xact.BusReadX, SenderId: 0, Address: 0x0},
+			{Type: xact.BusRead, SenderId: 1, Address: 0x0},
+			{Type: xact.MemReadDone, SenderId: memoryId, Address: 0x0},
+			{Type: xact.Flush, SenderId: 0, Address: 0x0},
+			{Type: xact.MemWriteDone, SenderId: memoryId, Address: 0x0},
+		},
+		IsSplitTransaction: true,
+	},
+	"Split bus: IE_D to IE_D_I on a BusReadX snooped before the block, which is supplied once the read is done": {
+		NumCores: 2,
+		Accesses: []scenario.Access{
+			{Core: 0, Op: scenario.Load, Address: 0x0, Done: 110},
+			{Cycle: 1, Core: 1, Op: scenario.Store, Address: 0x0, Done: 119},
+		},
+		States: []scenario.State{
+			{Cycle: 1, Core: 0, Address: 0x0, Name: "IE_D"},
+			{Cycle: 3, Core: 0, Address: 0x0, Name: "IE_D_I"},
+			{Cycle: 3, Core: 1, Address: 0x0, Name: "IM_D"},
+			{Core: 0, Address: 0x0, Name: "Invalid"},
+			{Core: 1, Address: 0x0, Name: "Modified"},
+		},
+		Transactions: []scenario.Transaction{
+			{Type: xact.BusRead, SenderId: 0, Address: 0x0},
+			{Type: xact.BusReadX, SenderId: 1, Address: 0x0},
+			{Type: xact.MemReadDone, SenderId: memoryId, Address: 0x0},
+			{Type: xact.FlushOpt, SenderId: 0, Address: 0x0},
+		},
+		IsSplitTransaction: true,
+	},
+}
+
+func TestMesiTransitions(t *testing.T) {
+	for name, s := range mesiTests {
+		t.Run(name, func(t *testing.T) { scenario.Run(t, newMesiCache, s) })
+	}
+}
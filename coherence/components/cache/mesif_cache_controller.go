@@ -1,18 +1,15 @@
 package cache
 
 import (
-	"fmt"
-
 	"github.com/chriskheng/cs4223-assignment2/coherence/components/bus"
 	"github.com/chriskheng/cs4223-assignment2/coherence/components/xact"
 )
 
 type MesifCacheController struct {
 	*BaseCacheController
-	xactToIssueAfterEvictWriteBack xact.Transaction
-	cacheStates                    []mesifCacheState
-	busUpgrGotCancelled            bool
-	addressCancelled               uint32
+	cacheStates         []mesifCacheState
+	busUpgrGotCancelled bool
+	addressCancelled    uint32
 }
 
 type mesifCacheState int
@@ -25,13 +22,23 @@ const (
 	mesifForward
 )
 
-func (c mesifCacheState) string() string {
+func (c mesifCacheState) String() string {
 	return [...]string{"Invalid", "Modified", "Exclusive", "Shared", "Forward"}[c]
 }
 
-func NewMesifCache(id int, bus *bus.Bus, blockSize, associativity, cacheSize int) *MesifCacheController {
+func (c mesifCacheState) lineState() LineState {
+	return LineState{
+		Name:        c.String(),
+		IsValid:     c != mesifInvalid,
+		IsExclusive: c == mesifModified || c == mesifExclusive,
+		IsOwner:     c == mesifForward,
+	}
+}
+
+func NewMesifCache(id int, bus *bus.Bus, blockSize, associativity, cacheSize int,
+	replacement ReplacementConfig) *MesifCacheController {
 	mesifCC := &MesifCacheController{
-		BaseCacheController: NewBaseCache(id, bus, blockSize, associativity, cacheSize),
+		BaseCacheController: NewBaseCache(id, bus, blockSize, associativity, cacheSize, replacement),
 	}
 	mesifCC.RegisterUpdateAccessStatsCallback(mesifCC.UpdateAccessStats)
 
@@ -39,8 +46,9 @@ func NewMesifCache(id int, bus *bus.Bus, blockSize, associativity, cacheSize int
 	for i := range mesifCC.cacheStates {
 		mesifCC.cacheStates[i] = mesifInvalid
 	}
+	mesifCC.getLineState = func(index int) LineState { return mesifCC.cacheStates[index].lineState() }
 
-	bus.RegisterSnoopingCallBack(mesifCC.OnSnoop)
+	mesifCC.registerOnBus(mesifCC.OnSnoop, mesifCC.BackInvalidate)
 	return mesifCC
 }
 
@@ -51,7 +59,7 @@ func (cc *MesifCacheController) RequestRead(address uint32, callback func()) {
 		cc.state = CacheHit
 	} else {
 		cc.state = RequestForBus
-		cc.stats.NumCacheMisses++
+		cc.isMiss = true
 		busReadXact := xact.Transaction{
 			TransactionType:   xact.BusRead,
 			Address:           address,
@@ -75,7 +83,7 @@ func (cc *MesifCacheController) RequestRead(address uint32, callback func()) {
 }
 
 func (cc *MesifCacheController) RequestWrite(address uint32, callback func()) {
-	cc.prepareForRequest(address, callback)
+	cc.prepareForWrite(address, callback)
 
 	if cc.cache.Contain(address) {
 		index := cc.cache.GetIndexInArray(address)
@@ -95,11 +103,11 @@ func (cc *MesifCacheController) RequestWrite(address uint32, callback func()) {
 				SenderId:        cc.id,
 			}
 		default:
-			panic(fmt.Sprintf("cache state is in %d when cache data structure contains the address", state))
+			panic(cc.newError(nil, "cache line is in unknown state %d", state))
 		}
 	} else {
 		cc.state = RequestForBus
-		cc.stats.NumCacheMisses++
+		cc.isMiss = true
 		busReadXXact := xact.Transaction{
 			TransactionType:   xact.BusReadX,
 			Address:           address,
@@ -123,6 +131,11 @@ func (cc *MesifCacheController) RequestWrite(address uint32, callback func()) {
 }
 
 func (cc *MesifCacheController) OnSnoop(transaction xact.Transaction) {
+	if !cc.isOwnTransaction(transaction) {
+		cc.handleSnoopOtherCases(transaction)
+		return
+	}
+
 	switch cc.state {
 	case WaitForEvictWriteBack:
 		cc.handleSnoopWaitForEvictWriteBack(transaction)
@@ -143,10 +156,13 @@ func (cc *MesifCacheController) handleSnoopWaitForEvictWriteBack(transaction xac
 	switch transaction.TransactionType {
 	case xact.MemWriteDone:
 		if transaction.Address != cc.currentTransaction.Address {
-			panic("address evicted for write back is not the same as the address received for memwritedone")
+			panic(cc.newError(&transaction, "MemWriteDone is not for the evicted block"))
 		}
 
-		cc.cache.Evict(cc.currentTransaction.Address)
+		// The evicted line may have been invalidated since its write back was sent.
+		if cc.cache.Contain(cc.currentTransaction.Address) {
+			cc.cache.Evict(cc.currentTransaction.Address)
+		}
 
 		cc.transactionToSendWhenReplying = cc.xactToIssueAfterEvictWriteBack
 		cc.currentTransaction = cc.xactToIssueAfterEvictWriteBack
@@ -154,8 +170,7 @@ func (cc *MesifCacheController) handleSnoopWaitForEvictWriteBack(transaction xac
 		cc.needToReply = true
 		cc.state = WaitForRequestToComplete
 	default:
-		panic(fmt.Sprintf("Xact of type %d is received when cache controller is waiting for evict write back",
-			transaction.TransactionType))
+		panic(cc.newError(&transaction, "unexpected transaction while waiting for the write back of the evicted block"))
 	}
 }
 
@@ -164,12 +179,12 @@ func (cc *MesifCacheController) handleSnoopWaitForRequestToComplete(transaction
 	if transaction.SenderId == cc.id && transaction.TransactionType == xact.BusUpgr {
 		// Should have the same address (since the message is from the current sender itself (loopback))
 		if transaction.Address != cc.currentTransaction.Address {
-			panic("cache controller receives a different address than the address in BusUpgr")
+			panic(cc.newError(&transaction, "BusUpgr is not for the requested block"))
 		}
 		cc.state = CacheHit
 		index := cc.cache.GetIndexInArray(cc.currentTransaction.Address)
 		if index == -1 {
-			panic(fmt.Sprintf("index returned is -1, current iter %d", cc.iter))
+			panic(cc.newError(&transaction, "upgraded block is not in the cache"))
 		}
 
 		cc.cacheStates[index] = mesifModified
@@ -177,15 +192,27 @@ func (cc *MesifCacheController) handleSnoopWaitForRequestToComplete(transaction
 	}
 
 	if transaction.SenderId == cc.id {
+		cc.insertRequestedLine()
 		return
 	}
 
 	// only for reply cases
 	if !cc.cache.isSamePrefix(transaction.Address, cc.currentTransaction.Address) {
-		fmt.Printf("iter: %d\n", cc.iter)
-		panic("tag of address received by cache controller is different than the tag of the requested address while waiting for read to complete")
+		panic(cc.newError(&transaction, "reply is not for the requested block"))
 	}
 
+	if transaction.TransactionType == xact.Flush {
+		cc.state = WaitForWriteBack
+	} else if transaction.TransactionType == xact.MemReadDone || transaction.TransactionType == xact.FlushOpt {
+		cc.state = CacheHit
+	} else {
+		panic(cc.newError(&transaction, "unexpected reply to %s", cc.currentTransaction.TransactionType))
+	}
+}
+
+// The line is inserted when the read request is snooped, in the state it ends up in, so that the requests of other
+// caches snooped before the block is received see it in that state.
+func (cc *MesifCacheController) insertRequestedLine() {
 	hasCopy := cc.bus.CheckHasCopy(cc.currentTransaction.Address)
 	_, _, absoluteIndex := cc.cache.Insert(cc.currentTransaction.Address)
 
@@ -196,33 +223,18 @@ func (cc *MesifCacheController) handleSnoopWaitForRequestToComplete(transaction
 		} else {
 			cc.cacheStates[absoluteIndex] = mesifExclusive
 		}
-
-		if transaction.TransactionType == xact.Flush {
-			cc.state = WaitForWriteBack
-		} else if transaction.TransactionType == xact.MemReadDone || transaction.TransactionType == xact.FlushOpt {
-			cc.state = CacheHit
-		} else {
-			panic(fmt.Sprintf("transaction of type %d was received when cache controller is waiting for BusRead result", transaction.TransactionType))
-		}
 	case xact.BusReadX:
 		cc.cacheStates[absoluteIndex] = mesifModified
 		cc.busUpgrGotCancelled = false
-		if transaction.TransactionType == xact.Flush {
-			cc.state = WaitForWriteBack
-		} else if transaction.TransactionType == xact.MemReadDone || transaction.TransactionType == xact.FlushOpt {
-			cc.state = CacheHit
-		} else {
-			panic(fmt.Sprintf("transaction of type %d was received when cache controller is waiting for BusReadX result", transaction.TransactionType))
-		}
 	}
 }
 
 // write to memory
 func (cc *MesifCacheController) handleSnoopWriteBack(transaction xact.Transaction) {
 	if transaction.TransactionType != xact.MemWriteDone {
-		panic(fmt.Sprintf("transaction of type %d is received when cache controller %d is waiting for writeback, sender id: %d", transaction.TransactionType, cc.id, transaction.SenderId))
+		panic(cc.newError(&transaction, "unexpected transaction while waiting for the write back of the flushed block"))
 	} else if !cc.cache.isSamePrefix(transaction.Address, cc.currentTransaction.Address) {
-		panic("tag of address written is not equal to the tag of address requested by cache controller")
+		panic(cc.newError(&transaction, "write back is not for the requested block"))
 	}
 
 	cc.state = CacheHit
@@ -264,7 +276,7 @@ func (cc *MesifCacheController) handleSnoopOtherCases(transaction xact.Transacti
 				cc.xactToIssueAfterEvictWriteBack = xact.Transaction{TransactionType: xact.Nil}
 			}
 		default:
-			panic(getPanicMsgCacheState(transaction, mesifModified))
+			panic(cc.newError(&transaction, "unexpected snooped transaction"))
 		}
 	case mesifExclusive:
 		switch transaction.TransactionType {
@@ -282,7 +294,7 @@ func (cc *MesifCacheController) handleSnoopOtherCases(transaction xact.Transacti
 				cc.invalidateCache(transaction.Address, absoluteIndex)
 			}
 		default:
-			panic(getPanicMsgCacheState(transaction, mesifExclusive))
+			panic(cc.newError(&transaction, "unexpected snooped transaction"))
 		}
 	case mesifShared:
 		switch transaction.TransactionType {
@@ -300,7 +312,7 @@ func (cc *MesifCacheController) handleSnoopOtherCases(transaction xact.Transacti
 			}
 			cc.invalidateCache(transaction.Address, absoluteIndex)
 		case xact.Flush:
-			panic(getPanicMsgCacheState(transaction, mesifShared))
+			panic(cc.newError(&transaction, "unexpected snooped transaction"))
 		}
 	case mesifForward:
 		switch transaction.TransactionType {
@@ -316,7 +328,7 @@ func (cc *MesifCacheController) handleSnoopOtherCases(transaction xact.Transacti
 				cc.cacheStates[absoluteIndex] = mesifShared
 			}
 		case xact.Flush, xact.MemWriteDone, xact.MemReadDone:
-			panic(getPanicMsgCacheState(transaction, mesifForward))
+			panic(cc.newError(&transaction, "unexpected snooped transaction"))
 		}
 
 		switch transaction.TransactionType {
@@ -337,19 +349,28 @@ func (cc *MesifCacheController) handleSnoopOtherCases(transaction xact.Transacti
 	}
 }
 
+// Invalidate the cache line of the given address because the inclusive L2 cache evicts it.
+func (cc *MesifCacheController) BackInvalidate(address uint32) (bool, bool) {
+	if !cc.cache.Contain(address) {
+		return false, false
+	}
+
+	index := cc.cache.GetIndexInArray(address)
+	isDirty := cc.cacheStates[index] == mesifModified
+	cc.invalidateCache(address, index)
+	cc.onBackInvalidate(address)
+	return true, isDirty
+}
+
 func (cc *MesifCacheController) invalidateCache(address uint32, absoluteIndex int) {
 	cc.cacheStates[absoluteIndex] = mesifInvalid
-	cc.cache.Evict(address)
+	cc.evict(address)
 }
 
 func (cc *MesifCacheController) isUpgradingSamePrefix(address uint32) bool {
 	return cc.state == WaitForBus && cc.currentTransaction.TransactionType == xact.BusUpgr && cc.cache.isSamePrefix(cc.currentTransaction.Address, address)
 }
 
-func getPanicMsgCacheState(transaction xact.Transaction, state mesifCacheState) string {
-	return fmt.Sprintf("xact of type %d is received when cache is in %s state", transaction.TransactionType, state.string())
-}
-
 func (cc *MesifCacheController) UpdateAccessStats(address uint32) {
 	index := cc.cache.GetIndexInArray(address)
 	switch cc.cacheStates[index] {
@@ -358,6 +379,6 @@ func (cc *MesifCacheController) UpdateAccessStats(address uint32) {
 	case mesifShared, mesifForward:
 		cc.stats.NumAccessesToSharedData++
 	default:
-		panic(fmt.Sprintf("Cache line is in %d state while updating access stats", cc.cacheStates[index]))
+		panic(cc.newError(nil, "accessed cache line is not valid"))
 	}
 }
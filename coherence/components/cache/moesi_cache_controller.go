@@ -0,0 +1,355 @@
+package cache
+
+import (
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/bus"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/xact"
+)
+
+type MoesiCacheController struct {
+	*BaseCacheController
+	cacheStates []moesiCacheState
+}
+
+type moesiCacheState int
+
+const (
+	moesiInvalid moesiCacheState = iota // Put Invalid as first state just in case we forgot to initialise the state.
+	moesiModified
+	moesiOwned
+	moesiExclusive
+	moesiShared
+)
+
+func (c moesiCacheState) String() string {
+	return [...]string{"Invalid", "Modified", "Owned", "Exclusive", "Shared"}[c]
+}
+
+func (c moesiCacheState) lineState() LineState {
+	return LineState{
+		Name:        c.String(),
+		IsValid:     c != moesiInvalid,
+		IsExclusive: c == moesiModified || c == moesiExclusive,
+		IsOwner:     c == moesiOwned,
+	}
+}
+
+func NewMoesiCache(id int, bus *bus.Bus, blockSize, associativity, cacheSize int,
+	replacement ReplacementConfig) *MoesiCacheController {
+	moesiCC := &MoesiCacheController{
+		BaseCacheController: NewBaseCache(id, bus, blockSize, associativity, cacheSize, replacement),
+	}
+	moesiCC.RegisterUpdateAccessStatsCallback(moesiCC.UpdateAccessStats)
+
+	moesiCC.cacheStates = make([]moesiCacheState, len(moesiCC.cache.cacheArray))
+	for i := range moesiCC.cacheStates {
+		moesiCC.cacheStates[i] = moesiInvalid
+	}
+	moesiCC.getLineState = func(index int) LineState { return moesiCC.cacheStates[index].lineState() }
+
+	moesiCC.registerOnBus(moesiCC.OnSnoop, moesiCC.BackInvalidate)
+	return moesiCC
+}
+
+func (cc *MoesiCacheController) RequestRead(address uint32, callback func()) {
+	cc.prepareForRequest(address, callback)
+
+	if cc.cache.Contain(address) {
+		cc.state = CacheHit
+	} else {
+		cc.state = RequestForBus
+		cc.isMiss = true
+		busReadXact := xact.Transaction{
+			TransactionType:   xact.BusRead,
+			Address:           address,
+			RequestedDataSize: cc.cache.blockSizeInWords,
+			SenderId:          cc.id,
+		}
+		cc.setTransactionForMiss(address, busReadXact)
+	}
+}
+
+func (cc *MoesiCacheController) RequestWrite(address uint32, callback func()) {
+	cc.prepareForWrite(address, callback)
+
+	if cc.cache.Contain(address) {
+		index := cc.cache.GetIndexInArray(address)
+		state := cc.cacheStates[index]
+		switch state {
+		case moesiModified:
+			cc.state = CacheHit
+		case moesiExclusive:
+			cc.state = CacheHit
+			cc.cacheStates[index] = moesiModified
+		case moesiOwned, moesiShared:
+			cc.state = RequestForBus
+			cc.currentTransaction = xact.Transaction{
+				TransactionType: xact.BusUpgr,
+				Address:         address,
+				SenderId:        cc.id,
+			}
+		default:
+			panic(cc.newError(nil, "cache line is in unknown state %d", state))
+		}
+	} else {
+		cc.state = RequestForBus
+		cc.isMiss = true
+		busReadXXact := xact.Transaction{
+			TransactionType:   xact.BusReadX,
+			Address:           address,
+			RequestedDataSize: cc.cache.blockSizeInWords,
+			SenderId:          cc.id,
+		}
+		cc.setTransactionForMiss(address, busReadXXact)
+	}
+}
+
+// Both Modified and Owned lines are dirty, so evicting either of them requires a write back to memory before the
+// transaction for the miss can be issued.
+func (cc *MoesiCacheController) setTransactionForMiss(address uint32, missXact xact.Transaction) {
+	isToBeEvicted, evictedAddress, index := cc.cache.GetAddressToBeEvicted(address)
+	if !isToBeEvicted || !cc.cacheStates[index].isDirty() {
+		cc.currentTransaction = missXact
+	} else {
+		cc.xactToIssueAfterEvictWriteBack = missXact
+		cc.currentTransaction = xact.Transaction{
+			TransactionType: xact.Flush,
+			Address:         evictedAddress,
+			SendDataSize:    cc.cache.blockSizeInWords,
+			SenderId:        cc.id,
+		}
+	}
+}
+
+func (cc *MoesiCacheController) OnSnoop(transaction xact.Transaction) {
+	if !cc.isOwnTransaction(transaction) {
+		cc.handleSnoopOtherCases(transaction)
+		return
+	}
+
+	switch cc.state {
+	case WaitForEvictWriteBack:
+		cc.handleSnoopWaitForEvictWriteBack(transaction)
+	case WaitForRequestToComplete:
+		cc.handleSnoopWaitForRequestToComplete(transaction)
+	case WaitForWriteBack:
+		cc.handleSnoopWriteBack(transaction)
+	default:
+		cc.handleSnoopOtherCases(transaction)
+	}
+}
+
+func (cc *MoesiCacheController) handleSnoopWaitForEvictWriteBack(transaction xact.Transaction) {
+	if transaction.SenderId == cc.id {
+		return
+	}
+
+	switch transaction.TransactionType {
+	case xact.MemWriteDone:
+		if transaction.Address != cc.currentTransaction.Address {
+			panic(cc.newError(&transaction, "MemWriteDone is not for the evicted block"))
+		}
+
+		cc.transactionToSendWhenReplying = cc.xactToIssueAfterEvictWriteBack
+		cc.currentTransaction = cc.xactToIssueAfterEvictWriteBack
+		cc.xactToIssueAfterEvictWriteBack = xact.Transaction{TransactionType: xact.Nil}
+		cc.needToReply = true
+		cc.state = WaitForRequestToComplete
+	default:
+		panic(cc.newError(&transaction, "unexpected transaction while waiting for the write back of the evicted block"))
+	}
+}
+
+func (cc *MoesiCacheController) handleSnoopWaitForRequestToComplete(transaction xact.Transaction) {
+	// Handle S/O -> M state
+	if transaction.SenderId == cc.id && transaction.TransactionType == xact.BusUpgr {
+		// Should have the same address (since the message is from the current sender itself (loopback))
+		if transaction.Address != cc.currentTransaction.Address {
+			panic(cc.newError(&transaction, "BusUpgr is not for the requested block"))
+		}
+		cc.state = CacheHit
+		index := cc.cache.GetIndexInArray(cc.currentTransaction.Address)
+		if index == -1 {
+			panic(cc.newError(&transaction, "upgraded block is not in the cache"))
+		}
+
+		cc.cacheStates[index] = moesiModified
+		return
+	}
+
+	if transaction.SenderId == cc.id {
+		cc.insertRequestedLine()
+		return
+	}
+
+	// only for reply cases
+	if !cc.cache.isSamePrefix(transaction.Address, cc.currentTransaction.Address) {
+		panic(cc.newError(&transaction, "reply is not for the requested block"))
+	}
+
+	if transaction.TransactionType == xact.Flush {
+		cc.state = WaitForWriteBack
+	} else if transaction.TransactionType == xact.MemReadDone || transaction.TransactionType == xact.FlushOpt {
+		cc.state = CacheHit
+	} else {
+		panic(cc.newError(&transaction, "unexpected reply to %s", cc.currentTransaction.TransactionType))
+	}
+}
+
+// The line is inserted when the read request is snooped, in the state it ends up in, so that the requests of other
+// caches snooped before the block is received see it in that state.
+func (cc *MoesiCacheController) insertRequestedLine() {
+	hasCopy := cc.bus.CheckHasCopy(cc.currentTransaction.Address)
+	_, _, absoluteIndex := cc.cache.Insert(cc.currentTransaction.Address)
+
+	switch cc.currentTransaction.TransactionType {
+	case xact.BusRead:
+		if hasCopy {
+			cc.cacheStates[absoluteIndex] = moesiShared
+		} else {
+			cc.cacheStates[absoluteIndex] = moesiExclusive
+		}
+	case xact.BusReadX:
+		cc.cacheStates[absoluteIndex] = moesiModified
+	}
+}
+
+// write to memory
+func (cc *MoesiCacheController) handleSnoopWriteBack(transaction xact.Transaction) {
+	if transaction.TransactionType != xact.MemWriteDone {
+		panic(cc.newError(&transaction, "unexpected transaction while waiting for the write back of the flushed block"))
+	} else if !cc.cache.isSamePrefix(transaction.Address, cc.currentTransaction.Address) {
+		panic(cc.newError(&transaction, "write back is not for the requested block"))
+	}
+
+	cc.state = CacheHit
+}
+
+func (cc *MoesiCacheController) handleSnoopOtherCases(transaction xact.Transaction) {
+	if transaction.SenderId == cc.id || !cc.cache.Contain(transaction.Address) {
+		return
+	}
+
+	absoluteIndex := cc.cache.GetIndexInArray(transaction.Address)
+
+	switch cc.cacheStates[absoluteIndex] {
+	case moesiModified, moesiOwned:
+		switch transaction.TransactionType {
+		case xact.BusRead, xact.BusReadX:
+			// The dirty block is supplied cache-to-cache without writing it back to memory. On BusRead this cache
+			// keeps the responsibility of writing the block back later by staying in (or moving to) Owned. On
+			// BusReadX that responsibility moves to the requester which ends up in Modified.
+			cc.transactionToSendWhenReplying = xact.Transaction{
+				TransactionType: xact.FlushOpt,
+				Address:         transaction.Address,
+				SendDataSize:    transaction.RequestedDataSize,
+				SenderId:        cc.id,
+			}
+			cc.needToReply = true
+			if transaction.TransactionType == xact.BusRead {
+				cc.cacheStates[absoluteIndex] = moesiOwned
+			} else {
+				cc.changeBusUpgrToBusReadX(transaction.Address)
+				cc.invalidateCache(transaction.Address, absoluteIndex)
+				cc.cancelEvictWriteBack(transaction.Address)
+			}
+		case xact.BusUpgr:
+			if cc.cacheStates[absoluteIndex] != moesiOwned {
+				panic(cc.newError(&transaction, "unexpected snooped transaction"))
+			}
+			cc.changeBusUpgrToBusReadX(transaction.Address)
+			cc.invalidateCache(transaction.Address, absoluteIndex)
+			cc.cancelEvictWriteBack(transaction.Address)
+		default:
+			panic(cc.newError(&transaction, "unexpected snooped transaction"))
+		}
+	case moesiExclusive:
+		switch transaction.TransactionType {
+		case xact.BusRead, xact.BusReadX:
+			cc.transactionToSendWhenReplying = xact.Transaction{
+				TransactionType: xact.FlushOpt,
+				Address:         transaction.Address,
+				SendDataSize:    transaction.RequestedDataSize,
+				SenderId:        cc.id,
+			}
+			cc.needToReply = true
+			if transaction.TransactionType == xact.BusRead {
+				cc.cacheStates[absoluteIndex] = moesiShared
+			} else {
+				cc.invalidateCache(transaction.Address, absoluteIndex)
+			}
+		default:
+			panic(cc.newError(&transaction, "unexpected snooped transaction"))
+		}
+	case moesiShared:
+		switch transaction.TransactionType {
+		case xact.BusReadX, xact.BusUpgr:
+			cc.changeBusUpgrToBusReadX(transaction.Address)
+			cc.invalidateCache(transaction.Address, absoluteIndex)
+		}
+		// A Flush is expected here when the Owned copy of the block is evicted and written back to memory while
+		// other caches still keep their Shared copies.
+	}
+}
+
+// If the cache controller was waiting to upgrade the cache line which is being invalidated, then it no longer has
+// the block and needs to issue a BusReadX instead.
+func (cc *MoesiCacheController) changeBusUpgrToBusReadX(address uint32) {
+	needToChangeTransaction := cc.state == WaitForBus &&
+		cc.currentTransaction.TransactionType == xact.BusUpgr &&
+		cc.cache.isSamePrefix(cc.currentTransaction.Address, address)
+	if needToChangeTransaction {
+		cc.currentTransaction = xact.Transaction{
+			TransactionType:   xact.BusReadX,
+			Address:           cc.currentTransaction.Address,
+			RequestedDataSize: cc.cache.blockSizeInWords,
+			SenderId:          cc.id,
+		}
+	}
+}
+
+// If the cache controller was waiting to flush and the address to flush is equal to the address of the dirty cache
+// line being invalidated, then the cache controller doesn't have to flush when it gets the ownership of the bus since
+// the new owner of the block is now responsible for writing it back.
+func (cc *MoesiCacheController) cancelEvictWriteBack(address uint32) {
+	isWaitingToFlush := cc.state == WaitForBus &&
+		cc.currentTransaction.TransactionType == xact.Flush &&
+		cc.cache.isSamePrefix(cc.currentTransaction.Address, address)
+	if isWaitingToFlush {
+		cc.currentTransaction = cc.xactToIssueAfterEvictWriteBack
+		cc.xactToIssueAfterEvictWriteBack = xact.Transaction{TransactionType: xact.Nil}
+	}
+}
+
+// Invalidate the cache line of the given address because the inclusive L2 cache evicts it.
+func (cc *MoesiCacheController) BackInvalidate(address uint32) (bool, bool) {
+	if !cc.cache.Contain(address) {
+		return false, false
+	}
+
+	index := cc.cache.GetIndexInArray(address)
+	isDirty := cc.cacheStates[index].isDirty()
+	cc.invalidateCache(address, index)
+	cc.onBackInvalidate(address)
+	return true, isDirty
+}
+
+func (cc *MoesiCacheController) invalidateCache(address uint32, absoluteIndex int) {
+	cc.cacheStates[absoluteIndex] = moesiInvalid
+	cc.evict(address)
+}
+
+func (c moesiCacheState) isDirty() bool {
+	return c == moesiModified || c == moesiOwned
+}
+
+func (cc *MoesiCacheController) UpdateAccessStats(address uint32) {
+	index := cc.cache.GetIndexInArray(address)
+	switch cc.cacheStates[index] {
+	case moesiExclusive, moesiModified:
+		cc.stats.NumAccessesToPrivateData++
+	case moesiOwned, moesiShared:
+		cc.stats.NumAccessesToSharedData++
+	default:
+		panic(cc.newError(nil, "accessed cache line is not valid"))
+	}
+}
@@ -0,0 +1,322 @@
+package cache
+
+import (
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/bus"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/xact"
+)
+
+type MsiCacheController struct {
+	*BaseCacheController
+	cacheStates []msiCacheState
+	// Whether another cache may hold a copy of a Shared line, which only tells the accesses to private data from the
+	// ones to shared data the same way as the Exclusive state of MESI, since there is no Exclusive state.
+	isShared []bool
+}
+
+type msiCacheState int
+
+const (
+	msiInvalid msiCacheState = iota // Put Invalid as first state just in case we forgot to initialise the state.
+	msiModified
+	msiShared
+)
+
+func (c msiCacheState) String() string {
+	return [...]string{"Invalid", "Modified", "Shared"}[c]
+}
+
+func (c msiCacheState) lineState() LineState {
+	return LineState{
+		Name:        c.String(),
+		IsValid:     c != msiInvalid,
+		IsExclusive: c == msiModified,
+	}
+}
+
+func NewMsiCache(id int, bus *bus.Bus, blockSize, associativity, cacheSize int,
+	replacement ReplacementConfig) *MsiCacheController {
+	msiCC := &MsiCacheController{
+		BaseCacheController: NewBaseCache(id, bus, blockSize, associativity, cacheSize, replacement),
+	}
+	msiCC.RegisterUpdateAccessStatsCallback(msiCC.UpdateAccessStats)
+
+	msiCC.cacheStates = make([]msiCacheState, len(msiCC.cache.cacheArray))
+	msiCC.isShared = make([]bool, len(msiCC.cache.cacheArray))
+	for i := range msiCC.cacheStates {
+		msiCC.cacheStates[i] = msiInvalid
+	}
+	msiCC.getLineState = func(index int) LineState { return msiCC.cacheStates[index].lineState() }
+
+	msiCC.registerOnBus(msiCC.OnSnoop, msiCC.BackInvalidate)
+	return msiCC
+}
+
+func (cc *MsiCacheController) RequestRead(address uint32, callback func()) {
+	cc.prepareForRequest(address, callback)
+
+	if cc.cache.Contain(address) {
+		cc.state = CacheHit
+	} else {
+		cc.state = RequestForBus
+		cc.isMiss = true
+		busReadXact := xact.Transaction{
+			TransactionType:   xact.BusRead,
+			Address:           address,
+			RequestedDataSize: cc.cache.blockSizeInWords,
+			SenderId:          cc.id,
+		}
+
+		isToBeEvicted, evictedAddress, index := cc.cache.GetAddressToBeEvicted(address)
+		if !isToBeEvicted || cc.cacheStates[index] != msiModified {
+			cc.currentTransaction = busReadXact
+		} else {
+			cc.xactToIssueAfterEvictWriteBack = busReadXact
+			cc.currentTransaction = xact.Transaction{
+				TransactionType: xact.Flush,
+				Address:         evictedAddress,
+				SendDataSize:    cc.cache.blockSizeInWords,
+				SenderId:        cc.id,
+			}
+		}
+	}
+}
+
+func (cc *MsiCacheController) RequestWrite(address uint32, callback func()) {
+	cc.prepareForWrite(address, callback)
+
+	if cc.cache.Contain(address) {
+		index := cc.cache.GetIndexInArray(address)
+		state := cc.cacheStates[index]
+		switch state {
+		case msiModified:
+			cc.state = CacheHit
+		case msiShared:
+			cc.state = RequestForBus
+			cc.currentTransaction = xact.Transaction{
+				TransactionType: xact.BusUpgr,
+				Address:         address,
+				SenderId:        cc.id,
+			}
+		default:
+			panic(cc.newError(nil, "cache line is in unknown state %d", state))
+		}
+	} else {
+		cc.state = RequestForBus
+		cc.isMiss = true
+		busReadXXact := xact.Transaction{
+			TransactionType:   xact.BusReadX,
+			Address:           address,
+			RequestedDataSize: cc.cache.blockSizeInWords,
+			SenderId:          cc.id,
+		}
+
+		isToBeEvicted, evictedAddress, index := cc.cache.GetAddressToBeEvicted(address)
+		if !isToBeEvicted || cc.cacheStates[index] != msiModified {
+			cc.currentTransaction = busReadXXact
+		} else {
+			cc.xactToIssueAfterEvictWriteBack = busReadXXact
+			cc.currentTransaction = xact.Transaction{
+				TransactionType: xact.Flush,
+				Address:         evictedAddress,
+				SendDataSize:    cc.cache.blockSizeInWords,
+				SenderId:        cc.id,
+			}
+		}
+	}
+}
+
+func (cc *MsiCacheController) OnSnoop(transaction xact.Transaction) {
+	if !cc.isOwnTransaction(transaction) {
+		cc.handleSnoopOtherCases(transaction)
+		return
+	}
+
+	switch cc.state {
+	case WaitForEvictWriteBack:
+		cc.handleSnoopWaitForEvictWriteBack(transaction)
+	case WaitForRequestToComplete:
+		cc.handleSnoopWaitForRequestToComplete(transaction)
+	case WaitForWriteBack:
+		cc.handleSnoopWriteBack(transaction)
+	default:
+		cc.handleSnoopOtherCases(transaction)
+	}
+}
+
+func (cc *MsiCacheController) handleSnoopWaitForEvictWriteBack(transaction xact.Transaction) {
+	if transaction.SenderId == cc.id {
+		return
+	}
+
+	switch transaction.TransactionType {
+	case xact.MemWriteDone:
+		if transaction.Address != cc.currentTransaction.Address {
+			panic(cc.newError(&transaction, "MemWriteDone is not for the evicted block"))
+		}
+
+		cc.transactionToSendWhenReplying = cc.xactToIssueAfterEvictWriteBack
+		cc.currentTransaction = cc.xactToIssueAfterEvictWriteBack
+		cc.xactToIssueAfterEvictWriteBack = xact.Transaction{TransactionType: xact.Nil}
+		cc.needToReply = true
+		cc.state = WaitForRequestToComplete
+	default:
+		panic(cc.newError(&transaction, "unexpected transaction while waiting for the write back of the evicted block"))
+	}
+}
+
+func (cc *MsiCacheController) handleSnoopWaitForRequestToComplete(transaction xact.Transaction) {
+	// Handle S -> M state
+	if transaction.SenderId == cc.id && transaction.TransactionType == xact.BusUpgr {
+		// Should have the same address (since the message is from the current sender itself (loopback))
+		if transaction.Address != cc.currentTransaction.Address {
+			panic(cc.newError(&transaction, "BusUpgr is not for the requested block"))
+		}
+		cc.state = CacheHit
+		index := cc.cache.GetIndexInArray(cc.currentTransaction.Address)
+		if index == -1 {
+			panic(cc.newError(&transaction, "upgraded block is not in the cache"))
+		}
+
+		cc.cacheStates[index] = msiModified
+		return
+	}
+
+	if transaction.SenderId == cc.id {
+		cc.insertRequestedLine()
+		return
+	}
+
+	// only for reply cases
+	if !cc.cache.isSamePrefix(transaction.Address, cc.currentTransaction.Address) {
+		panic(cc.newError(&transaction, "reply is not for the requested block"))
+	}
+
+	if transaction.TransactionType == xact.Flush {
+		cc.state = WaitForWriteBack
+	} else if transaction.TransactionType == xact.MemReadDone || transaction.TransactionType == xact.FlushOpt {
+		cc.state = CacheHit
+	} else {
+		panic(cc.newError(&transaction, "unexpected reply to %s", cc.currentTransaction.TransactionType))
+	}
+}
+
+// The line is inserted when the read request is snooped, in the state it ends up in, so that the requests of other
+// caches snooped before the block is received see it in that state.
+func (cc *MsiCacheController) insertRequestedLine() {
+	hasCopy := cc.bus.CheckHasCopy(cc.currentTransaction.Address)
+	_, _, absoluteIndex := cc.cache.Insert(cc.currentTransaction.Address)
+
+	switch cc.currentTransaction.TransactionType {
+	case xact.BusRead:
+		// Without an Exclusive state, the block is always loaded as Shared even if no other cache has a copy.
+		cc.cacheStates[absoluteIndex] = msiShared
+		cc.isShared[absoluteIndex] = hasCopy
+	case xact.BusReadX:
+		cc.cacheStates[absoluteIndex] = msiModified
+	}
+}
+
+// write to memory
+func (cc *MsiCacheController) handleSnoopWriteBack(transaction xact.Transaction) {
+	if transaction.TransactionType != xact.MemWriteDone {
+		panic(cc.newError(&transaction, "unexpected transaction while waiting for the write back of the flushed block"))
+	} else if !cc.cache.isSamePrefix(transaction.Address, cc.currentTransaction.Address) {
+		panic(cc.newError(&transaction, "write back is not for the requested block"))
+	}
+
+	cc.state = CacheHit
+}
+
+func (cc *MsiCacheController) handleSnoopOtherCases(transaction xact.Transaction) {
+	if transaction.SenderId == cc.id || !cc.cache.Contain(transaction.Address) {
+		return
+	}
+
+	absoluteIndex := cc.cache.GetIndexInArray(transaction.Address)
+
+	switch cc.cacheStates[absoluteIndex] {
+	case msiModified:
+		switch transaction.TransactionType {
+		case xact.BusRead, xact.BusReadX:
+			cc.transactionToSendWhenReplying = xact.Transaction{
+				TransactionType: xact.Flush,
+				Address:         transaction.Address,
+				SendDataSize:    transaction.RequestedDataSize,
+				SenderId:        cc.id,
+			}
+			cc.needToReply = true
+			if transaction.TransactionType == xact.BusRead {
+				cc.cacheStates[absoluteIndex] = msiShared
+				cc.isShared[absoluteIndex] = true
+			} else {
+				cc.invalidateCache(transaction.Address, absoluteIndex)
+			}
+
+			// If the cache controller was waiting to flush and the address to flush is equal to
+			// the address received in the snooped transaction, then the cache controller
+			// don't have to flush when it got the ownership of the bus since it will flush
+			// the cache line now.
+			isWaitingToFlush := cc.state == WaitForBus &&
+				cc.currentTransaction.TransactionType == xact.Flush &&
+				cc.cache.isSamePrefix(cc.currentTransaction.Address, transaction.Address)
+			if isWaitingToFlush {
+				cc.currentTransaction = cc.xactToIssueAfterEvictWriteBack
+				cc.xactToIssueAfterEvictWriteBack = xact.Transaction{TransactionType: xact.Nil}
+			}
+		default:
+			panic(cc.newError(&transaction, "unexpected snooped transaction"))
+		}
+	case msiShared:
+		switch transaction.TransactionType {
+		case xact.BusRead:
+			cc.isShared[absoluteIndex] = true
+		case xact.BusReadX, xact.BusUpgr:
+			needToChangeTransaction := cc.state == WaitForBus && cc.currentTransaction.TransactionType == xact.BusUpgr && cc.cache.isSamePrefix(cc.currentTransaction.Address, transaction.Address)
+			if needToChangeTransaction {
+				cc.currentTransaction = xact.Transaction{
+					TransactionType:   xact.BusReadX,
+					Address:           transaction.Address,
+					RequestedDataSize: cc.cache.blockSizeInWords,
+					SenderId:          cc.id,
+				}
+			}
+			cc.invalidateCache(transaction.Address, absoluteIndex)
+		case xact.Flush:
+			panic(cc.newError(&transaction, "unexpected snooped transaction"))
+		}
+	}
+}
+
+// Invalidate the cache line of the given address because the inclusive L2 cache evicts it.
+func (cc *MsiCacheController) BackInvalidate(address uint32) (bool, bool) {
+	if !cc.cache.Contain(address) {
+		return false, false
+	}
+
+	index := cc.cache.GetIndexInArray(address)
+	isDirty := cc.cacheStates[index] == msiModified
+	cc.invalidateCache(address, index)
+	cc.onBackInvalidate(address)
+	return true, isDirty
+}
+
+func (cc *MsiCacheController) invalidateCache(address uint32, absoluteIndex int) {
+	cc.cacheStates[absoluteIndex] = msiInvalid
+	cc.evict(address)
+}
+
+func (cc *MsiCacheController) UpdateAccessStats(address uint32) {
+	index := cc.cache.GetIndexInArray(address)
+	switch cc.cacheStates[index] {
+	case msiModified:
+		cc.stats.NumAccessesToPrivateData++
+	case msiShared:
+		if cc.isShared[index] {
+			cc.stats.NumAccessesToSharedData++
+		} else {
+			cc.stats.NumAccessesToPrivateData++
+		}
+	default:
+		panic(cc.newError(nil, "accessed cache line is not valid"))
+	}
+}
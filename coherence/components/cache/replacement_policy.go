@@ -0,0 +1,307 @@
+package cache
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// ReplacementPolicy chooses the cache line to be evicted from a full cache set. The cache tells the policy about every
+// insertion and access so that it can keep its own bookkeeping. Ways are numbered from 0 to associativity - 1.
+type ReplacementPolicy interface {
+	OnInsert(set uint32, way int)
+	OnAccess(set uint32, way int)
+	// Return the way to be evicted from the given set. Every way of the set is valid. The same way must be returned
+	// until the next insertion into the set, since the cache controllers check the line to be evicted before the
+	// insertion happens.
+	GetVictim(set uint32) int
+	// Return the bookkeeping of the policy for the given line, e.g. its LRU timestamp, without changing it.
+	DescribeLine(set uint32, way int) string
+}
+
+type ReplacementPolicyType int
+
+const (
+	Lru ReplacementPolicyType = iota
+	Fifo
+	Random
+	TreePlru
+	Lfu
+	Srrip
+)
+
+var replacementPolicyNames = [...]string{"LRU", "FIFO", "Random", "PLRU", "LFU", "SRRIP"}
+
+func (p ReplacementPolicyType) String() string {
+	return replacementPolicyNames[p]
+}
+
+func (p ReplacementPolicyType) IsValid() bool {
+	return p >= 0 && int(p) < len(replacementPolicyNames)
+}
+
+func (p ReplacementPolicyType) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *ReplacementPolicyType) UnmarshalText(text []byte) error {
+	for i, name := range replacementPolicyNames {
+		if name == string(text) {
+			*p = ReplacementPolicyType(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid replacement policy %s", text)
+}
+
+type ReplacementConfig struct {
+	Policy ReplacementPolicyType `json:"policy"`
+	Seed   int64                 `json:"seed"` // Only used by the random policy
+}
+
+func newReplacementPolicy(config ReplacementConfig, numSets uint32, associativity int) ReplacementPolicy {
+	numLines := int(numSets) * associativity
+	switch config.Policy {
+	case Lru:
+		return &lruPolicy{numSets: numSets, associativity: associativity, lastUsed: make([]int64, numLines)}
+	case Fifo:
+		return &fifoPolicy{numSets: numSets, associativity: associativity, insertedAt: make([]int64, numLines)}
+	case Random:
+		return newRandomPolicy(numSets, associativity, config.Seed)
+	case TreePlru:
+		return newTreePlruPolicy(numSets, associativity)
+	case Lfu:
+		return &lfuPolicy{numSets: numSets, associativity: associativity, counts: make([]int, numLines)}
+	case Srrip:
+		return &srripPolicy{numSets: numSets, associativity: associativity, rrpvs: make([]uint8, numLines)}
+	default:
+		panic(fmt.Sprintf("unknown replacement policy %d", config.Policy))
+	}
+}
+
+// Evict the line which was used least recently.
+type lruPolicy struct {
+	numSets       uint32
+	associativity int
+	lastUsed      []int64 // Indexed the same way as the cache array
+	counter       int64
+}
+
+func (p *lruPolicy) OnInsert(set uint32, way int) {
+	p.OnAccess(set, way)
+}
+
+func (p *lruPolicy) OnAccess(set uint32, way int) {
+	p.counter++
+	p.lastUsed[getLineIndex(p.numSets, set, way)] = p.counter
+}
+
+func (p *lruPolicy) GetVictim(set uint32) int {
+	return getWayWithLeast(p.numSets, p.associativity, set, p.lastUsed)
+}
+
+func (p *lruPolicy) DescribeLine(set uint32, way int) string {
+	return fmt.Sprintf("last used %d", p.lastUsed[getLineIndex(p.numSets, set, way)])
+}
+
+// Evict the line which was inserted first, regardless of the accesses to it.
+type fifoPolicy struct {
+	numSets       uint32
+	associativity int
+	insertedAt    []int64
+	counter       int64
+}
+
+func (p *fifoPolicy) OnInsert(set uint32, way int) {
+	p.counter++
+	p.insertedAt[getLineIndex(p.numSets, set, way)] = p.counter
+}
+
+func (p *fifoPolicy) OnAccess(set uint32, way int) {}
+
+func (p *fifoPolicy) GetVictim(set uint32) int {
+	return getWayWithLeast(p.numSets, p.associativity, set, p.insertedAt)
+}
+
+func (p *fifoPolicy) DescribeLine(set uint32, way int) string {
+	return fmt.Sprintf("inserted %d", p.insertedAt[getLineIndex(p.numSets, set, way)])
+}
+
+// Evict a line chosen at random. The victim of a set is drawn when a line is inserted into the set, so that it stays
+// the same until the next insertion.
+type randomPolicy struct {
+	associativity int
+	rng           *rand.Rand
+	victims       []int // Indexed by set
+}
+
+func newRandomPolicy(numSets uint32, associativity int, seed int64) *randomPolicy {
+	p := &randomPolicy{
+		associativity: associativity,
+		rng:           rand.New(rand.NewSource(seed)),
+		victims:       make([]int, numSets),
+	}
+	for i := range p.victims {
+		p.victims[i] = p.rng.Intn(associativity)
+	}
+	return p
+}
+
+func (p *randomPolicy) OnInsert(set uint32, way int) {
+	p.victims[set] = p.rng.Intn(p.associativity)
+}
+
+func (p *randomPolicy) OnAccess(set uint32, way int) {}
+
+func (p *randomPolicy) GetVictim(set uint32) int {
+	return p.victims[set]
+}
+
+func (p *randomPolicy) DescribeLine(set uint32, way int) string {
+	return describeVictim(way == p.victims[set])
+}
+
+// Tree pseudo-LRU keeps a binary tree of associativity - 1 bits per set. Each bit points to the half of its subtree
+// which was used less recently, and the victim is found by following the bits from the root.
+type treePlruPolicy struct {
+	associativity int
+	bits          []bool // associativity - 1 bits per set. true means the right half was used less recently
+}
+
+func newTreePlruPolicy(numSets uint32, associativity int) *treePlruPolicy {
+	if associativity&(associativity-1) != 0 {
+		panic(fmt.Sprintf("tree PLRU needs the associativity to be a power of 2, got %d", associativity))
+	}
+	return &treePlruPolicy{associativity: associativity, bits: make([]bool, int(numSets)*(associativity-1))}
+}
+
+func (p *treePlruPolicy) OnInsert(set uint32, way int) {
+	p.OnAccess(set, way)
+}
+
+// Make every bit on the path to the way point away from it.
+func (p *treePlruPolicy) OnAccess(set uint32, way int) {
+	bits := p.getBits(set)
+	node, low, high := 0, 0, p.associativity
+	for high-low > 1 {
+		mid := (low + high) / 2
+		if way < mid {
+			bits[node] = true
+			node, high = 2*node+1, mid
+		} else {
+			bits[node] = false
+			node, low = 2*node+2, mid
+		}
+	}
+}
+
+func (p *treePlruPolicy) GetVictim(set uint32) int {
+	bits := p.getBits(set)
+	node, low, high := 0, 0, p.associativity
+	for high-low > 1 {
+		mid := (low + high) / 2
+		if bits[node] {
+			node, low = 2*node+2, mid
+		} else {
+			node, high = 2*node+1, mid
+		}
+	}
+	return low
+}
+
+func (p *treePlruPolicy) DescribeLine(set uint32, way int) string {
+	return describeVictim(way == p.GetVictim(set))
+}
+
+func (p *treePlruPolicy) getBits(set uint32) []bool {
+	numBits := p.associativity - 1
+	return p.bits[int(set)*numBits : int(set+1)*numBits]
+}
+
+// Evict the line which was used the least number of times since it was inserted. Ties are broken by the lowest way.
+type lfuPolicy struct {
+	numSets       uint32
+	associativity int
+	counts        []int
+}
+
+func (p *lfuPolicy) OnInsert(set uint32, way int) {
+	p.counts[getLineIndex(p.numSets, set, way)] = 1
+}
+
+func (p *lfuPolicy) OnAccess(set uint32, way int) {
+	p.counts[getLineIndex(p.numSets, set, way)]++
+}
+
+func (p *lfuPolicy) GetVictim(set uint32) int {
+	victim := 0
+	for way := 1; way < p.associativity; way++ {
+		if p.counts[getLineIndex(p.numSets, set, way)] < p.counts[getLineIndex(p.numSets, set, victim)] {
+			victim = way
+		}
+	}
+	return victim
+}
+
+func (p *lfuPolicy) DescribeLine(set uint32, way int) string {
+	return fmt.Sprintf("%d uses", p.counts[getLineIndex(p.numSets, set, way)])
+}
+
+const srripMaxRrpv uint8 = 3 // 2-bit re-reference prediction values
+
+// Static re-reference interval prediction. Lines are inserted with a long re-reference interval and promoted to a
+// near-immediate one on a hit. The victim is a line with a distant re-reference interval, all the lines of the set
+// are aged until there is one.
+type srripPolicy struct {
+	numSets       uint32
+	associativity int
+	rrpvs         []uint8
+}
+
+func (p *srripPolicy) OnInsert(set uint32, way int) {
+	p.rrpvs[getLineIndex(p.numSets, set, way)] = srripMaxRrpv - 1
+}
+
+func (p *srripPolicy) OnAccess(set uint32, way int) {
+	p.rrpvs[getLineIndex(p.numSets, set, way)] = 0
+}
+
+func (p *srripPolicy) GetVictim(set uint32) int {
+	for {
+		for way := 0; way < p.associativity; way++ {
+			if p.rrpvs[getLineIndex(p.numSets, set, way)] == srripMaxRrpv {
+				return way
+			}
+		}
+		for way := 0; way < p.associativity; way++ {
+			p.rrpvs[getLineIndex(p.numSets, set, way)]++
+		}
+	}
+}
+
+// GetVictim ages the lines of the set, so it cannot be used to describe a line.
+func (p *srripPolicy) DescribeLine(set uint32, way int) string {
+	return fmt.Sprintf("RRPV %d", p.rrpvs[getLineIndex(p.numSets, set, way)])
+}
+
+// For the policies which only know the next victim of a set.
+func describeVictim(isVictim bool) string {
+	if isVictim {
+		return "next victim"
+	}
+	return ""
+}
+
+// The lines of a set are spread across the cache array, see Cache.getAbsoluteIndex.
+func getLineIndex(numSets uint32, set uint32, way int) int {
+	return int(set) + way*int(numSets)
+}
+
+func getWayWithLeast(numSets uint32, associativity int, set uint32, values []int64) int {
+	victim := 0
+	for way := 1; way < associativity; way++ {
+		if values[getLineIndex(numSets, set, way)] < values[getLineIndex(numSets, set, victim)] {
+			victim = way
+		}
+	}
+	return victim
+}
@@ -0,0 +1,154 @@
+package cache
+
+import (
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/values"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/xact"
+)
+
+// Track the values of the words of the cache lines. The protocols do not know about the values: they are carried
+// around the callbacks of the protocol registered with registerOnBus, and attached to the transactions sent.
+func (cc *BaseCacheController) EnableValueTracking(tracker *values.Tracker) {
+	cc.values = tracker
+	cc.lineValues = make([][]uint32, len(cc.cache.cacheArray))
+	for i := range cc.lineValues {
+		cc.lineValues[i] = tracker.NewBlock()
+	}
+	cc.updatedWords = make([]bool, cc.cache.blockSizeInWords)
+}
+
+// Register the snooping and the back invalidation callbacks of the protocol on the bus.
+func (cc *BaseCacheController) registerOnBus(onSnoop xact.SnoopingCallBack, backInvalidate xact.BackInvalidateCallBack) {
+	cc.bus.RegisterSnoopingCallBack(func(transaction xact.Transaction) {
+		snoop := func(transaction xact.Transaction) { cc.snoop(transaction, onSnoop) }
+		if cc.values == nil {
+			snoop(transaction)
+			return
+		}
+		cc.snoopWithValues(transaction, snoop)
+	})
+
+	cc.backInvalidate = func(address uint32) (bool, bool) {
+		if cc.values == nil {
+			return backInvalidate(address)
+		}
+
+		lineValues := cc.getLineValues(address)
+		hadCopy, wasDirty := backInvalidate(address)
+		if wasDirty {
+			cc.values.WriteMemory(address, lineValues)
+		}
+		return hadCopy, wasDirty
+	}
+	cc.bus.RegisterBackInvalidate(func(address uint32) (bool, bool) {
+		if cc.isHoldingBus && cc.cache.isSamePrefix(address, cc.requestedAddress) {
+			return cc.deferBackInvalidate(address)
+		}
+		return cc.backInvalidate(address)
+	})
+}
+
+// The values of the line are saved before the protocol handles the transaction, since it may invalidate the line
+// before sending the block in its reply. The line takes the values of the block received once the protocol has
+// inserted it, except for the words updated by a BusUpd snooped after the request, which are newer.
+func (cc *BaseCacheController) snoopWithValues(transaction xact.Transaction, snoop xact.SnoopingCallBack) {
+	lineValues := cc.getLineValues(transaction.Address)
+	isOwnStore := transaction.TransactionType == xact.BusUpd && transaction.SenderId == cc.id &&
+		cc.isWriteRequest && cc.cache.isSamePrefix(transaction.Address, cc.requestedAddress)
+
+	snoop(transaction)
+
+	reply := &cc.transactionToSendWhenReplying
+	isBlockReply := reply.TransactionType == xact.Flush || reply.TransactionType == xact.FlushOpt
+	if cc.needToReply && isBlockReply && reply.Values == nil && lineValues != nil &&
+		cc.cache.isSamePrefix(reply.Address, transaction.Address) {
+		reply.Values = lineValues
+	}
+
+	// The pending line still gets the block once it is invalidated, since the access is done on it.
+	index := cc.cache.GetIndexInArray(transaction.Address)
+	if index == -1 || !(cc.getLineState(index).IsValid || cc.isPendingLine(transaction.Address)) {
+		return
+	}
+
+	if isOwnStore {
+		cc.performStore(index)
+		return
+	}
+
+	if transaction.Values == nil || transaction.SenderId == cc.id {
+		return
+	}
+	if transaction.TransactionType == xact.BusUpd {
+		wordIndex := cc.values.GetWordIndex(transaction.Address)
+		cc.lineValues[index][wordIndex] = transaction.Values[0]
+		if cc.isDataPending && cc.isPendingLine(transaction.Address) {
+			cc.updatedWords[wordIndex] = true
+		}
+	} else if cc.isOwnTransaction(transaction) &&
+		cc.cache.isSamePrefix(transaction.Address, cc.currentTransaction.Address) {
+		for i, value := range transaction.Values {
+			if !cc.updatedWords[i] {
+				cc.lineValues[index][i] = value
+			}
+			cc.updatedWords[i] = false
+		}
+	}
+}
+
+// Attach the values of the block sent to the transaction. A BusUpd only carries the value of the word written by the
+// current write request, so that it does not overwrite the other words with the values they had when it was granted.
+func (cc *BaseCacheController) attachValues(transaction xact.Transaction) xact.Transaction {
+	if cc.values == nil || transaction.Values != nil {
+		return transaction
+	}
+
+	switch transaction.TransactionType {
+	case xact.Flush, xact.FlushOpt:
+		transaction.Values = cc.getLineValues(transaction.Address)
+	case xact.BusUpd:
+		if cc.isWriteRequest && cc.cache.isSamePrefix(transaction.Address, cc.requestedAddress) {
+			transaction.Values = []uint32{cc.storeValue}
+		}
+	}
+	return transaction
+}
+
+// Perform the load or the store of the completed request on the values of its cache line.
+func (cc *BaseCacheController) accessValues() {
+	index := cc.cache.GetIndexInArray(cc.requestedAddress)
+	if index == -1 {
+		panic(cc.newError(nil, "requested block is not in the cache when the request completes"))
+	}
+
+	if cc.isWriteRequest {
+		cc.performStore(index)
+		return
+	}
+
+	value := cc.lineValues[index][cc.values.GetWordIndex(cc.requestedAddress)]
+	if err := cc.values.CheckLoad(cc.id, cc.requestedAddress, value); err != nil {
+		panic(err)
+	}
+}
+
+// The store is visible to the other caches once it is performed, which is when its BusUpd is snooped in update
+// protocols, before the request completes.
+func (cc *BaseCacheController) performStore(index int) {
+	if cc.isStorePerformed {
+		return
+	}
+	cc.lineValues[index][cc.values.GetWordIndex(cc.requestedAddress)] = cc.storeValue
+	cc.values.OnStore(cc.requestedAddress, cc.storeValue)
+	cc.isStorePerformed = true
+}
+
+// Return a copy of the values of the line of the address, or nil if the block is not cached.
+func (cc *BaseCacheController) getLineValues(address uint32) []uint32 {
+	index := cc.cache.GetIndexInArray(address)
+	if index == -1 {
+		return nil
+	}
+	lineValues := make([]uint32, len(cc.lineValues[index]))
+	copy(lineValues, cc.lineValues[index])
+	return lineValues
+}
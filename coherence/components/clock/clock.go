@@ -0,0 +1,22 @@
+/*
+Package clock implements a Clock struct which gives the current cycle of a simulation to every component.
+*/
+package clock
+
+// The cycle is the same for every component during a cycle. Only the simulator advances it, once every component has
+// executed the cycle.
+type Clock struct {
+	cycle int
+}
+
+func NewClock() *Clock {
+	return &Clock{}
+}
+
+func (c *Clock) GetCycle() int {
+	return c.cycle
+}
+
+func (c *Clock) Advance(numCycles int) {
+	c.cycle += numCycles
+}
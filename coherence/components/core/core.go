@@ -5,14 +5,13 @@ package core
 
 import (
 	"bufio"
-	"errors"
 	"fmt"
 	"io"
-	"os"
 
 	"github.com/chriskheng/cs4223-assignment2/coherence/components/cache"
+	"github.com/chriskheng/cs4223-assignment2/coherence/constants"
+	"github.com/chriskheng/cs4223-assignment2/coherence/simerror"
 	"github.com/chriskheng/cs4223-assignment2/coherence/stats"
-	"github.com/chriskheng/cs4223-assignment2/coherence/utils"
 )
 
 type Core struct {
@@ -22,6 +21,8 @@ type Core struct {
 	state   CoreState
 	counter int
 	stats   CoreStats
+	line    int // Number of the last line read from the trace
+	retired int // Number of instructions completed
 }
 
 type CoreStats struct {
@@ -50,16 +51,20 @@ const (
 	OthersOp = "2"
 )
 
-func NewCore(index int, inputFilePrefix string, cache cache.CacheController) *Core {
-	f, err := os.Open(fmt.Sprintf("%s_%d.data", inputFilePrefix, index))
-	utils.Check(err)
+// The trace is read as the core executes it.
+func NewCore(index int, trace io.Reader, cache cache.CacheController) *Core {
+	return &Core{cache: cache, reader: bufio.NewReader(trace), index: index, state: Ready}
+}
 
-	reader := bufio.NewReader(f)
-	return &Core{cache: cache, reader: reader, index: index, state: Ready}
+// Return the name of the trace file of the core with the given index.
+func GetTraceFileName(inputFilePrefix string, index int) string {
+	return fmt.Sprintf("%s_%d.data", inputFilePrefix, index)
 }
 
 func (core *Core) Execute() {
 	if core.state == Done {
+		// The cache controller still has to reply to the transactions it snoops, e.g. to supply a dirty block.
+		core.cache.Execute()
 		return
 	}
 
@@ -68,6 +73,7 @@ func (core *Core) Execute() {
 		core.stats.NumComputeCycles++
 		if core.counter == 0 {
 			core.state = Ready
+			core.retired++
 		}
 	} else if core.state == MemoryState {
 		core.stats.NumIdleCycles++
@@ -75,14 +81,18 @@ func (core *Core) Execute() {
 		line, err := core.reader.ReadString('\n')
 		if err != nil {
 			if err != io.EOF {
-				fmt.Fprintln(os.Stderr, err.Error())
+				panic(&simerror.TraceError{CoreId: core.index, Err: err})
 			}
 			core.state = Done
+			core.cache.Execute()
 			return
 		}
+		core.line++
 
 		inst, err := parseInstruction(line)
-		utils.Check(err)
+		if err != nil {
+			panic(&simerror.TraceError{CoreId: core.index, Line: core.line, Err: err})
+		}
 
 		if inst.iType == othersOp {
 			cycles := inst.value
@@ -90,6 +100,8 @@ func (core *Core) Execute() {
 			if cycles > 1 {
 				core.counter = int(cycles) - 1
 				core.state = ComputeState
+			} else {
+				core.retired++
 			}
 			core.stats.NumComputeCycles++
 		} else if inst.iType == loadOp {
@@ -101,15 +113,43 @@ func (core *Core) Execute() {
 			core.state = MemoryState
 			core.stats.NumStores++
 		} else {
-			panic(errors.New("unknown operation type"))
+			panic(core.newError("unknown operation type at line %d of the trace", core.line))
 		}
 	}
 
-	// fmt.Printf("Core %d is in %d state\n", core.index, core.state)
-
 	core.cache.Execute()
 }
 
+// Return the number of next cycles in which the core and its cache controller only count cycles: the remaining
+// cycles of a computation, or every cycle while the core waits for its cache or is done.
+func (core *Core) GetNumIdleCycles() int {
+	numIdleCycles := constants.IdleForever
+	if core.state == ComputeState {
+		numIdleCycles = core.counter
+	} else if core.state == Ready {
+		numIdleCycles = 0
+	}
+
+	if cacheIdleCycles := core.cache.GetNumIdleCycles(); cacheIdleCycles < numIdleCycles {
+		numIdleCycles = cacheIdleCycles
+	}
+	return numIdleCycles
+}
+
+// Advance by the given number of cycles, which must be idle cycles, with the same statistics as executing them.
+func (core *Core) SkipIdleCycles(numCycles int) {
+	if core.state == ComputeState {
+		core.counter -= numCycles
+		core.stats.NumComputeCycles += numCycles
+		if core.counter == 0 {
+			core.state = Ready
+			core.retired++
+		}
+	} else if core.state == MemoryState {
+		core.stats.NumIdleCycles += numCycles
+	}
+}
+
 func (core *Core) GetStatistics() stats.Stats {
 	cacheControllerStats := core.cache.GetStats()
 	return stats.Stats{
@@ -121,16 +161,51 @@ func (core *Core) GetStatistics() stats.Stats {
 		NumAccessesToSharedData:  cacheControllerStats.NumAccessesToSharedData,
 		NumCacheMisses:           cacheControllerStats.NumCacheMisses,
 		NumCacheAccesses:         cacheControllerStats.NumCacheAccesses,
+		NumEvictions:             cacheControllerStats.NumEvictions,
 	}
 }
 
+func (core *Core) GetCache() cache.CacheController {
+	return core.cache
+}
+
 func (core *Core) IsDone() bool {
 	return core.state == Done
 }
 
+func (core *Core) GetState() CoreState {
+	return core.state
+}
+
+func (core *Core) IsComputing() bool {
+	return core.state == ComputeState
+}
+
+func (core *Core) GetNumRetiredInstructions() int {
+	return core.retired
+}
+
+// Write the state of the core and of its cache controller.
+func (core *Core) WriteState(w io.Writer) {
+	fmt.Fprintf(w, "core %d: %s, %d instructions retired, trace line %d", core.index, core.state, core.retired,
+		core.line)
+	if core.state == ComputeState {
+		fmt.Fprintf(w, ", %d cycles left to compute", core.counter)
+	}
+	fmt.Fprintf(w, "\n  cache %d: %s\n", core.index, core.cache.GetStateDescription())
+}
+
 func (core *Core) OnRequestComplete() {
 	if core.state != MemoryState {
-		panic("onRequestComplete should only be called when the core is in the memory state")
+		panic(core.newError("request completes when the core is not waiting for one"))
 	}
 	core.state = Ready
+	core.retired++
+}
+
+func (core *Core) newError(format string, a ...interface{}) *simerror.Error {
+	err := simerror.New("core", nil, format, a...)
+	err.Id = core.index
+	err.ControllerState = core.state.String()
+	return err
 }
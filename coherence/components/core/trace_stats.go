@@ -0,0 +1,46 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// TraceStats describes the trace of a core, independently of the simulated system.
+type TraceStats struct {
+	NumLoads         int
+	NumStores        int
+	NumOthers        int // Number of instructions which are neither loads nor stores
+	NumComputeCycles int // Cycles of the other instructions
+	BlocksAccessed   map[uint32]bool
+	BlocksWritten    map[uint32]bool
+}
+
+// Read the whole trace and return its statistics. The blocks accessed are identified by their address divided by
+// the given block size in bytes.
+func ReadTraceStats(reader io.Reader, blockSize int) (TraceStats, error) {
+	stats := TraceStats{BlocksAccessed: map[uint32]bool{}, BlocksWritten: map[uint32]bool{}}
+	scanner := bufio.NewScanner(reader)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		inst, err := parseInstruction(scanner.Text())
+		if err != nil {
+			return TraceStats{}, fmt.Errorf("line %d: %s", lineNumber, err.Error())
+		}
+
+		block := inst.value / uint32(blockSize)
+		switch inst.iType {
+		case loadOp:
+			stats.NumLoads++
+			stats.BlocksAccessed[block] = true
+		case storeOp:
+			stats.NumStores++
+			stats.BlocksAccessed[block] = true
+			stats.BlocksWritten[block] = true
+		case othersOp:
+			stats.NumOthers++
+			stats.NumComputeCycles += int(inst.value)
+		}
+	}
+
+	return stats, scanner.Err()
+}
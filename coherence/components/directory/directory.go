@@ -0,0 +1,362 @@
+/*
+Package directory implements a Directory struct which simulates the directory of directory-based MESI cache coherence.
+
+The directory sits next to memory and keeps a full bit-vector of sharers for every block. Requests are served one at a
+time per block: once the directory has started serving a request for a block, other requests for that block wait
+until the requester sends Unblock (and, for a forwarded BusRead, until the previous owner has written the block back).
+*/
+package directory
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/clock"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/network"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/xact"
+	"github.com/chriskheng/cs4223-assignment2/coherence/constants"
+	"github.com/chriskheng/cs4223-assignment2/coherence/simerror"
+)
+
+type Directory struct {
+	id               int
+	numCores         int
+	network          *network.Network
+	clock            *clock.Clock
+	offsetNumBits    uint32
+	blockSizeInWords uint32
+	memLatency       int
+	entries          map[uint32]*entry // Key is the block address
+	requestQueue     []xact.Transaction
+	pendingMemReads  []memRead
+	stats            DirectoryStats
+}
+
+type entry struct {
+	state            entryState
+	sharers          []bool // Full bit-vector, indexed by cache id
+	owner            int
+	isBusy           bool
+	pendingResponses int // Number of Unblock and WriteBackData to receive before the entry is not busy anymore
+}
+
+type entryState int
+
+const (
+	uncached entryState = iota
+	shared
+	exclusive // Owned by a single cache in either Exclusive or Modified state
+)
+
+func (s entryState) String() string {
+	return [...]string{"Uncached", "Shared", "Exclusive"}[s]
+}
+
+type memRead struct {
+	readyCycle int
+	reply      xact.Transaction
+}
+
+type DirectoryStats struct {
+	NumLookups        int
+	NumTwoHopMisses   int // Served by the directory alone
+	NumThreeHopMisses int // Needed the owner to forward the block or other sharers to be invalidated
+	NumInvalidations  int
+	NumWriteBacks     int // Number of blocks written back to memory
+}
+
+// blockSize is in bytes. The id of the directory is the id used by the caches to send transactions to it. memLatency
+// is the number of cycles needed to read a block from memory.
+func NewDirectory(id int, numCores int, network *network.Network, blockSize int, memLatency int,
+	clock *clock.Clock) *Directory {
+	directory := &Directory{
+		id:               id,
+		numCores:         numCores,
+		network:          network,
+		clock:            clock,
+		offsetNumBits:    uint32(math.Log2(float64(blockSize))),
+		blockSizeInWords: uint32(blockSize) / constants.WordSize,
+		memLatency:       memLatency,
+		entries:          map[uint32]*entry{},
+	}
+	network.RegisterReceiver(id, directory.OnReceive)
+	return directory
+}
+
+func (d *Directory) OnReceive(transaction xact.Transaction) {
+	switch transaction.TransactionType {
+	case xact.BusRead, xact.BusReadX, xact.BusUpgr, xact.PutM, xact.PutE:
+		d.requestQueue = append(d.requestQueue, transaction)
+	case xact.Unblock:
+		d.onResponse(transaction)
+	case xact.WriteBackData:
+		if transaction.SendDataSize > 0 {
+			d.stats.NumWriteBacks++
+		}
+		d.onResponse(transaction)
+	default:
+		panic(d.newError(transaction, "unexpected transaction"))
+	}
+}
+
+func (d *Directory) Execute() {
+	for len(d.pendingMemReads) > 0 && d.pendingMemReads[0].readyCycle <= d.clock.GetCycle() {
+		d.network.Send(d.pendingMemReads[0].reply)
+		d.pendingMemReads = d.pendingMemReads[1:]
+	}
+
+	// Serve at most one request per cycle, skipping requests for blocks that are busy.
+	for i, request := range d.requestQueue {
+		if d.getEntry(request.Address).isBusy {
+			continue
+		}
+		d.requestQueue = append(d.requestQueue[:i], d.requestQueue[i+1:]...)
+		d.serve(request)
+		return
+	}
+}
+
+// Return the number of next cycles in which Execute does nothing: no request can be served since their blocks are
+// busy until a response is received, and no memory read is done.
+func (d *Directory) GetNumIdleCycles() int {
+	for _, request := range d.requestQueue {
+		if e, ok := d.entries[request.Address>>d.offsetNumBits]; !ok || !e.isBusy {
+			return 0
+		}
+	}
+
+	if len(d.pendingMemReads) == 0 {
+		return constants.IdleForever
+	}
+	if d.pendingMemReads[0].readyCycle <= d.clock.GetCycle() {
+		return 0
+	}
+	return d.pendingMemReads[0].readyCycle - d.clock.GetCycle()
+}
+
+// Write the busy entries, the requests waiting to be served and the memory reads in progress.
+func (d *Directory) WriteState(w io.Writer) {
+	busyAddresses := []uint32{}
+	for blockAddress, e := range d.entries {
+		if e.isBusy {
+			busyAddresses = append(busyAddresses, blockAddress)
+		}
+	}
+	sort.Slice(busyAddresses, func(i, j int) bool { return busyAddresses[i] < busyAddresses[j] })
+
+	fmt.Fprintf(w, "directory: %d busy entries, %d requests waiting, %d memory reads\n", len(busyAddresses),
+		len(d.requestQueue), len(d.pendingMemReads))
+	for _, blockAddress := range busyAddresses {
+		e := d.entries[blockAddress]
+		fmt.Fprintf(w, "  block 0x%x: %s, %d responses to receive\n", blockAddress<<d.offsetNumBits,
+			describeEntry(e), e.pendingResponses)
+	}
+	for _, request := range d.requestQueue {
+		fmt.Fprintf(w, "  request waiting: %s\n", simerror.FormatTransaction(request))
+	}
+	for _, read := range d.pendingMemReads {
+		fmt.Fprintf(w, "  memory read: %s done in cycle %d\n", simerror.FormatTransaction(read.reply),
+			read.readyCycle)
+	}
+}
+
+func (d *Directory) GetStatistics() DirectoryStats {
+	return d.stats
+}
+
+func (d *Directory) serve(request xact.Transaction) {
+	d.stats.NumLookups++
+	e := d.getEntry(request.Address)
+	requester := request.SenderId
+
+	switch request.TransactionType {
+	case xact.BusRead:
+		d.serveBusRead(e, request)
+	case xact.BusUpgr:
+		if e.state != shared || !e.sharers[requester] {
+			// The copy of the requester was invalidated before the directory got the upgrade request.
+			d.serveBusReadX(e, request)
+			return
+		}
+		numAcks := d.invalidateSharers(e, request)
+		d.send(xact.UpgrAck, request.Address, requester, requester, 0, numAcks)
+		d.setOwner(e, requester)
+		d.block(e, 1)
+		d.recordHops(numAcks > 0)
+	case xact.BusReadX:
+		d.serveBusReadX(e, request)
+	case xact.PutM, xact.PutE:
+		if e.state == exclusive && e.owner == requester {
+			if request.TransactionType == xact.PutM {
+				d.stats.NumWriteBacks++
+			}
+			e.state = uncached
+			e.owner = -1
+		} else {
+			// The block was forwarded to another cache before the directory got the put request.
+			e.sharers[requester] = false
+			if e.state == shared && !hasSharers(e) {
+				e.state = uncached
+			}
+		}
+		d.send(xact.PutAck, request.Address, requester, requester, 0, 0)
+	}
+}
+
+func (d *Directory) serveBusRead(e *entry, request xact.Transaction) {
+	requester := request.SenderId
+
+	switch e.state {
+	case exclusive:
+		if e.owner == requester {
+			panic(d.newError(request, "cache sends BusRead for a block which it owns"))
+		}
+		// The owner sends the block to the requester and writes it back to the directory.
+		d.send(xact.FwdBusRead, request.Address, e.owner, requester, 0, 0)
+		e.state = shared
+		e.sharers[e.owner] = true
+		e.sharers[requester] = true
+		e.owner = -1
+		d.block(e, 2)
+		d.recordHops(true)
+	case shared:
+		e.sharers[requester] = true
+		d.readMemory(xact.Data, request.Address, requester, 0)
+		d.block(e, 1)
+		d.recordHops(false)
+	case uncached:
+		d.setOwner(e, requester)
+		d.readMemory(xact.DataExclusive, request.Address, requester, 0)
+		d.block(e, 1)
+		d.recordHops(false)
+	}
+}
+
+func (d *Directory) serveBusReadX(e *entry, request xact.Transaction) {
+	requester := request.SenderId
+
+	switch e.state {
+	case exclusive:
+		if e.owner == requester {
+			panic(d.newError(request, "cache sends BusReadX for a block which it owns"))
+		}
+		d.send(xact.FwdBusReadX, request.Address, e.owner, requester, 0, 0)
+		d.recordHops(true)
+	case shared:
+		numAcks := d.invalidateSharers(e, request)
+		d.readMemory(xact.Data, request.Address, requester, numAcks)
+		d.recordHops(numAcks > 0)
+	case uncached:
+		d.readMemory(xact.Data, request.Address, requester, 0)
+		d.recordHops(false)
+	}
+	d.setOwner(e, requester)
+	d.block(e, 1)
+}
+
+// Send Inv to every sharer other than the requester and return the number of Inv sent.
+func (d *Directory) invalidateSharers(e *entry, request xact.Transaction) int {
+	numAcks := 0
+	for i, isSharer := range e.sharers {
+		if isSharer && i != request.SenderId {
+			d.send(xact.Inv, request.Address, i, request.SenderId, 0, 0)
+			numAcks++
+		}
+	}
+	d.stats.NumInvalidations += numAcks
+	return numAcks
+}
+
+func (d *Directory) setOwner(e *entry, owner int) {
+	e.state = exclusive
+	e.owner = owner
+	for i := range e.sharers {
+		e.sharers[i] = false
+	}
+}
+
+func (d *Directory) block(e *entry, numResponses int) {
+	e.isBusy = true
+	e.pendingResponses = numResponses
+}
+
+func (d *Directory) onResponse(transaction xact.Transaction) {
+	e := d.getEntry(transaction.Address)
+	if !e.isBusy {
+		panic(d.newError(transaction, "response is received for a block which is not busy"))
+	}
+
+	e.pendingResponses--
+	if e.pendingResponses == 0 {
+		e.isBusy = false
+	}
+}
+
+func (d *Directory) recordHops(isThreeHop bool) {
+	if isThreeHop {
+		d.stats.NumThreeHopMisses++
+	} else {
+		d.stats.NumTwoHopMisses++
+	}
+}
+
+func (d *Directory) readMemory(transactionType xact.TransactionType, address uint32, receiverId int, numAcks int) {
+	d.pendingMemReads = append(d.pendingMemReads, memRead{
+		readyCycle: d.clock.GetCycle() + d.memLatency,
+		reply: xact.Transaction{
+			TransactionType: transactionType,
+			Address:         address,
+			SendDataSize:    d.blockSizeInWords,
+			SenderId:        d.id,
+			ReceiverId:      receiverId,
+			RequesterId:     receiverId,
+			NumAcks:         numAcks,
+		},
+	})
+}
+
+func (d *Directory) send(transactionType xact.TransactionType, address uint32, receiverId int, requesterId int,
+	sendDataSize uint32, numAcks int) {
+	d.network.Send(xact.Transaction{
+		TransactionType: transactionType,
+		Address:         address,
+		SendDataSize:    sendDataSize,
+		SenderId:        d.id,
+		ReceiverId:      receiverId,
+		RequesterId:     requesterId,
+		NumAcks:         numAcks,
+	})
+}
+
+func (d *Directory) getEntry(address uint32) *entry {
+	blockAddress := address >> d.offsetNumBits
+	e, ok := d.entries[blockAddress]
+	if !ok {
+		e = &entry{state: uncached, sharers: make([]bool, d.numCores), owner: -1}
+		d.entries[blockAddress] = e
+	}
+	return e
+}
+
+// Return an error describing the directory entry of the block of the given transaction.
+func (d *Directory) newError(transaction xact.Transaction, format string, a ...interface{}) *simerror.Error {
+	err := simerror.New("directory", &transaction, format, a...)
+	err.SetAddress(transaction.Address >> d.offsetNumBits << d.offsetNumBits)
+	err.ControllerState = describeEntry(d.getEntry(transaction.Address))
+	return err
+}
+
+func describeEntry(e *entry) string {
+	return fmt.Sprintf("%s, owner %d, sharers %v, busy %t", e.state, e.owner, e.sharers, e.isBusy)
+}
+
+func hasSharers(e *entry) bool {
+	for _, isSharer := range e.sharers {
+		if isSharer {
+			return true
+		}
+	}
+	return false
+}
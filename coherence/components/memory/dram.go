@@ -0,0 +1,98 @@
+package memory
+
+// DramConfig describes the banks of the DRAM behind the bus. RowSize is in bytes and must be a multiple of the block
+// size. The latencies are in cycles.
+type DramConfig struct {
+	NumBanks         int  `json:"banks"`
+	RowSize          int  `json:"row_size"`
+	IsOpenPage       bool `json:"open_page"`       // An open page policy leaves a row open after an access
+	IsRowInterleaved bool `json:"row_interleaved"` // Consecutive rows, not blocks, are in different banks
+	CasLatency       int  `json:"cas"`             // Cycles to read or write a block of the open row
+	RcdLatency       int  `json:"rcd"`             // Cycles to open a row
+	PrechargeLatency int  `json:"precharge"`       // Cycles to close the open row
+}
+
+// Dram simulates the timing of the banks only. Each bank serves its accesses one at a time in the order they arrive,
+// so an access may wait for the previous ones to the same bank.
+type Dram struct {
+	config    DramConfig
+	blockSize int
+	banks     []bank
+	stats     DramStats
+}
+
+type bank struct {
+	isRowOpen      bool
+	openRow        uint32
+	busyUntilCycle int
+}
+
+type DramStats struct {
+	NumAccesses           int
+	NumRowBufferHits      int
+	NumRowBufferConflicts int // Accesses which had to close another open row first
+	NumLatencyCycles      int // Including the cycles waiting for the bank
+}
+
+// blockSize is in bytes.
+func NewDram(config DramConfig, blockSize int) *Dram {
+	return &Dram{
+		config:    config,
+		blockSize: blockSize,
+		banks:     make([]bank, config.NumBanks),
+	}
+}
+
+// Access the block of the given address in the given cycle and return the number of cycles until it is done.
+func (d *Dram) Access(address uint32, cycle int) int {
+	bankIndex, row := d.getBankAndRow(address)
+	b := &d.banks[bankIndex]
+
+	start := cycle
+	if b.busyUntilCycle > start {
+		start = b.busyUntilCycle
+	}
+
+	latency := d.config.CasLatency
+	if b.isRowOpen && b.openRow == row {
+		d.stats.NumRowBufferHits++
+	} else {
+		if b.isRowOpen {
+			d.stats.NumRowBufferConflicts++
+			latency += d.config.PrechargeLatency
+		}
+		latency += d.config.RcdLatency
+	}
+
+	doneCycle := start + latency
+	if d.config.IsOpenPage {
+		b.isRowOpen = true
+		b.openRow = row
+		b.busyUntilCycle = doneCycle
+	} else {
+		// The row is closed right after the access, which keeps the bank busy but is off the critical path.
+		b.isRowOpen = false
+		b.busyUntilCycle = doneCycle + d.config.PrechargeLatency
+	}
+
+	d.stats.NumAccesses++
+	d.stats.NumLatencyCycles += doneCycle - cycle
+	return doneCycle - cycle
+}
+
+func (d *Dram) GetStatistics() DramStats {
+	return d.stats
+}
+
+// The row returned is the index of the row within its bank.
+func (d *Dram) getBankAndRow(address uint32) (int, uint32) {
+	numBanks := uint32(d.config.NumBanks)
+	if d.config.IsRowInterleaved {
+		globalRow := address / uint32(d.config.RowSize)
+		return int(globalRow % numBanks), globalRow / numBanks
+	}
+
+	block := address / uint32(d.blockSize)
+	blocksPerRow := uint32(d.config.RowSize / d.blockSize)
+	return int(block % numBanks), block / numBanks / blocksPerRow
+}
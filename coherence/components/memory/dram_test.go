@@ -0,0 +1,120 @@
+package memory
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/testutils"
+)
+
+type dramAccess struct {
+	address uint32
+	cycle   int
+	latency int // Expected number of cycles until the access is done
+}
+
+type dramTest struct {
+	name             string
+	isOpenPage       bool
+	isRowInterleaved bool
+	accesses         []dramAccess
+	numHits          int
+	numConflicts     int
+}
+
+// 2 banks of rows of 4 blocks of 16 bytes. Opening a row takes 20 cycles, reading it 10 and closing it 30. The
+// accesses far apart in time don't wait for the bank.
+var dramTests = []dramTest{
+	{
+		name:       "open page, row hit then row conflict",
+		isOpenPage: true,
+		accesses: []dramAccess{
+			{address: 0x0, cycle: 0, latency: 30},
+			{address: 0x20, cycle: 100, latency: 10},  // Same row of bank 0
+			{address: 0x100, cycle: 200, latency: 60}, // Row 2 of bank 0
+		},
+		numHits:      1,
+		numConflicts: 1,
+	},
+	{
+		name: "closed page, every access opens its row",
+		accesses: []dramAccess{
+			{address: 0x0, cycle: 0, latency: 30},
+			{address: 0x20, cycle: 100, latency: 30},
+			{address: 0x100, cycle: 200, latency: 30},
+		},
+	},
+	{
+		name:       "open page, an access waits for the previous one to its bank",
+		isOpenPage: true,
+		accesses: []dramAccess{
+			{address: 0x0, cycle: 0, latency: 30},
+			{address: 0x20, cycle: 0, latency: 40},
+			{address: 0x10, cycle: 0, latency: 30}, // Bank 1
+		},
+		numHits: 1,
+	},
+	{
+		name: "closed page, the bank is busy closing the row",
+		accesses: []dramAccess{
+			{address: 0x0, cycle: 0, latency: 30},
+			{address: 0x20, cycle: 40, latency: 50},
+		},
+	},
+	{
+		name:       "block interleaving, consecutive blocks are in different banks",
+		isOpenPage: true,
+		accesses: []dramAccess{
+			{address: 0x0, cycle: 0, latency: 30},
+			{address: 0x10, cycle: 100, latency: 30},
+			{address: 0x20, cycle: 200, latency: 10},
+			{address: 0x30, cycle: 300, latency: 10},
+		},
+		numHits: 2,
+	},
+	{
+		name:             "row interleaving, consecutive rows are in different banks",
+		isOpenPage:       true,
+		isRowInterleaved: true,
+		accesses: []dramAccess{
+			{address: 0x0, cycle: 0, latency: 30},
+			{address: 0x30, cycle: 100, latency: 10},
+			{address: 0x40, cycle: 200, latency: 30},
+			{address: 0x80, cycle: 300, latency: 60},
+		},
+		numHits:      1,
+		numConflicts: 1,
+	},
+}
+
+func TestDramAccess(t *testing.T) {
+	for _, test := range dramTests {
+		dram := NewDram(DramConfig{
+			NumBanks:         2,
+			RowSize:          64,
+			IsOpenPage:       test.isOpenPage,
+			IsRowInterleaved: test.isRowInterleaved,
+			CasLatency:       10,
+			RcdLatency:       20,
+			PrechargeLatency: 30,
+		}, 16)
+
+		for i, access := range test.accesses {
+			latency := dram.Access(access.address, access.cycle)
+			if latency != access.latency {
+				identifier := fmt.Sprintf("latency of access %d to 0x%x (%s)", i, access.address, test.name)
+				t.Errorf(testutils.GetErrorString(identifier, fmt.Sprint(access.latency), fmt.Sprint(latency)))
+			}
+		}
+
+		stats := dram.GetStatistics()
+		if stats.NumAccesses != len(test.accesses) || stats.NumRowBufferHits != test.numHits ||
+			stats.NumRowBufferConflicts != test.numConflicts {
+			expected := fmt.Sprintf("%d accesses, %d hits, %d conflicts", len(test.accesses), test.numHits,
+				test.numConflicts)
+			got := fmt.Sprintf("%d accesses, %d hits, %d conflicts", stats.NumAccesses, stats.NumRowBufferHits,
+				stats.NumRowBufferConflicts)
+			t.Errorf(testutils.GetErrorString(fmt.Sprintf("statistics (%s)", test.name), expected, got))
+		}
+	}
+}
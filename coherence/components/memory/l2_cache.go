@@ -0,0 +1,110 @@
+package memory
+
+import (
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/bus"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/cache"
+)
+
+// L2Config describes a last-level cache shared by every core, sitting between the bus and memory.
+// CacheSize and BlockSize are in bytes. Latency is the number of cycles needed to access the L2 cache. An inclusive L2
+// cache invalidates the L1 copies of the blocks it evicts.
+type L2Config struct {
+	CacheSize     int                     `json:"size"`
+	Associativity int                     `json:"associativity"`
+	BlockSize     int                     `json:"block_size"`
+	Latency       int                     `json:"latency"`
+	IsInclusive   bool                    `json:"inclusive"`
+	Replacement   cache.ReplacementConfig `json:"replacement"`
+}
+
+// L2Cache only keeps the tags of the blocks, the data itself is not simulated. A block is allocated on every miss,
+// whether it is a read or a write back from an L1 cache. Dirty blocks are written back to memory when they are
+// evicted, which is assumed to be done by a write buffer off the critical path.
+type L2Cache struct {
+	cache       cache.Cache
+	isDirty     []bool
+	config      L2Config
+	l1BlockSize int
+	bus         *bus.Bus
+	readMemory  func(address uint32) int // Return the number of cycles needed to read the block from memory
+	stats       L2Stats
+}
+
+type L2Stats struct {
+	NumAccesses          int
+	NumMisses            int
+	NumBackInvalidations int // Number of L1 copies invalidated because the L2 cache evicts their block
+	NumWriteBacks        int // Number of blocks written back to memory by the L2 cache
+}
+
+// l1BlockSize is in bytes and must not be larger than the block size of the L2 cache.
+func NewL2Cache(config L2Config, l1BlockSize int, bus *bus.Bus, readMemory func(address uint32) int) *L2Cache {
+	l2 := &L2Cache{
+		cache: cache.NewCacheDsWithPolicy(config.BlockSize, config.Associativity, config.CacheSize,
+			config.Replacement),
+		config:      config,
+		l1BlockSize: l1BlockSize,
+		bus:         bus,
+		readMemory:  readMemory,
+	}
+	l2.isDirty = make([]bool, config.CacheSize/config.BlockSize)
+	return l2
+}
+
+// Read the block of the given address and return the number of cycles needed.
+func (l2 *L2Cache) Read(address uint32) int {
+	l2.stats.NumAccesses++
+	if l2.cache.Access(address) {
+		return l2.config.Latency
+	}
+
+	l2.stats.NumMisses++
+	l2.allocate(address)
+	return l2.config.Latency + l2.readMemory(address)
+}
+
+// Write the block of the given address and return the number of cycles needed. When the block of the L2 cache is
+// larger than the one written, the rest of the block has to be read from memory on a miss.
+func (l2 *L2Cache) Write(address uint32) int {
+	l2.stats.NumAccesses++
+	latency := l2.config.Latency
+	if !l2.cache.Access(address) {
+		l2.stats.NumMisses++
+		l2.allocate(address)
+		if l2.config.BlockSize > l2.l1BlockSize {
+			latency += l2.readMemory(address)
+		}
+	}
+
+	l2.isDirty[l2.cache.GetIndexInArray(address)] = true
+	return latency
+}
+
+func (l2 *L2Cache) GetStatistics() L2Stats {
+	return l2.stats
+}
+
+func (l2 *L2Cache) allocate(address uint32) {
+	isEvicted, evictedAddress, index := l2.cache.Insert(address)
+	if isEvicted {
+		l2.evict(evictedAddress, l2.isDirty[index])
+	}
+	l2.isDirty[index] = false
+}
+
+// An inclusive L2 cache has to invalidate every L1 block within the evicted block. A dirty L1 copy is written back
+// to memory together with the block.
+func (l2 *L2Cache) evict(address uint32, isDirty bool) {
+	if l2.config.IsInclusive {
+		blockAddress := address &^ uint32(l2.config.BlockSize-1)
+		for offset := 0; offset < l2.config.BlockSize; offset += l2.l1BlockSize {
+			numInvalidated, isL1CopyDirty := l2.bus.BackInvalidate(blockAddress + uint32(offset))
+			l2.stats.NumBackInvalidations += numInvalidated
+			isDirty = isDirty || isL1CopyDirty
+		}
+	}
+
+	if isDirty {
+		l2.stats.NumWriteBacks++
+	}
+}
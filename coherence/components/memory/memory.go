@@ -4,69 +4,137 @@ Package memory implements a Memory struct to simulate a physical memory.
 package memory
 
 import (
+	"fmt"
+	"io"
+
 	"github.com/chriskheng/cs4223-assignment2/coherence/components/bus"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/clock"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/values"
 	"github.com/chriskheng/cs4223-assignment2/coherence/components/xact"
+	"github.com/chriskheng/cs4223-assignment2/coherence/constants"
+	"github.com/chriskheng/cs4223-assignment2/coherence/simerror"
 )
 
 type Memory struct {
-	bus                   *bus.Bus
-	counter               int
-	state                 MemoryState
-	addressBeingProcessed uint32
-	dataSizeInWords       uint32
-	id                    int
-}
-
-type MemoryState int
-
-const (
-	Ready MemoryState = iota
-	PrepareToReadResult
-	PrepareToWriteResult
-	ReadingResult
-	WritingResult
-)
+	bus               *bus.Bus
+	clock             *clock.Clock
+	id                int
+	isUpdatedOnBusUpd bool
+	latency           int
+	operations        []operation        // Sorted by the cycle they are done
+	pendingReads      []xact.Transaction // Reads snooped in this cycle, which memory serves unless a cache does
+	waitingReads      []waitingRead      // Reads waiting for write backs of their block, in the order snooped
+	blockSize         uint32
+	l2                *L2Cache        // nil if there is no L2 cache
+	dram              *Dram           // nil if every access takes the same number of cycles
+	values            *values.Tracker // nil if the values are not tracked
+}
+
+type Config struct {
+	Latency int         `json:"latency"` // Cycles needed to read or write a block without the DRAM model
+	Dram    *DramConfig `json:"dram"`    // nil if every access takes Latency cycles
+}
 
-const memLatency = 100
+// A read or a write of a block. Memory works on several of them at once, since a split-transaction bus may have
+// several outstanding requests.
+type operation struct {
+	reply      xact.Transaction
+	readyCycle int // Cycle in which the operation is done and replied
+}
+
+// On a split-transaction bus, a block may be read while a cache still has to flush it to another cache, in which case
+// memory only reads the block once it has snooped these write backs.
+type waitingRead struct {
+	request      xact.Transaction
+	requesterIds []int // Caches whose Flush of the block is not snooped yet
+}
 
-func NewMemory(id int, bus *bus.Bus) *Memory {
-	memory := &Memory{id: id, bus: bus}
+// blockSize is in bytes.
+func NewMemory(id int, bus *bus.Bus, config Config, blockSize int, clock *clock.Clock) *Memory {
+	memory := &Memory{id: id, bus: bus, clock: clock, latency: config.Latency, blockSize: uint32(blockSize)}
+	if config.Dram != nil {
+		memory.dram = NewDram(*config.Dram, blockSize)
+	}
 	memory.bus.RegisterSnoopingCallBack(memory.OnSnoop)
 	return memory
 }
 
+// Make memory write the updated block of every BusUpd it snoops, as needed by write-through update protocols such as
+// Firefly. The write is done in the background, like the write back of a dirty L2 block, so memory does not reply.
+func (m *Memory) EnableUpdateOnBusUpd() {
+	m.isUpdatedOnBusUpd = true
+}
+
+// Keep the values of the blocks written back and send them with the blocks read. The L2 cache and main memory are
+// seen as a single memory holding the values, since the caches only write back blocks which they modified.
+func (m *Memory) EnableValueTracking(tracker *values.Tracker) {
+	m.values = tracker
+}
+
+// Put a shared L2 cache in front of memory. The requests snooped on the bus are then served by the L2 cache, which
+// reads from memory on a miss. The DRAM then interleaves the blocks of the L2 cache across its banks. MUST be called
+// before memory snoops any request.
+func (m *Memory) AddL2Cache(config L2Config, l1BlockSize int) {
+	m.l2 = NewL2Cache(config, l1BlockSize, m.bus, m.accessMainMemory)
+	if m.dram != nil {
+		m.dram = NewDram(m.dram.config, config.BlockSize)
+	}
+}
+
+func (m *Memory) HasDram() bool {
+	return m.dram != nil
+}
+
+func (m *Memory) GetDramStatistics() DramStats {
+	return m.dram.GetStatistics()
+}
+
+func (m *Memory) HasL2Cache() bool {
+	return m.l2 != nil
+}
+
+func (m *Memory) GetL2Statistics() L2Stats {
+	return m.l2.GetStatistics()
+}
+
 func (m *Memory) Execute() {
-	switch m.state {
-	case PrepareToReadResult:
-		m.state = ReadingResult
-		m.counter = memLatency - 1
-	case PrepareToWriteResult:
-		m.state = WritingResult
-		m.counter = memLatency - 1
-	case ReadingResult:
-		m.counter--
-		if m.counter <= 0 {
-			transaction := xact.Transaction{
-				TransactionType: xact.MemReadDone,
-				Address:         m.addressBeingProcessed,
-				SendDataSize:    m.dataSizeInWords,
-				SenderId:        m.id,
-			}
-			m.bus.Reply(transaction)
-			m.state = Ready
-		}
-	case WritingResult:
-		m.counter--
-		if m.counter <= 0 {
-			transaction := xact.Transaction{
-				TransactionType: xact.MemWriteDone,
-				Address:         m.addressBeingProcessed,
-				SenderId:        m.id,
-			}
-			m.bus.Reply(transaction)
-			m.state = Ready
+	m.startPendingReads()
+	m.startWaitingReads()
+	for len(m.operations) > 0 && m.operations[0].readyCycle <= m.clock.GetCycle() {
+		m.bus.Reply(m.operations[0].reply)
+		m.operations = m.operations[1:]
+	}
+}
+
+// Return the number of next cycles in which Execute does nothing, which is until the first operation is done.
+func (m *Memory) GetNumIdleCycles() int {
+	if len(m.pendingReads) > 0 {
+		return 0
+	}
+	for _, read := range m.waitingReads {
+		if len(read.requesterIds) == 0 {
+			return 0
 		}
 	}
+	if len(m.operations) == 0 {
+		return constants.IdleForever
+	}
+	if m.operations[0].readyCycle <= m.clock.GetCycle() {
+		return 0
+	}
+	return m.operations[0].readyCycle - m.clock.GetCycle()
+}
+
+// Write the operations memory is working on, in the order they are done.
+func (m *Memory) WriteState(w io.Writer) {
+	fmt.Fprintf(w, "memory: %d operations\n", len(m.operations))
+	for _, op := range m.operations {
+		fmt.Fprintf(w, "  %s done in cycle %d\n", simerror.FormatTransaction(op.reply), op.readyCycle)
+	}
+	for _, read := range m.waitingReads {
+		fmt.Fprintf(w, "  %s waiting for the write backs to caches %v\n", simerror.FormatTransaction(read.request),
+			read.requesterIds)
+	}
 }
 
 func (m *Memory) OnSnoop(transaction xact.Transaction) {
@@ -74,21 +142,139 @@ func (m *Memory) OnSnoop(transaction xact.Transaction) {
 		return
 	}
 
-	// if transaction.TransactionType != xact.FlushOpt && m.state != Ready {
-	// 	panic(fmt.Sprintf("memory is in %d state when bus read is received", m.state))
-	// }
-
 	switch transaction.TransactionType {
 	case xact.BusRead, xact.BusReadX:
-		m.addressBeingProcessed = transaction.Address
-		m.dataSizeInWords = transaction.RequestedDataSize
-		m.state = PrepareToReadResult
+		// Memory snoops before the caches, so it only knows whether a cache supplies the block once the request
+		// is snooped by every cache.
+		m.pendingReads = append(m.pendingReads, transaction)
 	case xact.FlushOpt:
-		m.dataSizeInWords = 0
-		m.state = Ready
+		// A cache supplies the block instead, which memory usually knows before reading it.
+		m.cancelRead(transaction.RequesterId)
 	case xact.Flush:
-		m.addressBeingProcessed = transaction.Address
-		m.dataSizeInWords = 0
-		m.state = PrepareToWriteResult
+		m.cancelRead(transaction.RequesterId)
+		m.removeWaitedWriteBack(transaction)
+		m.writeValues(transaction)
+		m.addOperation(xact.MemWriteDone, transaction, 0, m.getWriteLatency(transaction.Address))
+	case xact.BusUpd:
+		if m.isUpdatedOnBusUpd {
+			m.writeValues(transaction)
+			m.getWriteLatency(transaction.Address)
+		}
+	}
+}
+
+// Read the blocks snooped in this cycle which no cache supplies, so that the L2 cache and the DRAM are only accessed
+// for the reads memory actually serves. Memory executes after the bus, in the cycle the requests are snooped.
+func (m *Memory) startPendingReads() {
+	for _, transaction := range m.pendingReads {
+		if m.bus.CheckWillSupply(transaction) {
+			continue
+		}
+		requesterIds := m.bus.GetPendingWriteBacks(transaction.Address)
+		if len(requesterIds) == 0 {
+			m.read(transaction)
+		} else {
+			m.waitingReads = append(m.waitingReads, waitingRead{request: transaction, requesterIds: requesterIds})
+		}
+	}
+	m.pendingReads = m.pendingReads[:0]
+}
+
+func (m *Memory) startWaitingReads() {
+	waitingReads := m.waitingReads[:0]
+	for _, read := range m.waitingReads {
+		if len(read.requesterIds) == 0 {
+			m.read(read.request)
+		} else {
+			waitingReads = append(waitingReads, read)
+		}
+	}
+	m.waitingReads = waitingReads
+}
+
+func (m *Memory) read(transaction xact.Transaction) {
+	m.addOperation(xact.MemReadDone, transaction, transaction.RequestedDataSize, m.getReadLatency(transaction.Address))
+}
+
+func (m *Memory) removeWaitedWriteBack(flush xact.Transaction) {
+	for i := range m.waitingReads {
+		read := &m.waitingReads[i]
+		if read.request.Address/m.blockSize != flush.Address/m.blockSize {
+			continue
+		}
+		for j, requesterId := range read.requesterIds {
+			if requesterId == flush.RequesterId {
+				read.requesterIds = append(read.requesterIds[:j], read.requesterIds[j+1:]...)
+				break
+			}
+		}
+	}
+}
+
+func (m *Memory) addOperation(replyType xact.TransactionType, transaction xact.Transaction, dataSizeInWords uint32,
+	latency int) {
+	toAdd := operation{
+		reply: xact.Transaction{
+			TransactionType: replyType,
+			Address:         transaction.Address,
+			SendDataSize:    dataSizeInWords,
+			SenderId:        m.id,
+			RequesterId:     transaction.RequesterId,
+		},
+		// The operation starts in the cycle the request is snooped.
+		readyCycle: m.clock.GetCycle() + latency - 1,
+	}
+	if m.values != nil && replyType == xact.MemReadDone {
+		toAdd.reply.Values = m.values.ReadMemory(transaction.Address)
+	}
+
+	i := len(m.operations)
+	for i > 0 && m.operations[i-1].readyCycle > toAdd.readyCycle {
+		i--
+	}
+	m.operations = append(m.operations, operation{})
+	copy(m.operations[i+1:], m.operations[i:])
+	m.operations[i] = toAdd
+}
+
+// A BusUpd only carries the value of the word written.
+func (m *Memory) writeValues(transaction xact.Transaction) {
+	if m.values == nil || transaction.Values == nil {
+		return
+	}
+	if transaction.TransactionType == xact.BusUpd {
+		m.values.WriteMemoryWord(transaction.Address, transaction.Values[0])
+	} else {
+		m.values.WriteMemory(transaction.Address, transaction.Values)
+	}
+}
+
+func (m *Memory) cancelRead(requesterId int) {
+	for i, op := range m.operations {
+		if op.reply.TransactionType == xact.MemReadDone && op.reply.RequesterId == requesterId {
+			m.operations = append(m.operations[:i], m.operations[i+1:]...)
+			return
+		}
+	}
+}
+
+func (m *Memory) getReadLatency(address uint32) int {
+	if m.l2 == nil {
+		return m.accessMainMemory(address)
+	}
+	return m.l2.Read(address)
+}
+
+func (m *Memory) getWriteLatency(address uint32) int {
+	if m.l2 == nil {
+		return m.accessMainMemory(address)
+	}
+	return m.l2.Write(address)
+}
+
+func (m *Memory) accessMainMemory(address uint32) int {
+	if m.dram == nil {
+		return m.latency
 	}
+	return m.dram.Access(address, m.clock.GetCycle())
 }
@@ -0,0 +1,81 @@
+package memory
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/bus"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/cache"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/clock"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/xact"
+	"github.com/chriskheng/cs4223-assignment2/coherence/constants"
+	"github.com/chriskheng/cs4223-assignment2/coherence/testutils"
+)
+
+// The DRAM and the L2 cache are only accessed for the reads memory serves, not for the ones a cache supplies.
+func TestReadSuppliedByCache(t *testing.T) {
+	for _, isSupplied := range []bool{false, true} {
+		clock := clock.NewClock()
+		bus := bus.NewBus(bus.Config{TransferCycles: 2, Width: 1}, 16, clock)
+		memory := NewMemory(constants.MemoryId, bus, Config{Latency: 100, Dram: &DramConfig{NumBanks: 1,
+			RowSize: 64, CasLatency: 10, RcdLatency: 20, PrechargeLatency: 30}}, 16, clock)
+		memory.AddL2Cache(L2Config{CacheSize: 256, Associativity: 2, BlockSize: 16, Latency: 5}, 16)
+		bus.RegisterWillSupply(func(request xact.Transaction) bool { return isSupplied })
+
+		memory.OnSnoop(xact.Transaction{TransactionType: xact.BusRead, Address: 0x40, RequestedDataSize: 4,
+			SenderId: 0, RequesterId: 0})
+		memory.Execute()
+
+		numExpected := 1
+		if isSupplied {
+			numExpected = 0
+		}
+		format := "%d L2 accesses, %d DRAM accesses, %d operations"
+		expected := fmt.Sprintf(format, numExpected, numExpected, numExpected)
+		got := fmt.Sprintf(format, memory.GetL2Statistics().NumAccesses, memory.GetDramStatistics().NumAccesses,
+			len(memory.operations))
+		if got != expected {
+			identifier := fmt.Sprintf("accesses (block supplied by a cache: %t)", isSupplied)
+			t.Errorf(testutils.GetErrorString(identifier, expected, got))
+		}
+	}
+}
+
+// An L2 cache of a single set of 2 ways reads 0x0, 0x10, 0x0 again, 0x20 and 0x0 again. The LRU policy evicts 0x10
+// for 0x20, while the FIFO policy evicts 0x0 so that the last read misses.
+func TestL2Replacement(t *testing.T) {
+	expectedMisses := map[cache.ReplacementPolicyType]int{cache.Lru: 3, cache.Fifo: 4}
+	for policy, expected := range expectedMisses {
+		l2 := NewL2Cache(L2Config{CacheSize: 32, Associativity: 2, BlockSize: 16, Latency: 5,
+			Replacement: cache.ReplacementConfig{Policy: policy}}, 16, nil, func(address uint32) int { return 100 })
+		for _, address := range []uint32{0x0, 0x10, 0x0, 0x20, 0x0} {
+			l2.Read(address)
+		}
+
+		if got := l2.GetStatistics().NumMisses; got != expected {
+			t.Errorf(testutils.GetErrorString(policy.String()+" misses", fmt.Sprint(expected), fmt.Sprint(got)))
+		}
+	}
+}
+
+// With an L2 cache of 32-byte blocks, the DRAM interleaves these blocks across its 2 banks. The misses of 0x0 and
+// 0x20 then access different banks at the same time, instead of 2 blocks of 16 bytes of the same bank.
+func TestDramBlocksOfL2Cache(t *testing.T) {
+	clock := clock.NewClock()
+	bus := bus.NewBus(bus.Config{TransferCycles: 2, Width: 1}, 16, clock)
+	memory := NewMemory(constants.MemoryId, bus, Config{Latency: 100, Dram: &DramConfig{NumBanks: 2, RowSize: 64,
+		IsOpenPage: true, CasLatency: 10, RcdLatency: 20, PrechargeLatency: 30}}, 16, clock)
+	memory.AddL2Cache(L2Config{CacheSize: 256, Associativity: 2, BlockSize: 32, Latency: 5}, 16)
+
+	for _, address := range []uint32{0x0, 0x20} {
+		memory.OnSnoop(xact.Transaction{TransactionType: xact.BusRead, Address: address, RequestedDataSize: 4,
+			SenderId: 0, RequesterId: 0})
+	}
+	memory.Execute()
+
+	expected := "2 accesses, 60 latency cycles"
+	stats := memory.GetDramStatistics()
+	if got := fmt.Sprintf("%d accesses, %d latency cycles", stats.NumAccesses, stats.NumLatencyCycles); got != expected {
+		t.Errorf(testutils.GetErrorString("DRAM accesses", expected, got))
+	}
+}
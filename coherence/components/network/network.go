@@ -0,0 +1,119 @@
+/*
+Package network implements a Network struct which simulates a point-to-point interconnect between the caches and the
+directory in directory-based cache coherence.
+*/
+package network
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/clock"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/xact"
+	"github.com/chriskheng/cs4223-assignment2/coherence/constants"
+	"github.com/chriskheng/cs4223-assignment2/coherence/simerror"
+)
+
+type Network struct {
+	config        Config
+	clock         *clock.Clock
+	receivers     map[int]xact.SnoopingCallBack
+	inFlight      []message // Sorted by arrival cycle, messages with the same arrival cycle are kept in the order they were sent
+	stats         NetworkStats
+	executedCycle int                     // Last cycle in which Execute was called
+	observers     []xact.SnoopingCallBack // Called with every transaction delivered
+}
+
+type message struct {
+	transaction  xact.Transaction
+	arrivalCycle int
+}
+
+type NetworkStats struct {
+	DataTraffic int // In Bytes
+	NumMessages int
+}
+
+type Config struct {
+	TransferCycles int `json:"transfer_cycles"` // Cycles needed to send a word. A control message takes as long as a word
+}
+
+func NewNetwork(config Config, clock *clock.Clock) *Network {
+	return &Network{config: config, clock: clock, receivers: map[int]xact.SnoopingCallBack{}, executedCycle: -1}
+}
+
+// Register the callback to be called with every transaction whose ReceiverId is the given id.
+func (n *Network) RegisterReceiver(id int, callback xact.SnoopingCallBack) {
+	n.receivers[id] = callback
+}
+
+// Register a callback to be called with every transaction after it is delivered to its receiver.
+func (n *Network) RegisterObserver(callback xact.SnoopingCallBack) {
+	n.observers = append(n.observers, callback)
+}
+
+func (n *Network) Send(transaction xact.Transaction) {
+	if _, ok := n.receivers[transaction.ReceiverId]; !ok {
+		panic(simerror.New("network", &transaction, "transaction is sent to an unknown receiver %d",
+			transaction.ReceiverId))
+	}
+
+	latency := n.config.TransferCycles
+	if transaction.SendDataSize > 0 {
+		latency = n.config.TransferCycles * int(transaction.SendDataSize)
+	}
+
+	// A message sent once the network has executed in the current cycle only starts its transfer in the next cycle.
+	startCycle := n.clock.GetCycle()
+	if n.executedCycle == startCycle {
+		startCycle++
+	}
+	toSend := message{transaction: transaction, arrivalCycle: startCycle + latency - 1}
+	i := len(n.inFlight)
+	for i > 0 && n.inFlight[i-1].arrivalCycle > toSend.arrivalCycle {
+		i--
+	}
+	n.inFlight = append(n.inFlight, message{})
+	copy(n.inFlight[i+1:], n.inFlight[i:])
+	n.inFlight[i] = toSend
+
+	n.stats.NumMessages++
+	n.stats.DataTraffic += int(transaction.SendDataSize) * int(constants.WordSize)
+}
+
+// Deliver every message that arrives in the current cycle.
+func (n *Network) Execute() {
+	n.executedCycle = n.clock.GetCycle()
+	for len(n.inFlight) > 0 && n.inFlight[0].arrivalCycle <= n.executedCycle {
+		toDeliver := n.inFlight[0]
+		n.inFlight = n.inFlight[1:]
+		n.receivers[toDeliver.transaction.ReceiverId](toDeliver.transaction)
+		for _, observer := range n.observers {
+			observer(toDeliver.transaction)
+		}
+	}
+}
+
+// Return the number of next cycles in which Execute does nothing, which is until the next message arrives.
+func (n *Network) GetNumIdleCycles() int {
+	if len(n.inFlight) == 0 {
+		return constants.IdleForever
+	}
+	if n.inFlight[0].arrivalCycle <= n.clock.GetCycle() {
+		return 0
+	}
+	return n.inFlight[0].arrivalCycle - n.clock.GetCycle()
+}
+
+// Write the messages in flight, in the order they arrive.
+func (n *Network) WriteState(w io.Writer) {
+	fmt.Fprintf(w, "network: %d messages in flight\n", len(n.inFlight))
+	for _, m := range n.inFlight {
+		fmt.Fprintf(w, "  %s to %d arrives in cycle %d\n", simerror.FormatTransaction(m.transaction),
+			m.transaction.ReceiverId, m.arrivalCycle)
+	}
+}
+
+func (n *Network) GetStatistics() NetworkStats {
+	return n.stats
+}
@@ -0,0 +1,98 @@
+/*
+Package values implements a Tracker struct which tracks the values of the words of memory, to check that every load
+returns the value of the last store to its word.
+
+The simulator otherwise only models timing. When the values are tracked, every store writes a unique value, and the
+blocks carry the values of their words through the caches, the bus transactions and memory.
+*/
+package values
+
+import (
+	"math"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/constants"
+	"github.com/chriskheng/cs4223-assignment2/coherence/simerror"
+)
+
+// Tracker gives every store a unique value, holds the values of the blocks in memory and checks the value returned by
+// every load. The stores to a word are ordered by the cycle they become visible to the other caches, i.e. when they
+// complete, or when their BusUpd is snooped in update protocols. A word never written has the initial value 0.
+type Tracker struct {
+	blockSizeInWords uint32
+	offsetNumBits    uint32
+	memory           map[uint32][]uint32 // Values of the words of the blocks in memory, by block address
+	lastStores       map[uint32]uint32   // Value of the last store to every word, by word address
+	writers          []int               // Id of the cache which stored every value
+}
+
+// blockSize is in bytes.
+func NewTracker(blockSize int) *Tracker {
+	return &Tracker{
+		blockSizeInWords: uint32(blockSize) / constants.WordSize,
+		offsetNumBits:    uint32(math.Log2(float64(blockSize))),
+		memory:           map[uint32][]uint32{},
+		lastStores:       map[uint32]uint32{},
+		writers:          []int{constants.MemoryId},
+	}
+}
+
+// Return a new value to be stored by the given cache.
+func (t *Tracker) NewValue(cacheId int) uint32 {
+	t.writers = append(t.writers, cacheId)
+	return uint32(len(t.writers) - 1)
+}
+
+// Record that the store of the value to the word of the address is visible to the other caches.
+func (t *Tracker) OnStore(address uint32, value uint32) {
+	t.lastStores[address/constants.WordSize] = value
+}
+
+// Return an error if the value loaded from the word of the address by the given cache is not the value of the last
+// store to the word.
+func (t *Tracker) CheckLoad(cacheId int, address uint32, value uint32) *simerror.StaleReadError {
+	expected := t.lastStores[address/constants.WordSize]
+	if value == expected {
+		return nil
+	}
+	return &simerror.StaleReadError{
+		CacheId:        cacheId,
+		Address:        address,
+		Value:          value,
+		ValueWriter:    t.writers[value],
+		Expected:       expected,
+		ExpectedWriter: t.writers[expected],
+	}
+}
+
+// Return the values of a block with the initial value in every word.
+func (t *Tracker) NewBlock() []uint32 {
+	return make([]uint32, t.blockSizeInWords)
+}
+
+// Return the index in its block of the word of the address.
+func (t *Tracker) GetWordIndex(address uint32) int {
+	return int(address/constants.WordSize) % int(t.blockSizeInWords)
+}
+
+// Return a copy of the values in memory of the block of the address.
+func (t *Tracker) ReadMemory(address uint32) []uint32 {
+	block := t.NewBlock()
+	copy(block, t.memory[t.getBlockAddress(address)])
+	return block
+}
+
+func (t *Tracker) WriteMemory(address uint32, values []uint32) {
+	block := t.NewBlock()
+	copy(block, values)
+	t.memory[t.getBlockAddress(address)] = block
+}
+
+func (t *Tracker) WriteMemoryWord(address uint32, value uint32) {
+	block := t.ReadMemory(address)
+	block[t.GetWordIndex(address)] = value
+	t.memory[t.getBlockAddress(address)] = block
+}
+
+func (t *Tracker) getBlockAddress(address uint32) uint32 {
+	return address >> t.offsetNumBits << t.offsetNumBits
+}
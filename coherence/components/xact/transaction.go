@@ -3,14 +3,18 @@ Package xact implements a Transaction struct to simulate a Bus transaction.
 */
 package xact
 
-import "time"
+import "fmt"
 
 type Transaction struct {
 	TransactionType   TransactionType
 	Address           uint32
-	RequestedDataSize uint32 // In words
-	SendDataSize      uint32 // Only set this if you want to send a block from a cache to another cache
-	SenderId          int    // MUST specify
+	RequestedDataSize uint32   // In words
+	SendDataSize      uint32   // Only set this if you want to send a block from a cache to another cache
+	SenderId          int      // MUST specify
+	ReceiverId        int      // Only for point-to-point transactions of directory-based coherence
+	RequesterId       int      // The id of the cache whose request is served. Set by the bus for bus transactions
+	NumAcks           int      // Only for point-to-point transactions, number of InvAck the requester must wait for
+	Values            []uint32 // Values of the words of the block sent, or of the word written by a BusUpd. Only set when the values are tracked
 }
 
 type TransactionType int
@@ -26,9 +30,44 @@ const (
 	Flush
 	BusUpd
 	UpdateDone
+	// The transactions below are only sent point-to-point in directory-based coherence.
+	Inv
+	InvAck
+	FwdBusRead
+	FwdBusReadX
+	Data
+	DataExclusive
+	UpgrAck
+	WriteBackData
+	PutM
+	PutE
+	PutAck
+	Unblock
 )
 
+var transactionTypeNames = [...]string{"Nil", "BusRead", "BusReadX", "BusUpgr", "MemReadDone", "MemWriteDone",
+	"FlushOpt", "Flush", "BusUpd", "UpdateDone", "Inv", "InvAck", "FwdBusRead", "FwdBusReadX", "Data",
+	"DataExclusive", "UpgrAck", "WriteBackData", "PutM", "PutE", "PutAck", "Unblock"}
+
+func (t TransactionType) String() string {
+	return transactionTypeNames[t]
+}
+
+func (t *TransactionType) UnmarshalText(text []byte) error {
+	for i, name := range transactionTypeNames {
+		if name == string(text) {
+			*t = TransactionType(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid transaction type %s", text)
+}
+
 type ReleaseBus func()
-type OnRequestGrantedCallBack func(timestamp time.Time) Transaction
+type OnRequestGrantedCallBack func(grantCycle int) Transaction // The grant cycle identifies the holder of the bus
+type GetTransactionCallBack func() Transaction
 type SnoopingCallBack func(transaction Transaction)
 type HasCopyCallBack func(address uint32) bool
+type WillSupplyCallBack func(request Transaction) bool
+type PendingWriteBacksCallBack func(address uint32) (requesterIds []int)
+type BackInvalidateCallBack func(address uint32) (hadCopy bool, wasDirty bool)
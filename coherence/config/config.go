@@ -0,0 +1,176 @@
+/*
+Package config implements a Config struct which describes a whole simulated system, and loads it from a JSON file.
+*/
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/bustrace"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/bus"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/cache"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/core"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/memory"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/network"
+	"github.com/chriskheng/cs4223-assignment2/coherence/stats"
+	"github.com/chriskheng/cs4223-assignment2/coherence/watchdog"
+)
+
+// Config is taken by the constructors of every simulator. The sizes are in bytes and the latencies in cycles. A word
+// is always constants.WordSize bytes, since the traces are made of word addresses.
+type Config struct {
+	Protocol       Protocol         `json:"protocol"`
+	TracePrefix    string           `json:"trace_prefix"`
+	NumCores       int              `json:"num_cores"` // 0 means one core for every trace file found
+	L1             CacheConfig      `json:"l1"`
+	L2             *memory.L2Config `json:"l2"` // nil if there is no L2 cache
+	Bus            bus.Config       `json:"bus"`
+	Network        network.Config   `json:"network"` // Only used by DirMESI
+	Memory         memory.Config    `json:"memory"`
+	CheckCoherence bool             `json:"check_coherence"` // Stop at the first violation of the coherence invariants
+	TrackValues    bool             `json:"track_values"`    // Stop at the first load which does not return the last store
+	Watchdog       watchdog.Config  `json:"watchdog"`        // Stop a simulation which makes no progress
+	BusTrace       bustrace.Config  `json:"bus_trace"`       // Write every event of the bus to a JSON Lines file
+}
+
+// CacheConfig describes the private cache of every core.
+type CacheConfig struct {
+	Size          int                     `json:"size"`
+	Associativity int                     `json:"associativity"`
+	BlockSize     int                     `json:"block_size"`
+	Replacement   cache.ReplacementConfig `json:"replacement"`
+}
+
+type Protocol int
+
+const (
+	Mesi Protocol = iota
+	Mesif
+	Dragon
+	Moesi
+	Firefly
+	Msi
+	DirMesi
+)
+
+var protocolNames = [...]string{"MESI", "MESIF", "Dragon", "MOESI", "Firefly", "MSI", "DirMESI"}
+
+func (p Protocol) String() string {
+	return protocolNames[p]
+}
+
+func (p Protocol) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *Protocol) UnmarshalText(text []byte) error {
+	for i, name := range protocolNames {
+		if name == string(text) {
+			*p = Protocol(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid protocol %s", text)
+}
+
+// Return the configuration used when it is not given, which has no L2 cache and no DRAM model.
+func Default() Config {
+	return Config{
+		Protocol: Mesi,
+		L1: CacheConfig{
+			Size:          4096,
+			Associativity: 2,
+			BlockSize:     32,
+			Replacement:   cache.ReplacementConfig{Policy: cache.Lru, Seed: 1},
+		},
+		Bus: bus.Config{
+			MaxOutstanding: 4,
+			Arbitration:    bus.ArbitrationConfig{Policy: bus.Fifo, Seed: 1},
+			TransferCycles: 2,
+			Width:          1,
+		},
+		Network:  network.Config{TransferCycles: 2},
+		Memory:   memory.Config{Latency: 100},
+		Watchdog: watchdog.Config{StallCycles: 1000000},
+	}
+}
+
+func DefaultL2() memory.L2Config {
+	return memory.L2Config{Associativity: 8, Latency: 10, IsInclusive: true,
+		Replacement: cache.ReplacementConfig{Policy: cache.Lru, Seed: 1}}
+}
+
+func DefaultDram() memory.DramConfig {
+	return memory.DramConfig{
+		RowSize:          2048,
+		IsOpenPage:       true,
+		CasLatency:       40,
+		RcdLatency:       40,
+		PrechargeLatency: 40,
+	}
+}
+
+// Load the configuration from a JSON file. The fields missing from the file keep their default values, except in
+// the l2 and memory.dram objects which have to be complete. The configuration is not validated.
+func Load(path string) (Config, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Config{}, err
+	}
+	defer file.Close()
+
+	config := Default()
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return Config{}, fmt.Errorf("%s: %s", path, err.Error())
+	}
+
+	// The block size of the L2 cache defaults to the block size of the L1 caches.
+	if config.L2 != nil && config.L2.BlockSize == 0 {
+		config.L2.BlockSize = config.L1.BlockSize
+	}
+	return config, nil
+}
+
+// Set the number of cores to the number of trace files found if it is not given. Return true if it is set.
+func (c *Config) DiscoverNumCores() (bool, error) {
+	numFiles := countTraceFiles(c.TracePrefix)
+	if c.NumCores > 0 {
+		if numFiles < c.NumCores {
+			return false, fmt.Errorf("trace file %s is not found", core.GetTraceFileName(c.TracePrefix, numFiles))
+		}
+		return false, nil
+	}
+
+	if numFiles == 0 {
+		return false, fmt.Errorf("trace file %s is not found", core.GetTraceFileName(c.TracePrefix, 0))
+	}
+	c.NumCores = numFiles
+	return true, nil
+}
+
+// Return the number of consecutive trace files, starting from index 0, that exist for the given prefix.
+func countTraceFiles(tracePrefix string) int {
+	numFiles := 0
+	for {
+		if _, err := os.Stat(core.GetTraceFileName(tracePrefix, numFiles)); err != nil {
+			return numFiles
+		}
+		numFiles++
+	}
+}
+
+// Return the description of the simulated system given in the reports of its results.
+func (c Config) GetRunInfo() stats.RunInfo {
+	return stats.RunInfo{
+		Protocol:      c.Protocol.String(),
+		Trace:         c.TracePrefix,
+		NumCores:      c.NumCores,
+		CacheSize:     c.L1.Size,
+		Associativity: c.L1.Associativity,
+		BlockSize:     c.L1.BlockSize,
+	}
+}
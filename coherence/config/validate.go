@@ -0,0 +1,227 @@
+package config
+
+import (
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/bus"
+	"github.com/chriskheng/cs4223-assignment2/coherence/constants"
+)
+
+// ValidationError names the field of the configuration which is invalid, the same way as in a configuration file,
+// e.g. l2.block_size.
+type ValidationError struct {
+	Field  string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Field + " " + e.Reason
+}
+
+func newValidationError(field string, reason string) *ValidationError {
+	return &ValidationError{Field: field, Reason: reason}
+}
+
+// Return a *ValidationError for the first invalid field found. The number of cores must have been discovered. The
+// trace prefix is not checked, since the traces may be given another way.
+func (c Config) Validate() error {
+	if c.NumCores < 1 {
+		return newValidationError("num_cores", "needs to be a positive integer")
+	}
+
+	checks := []func() error{c.validateL1, c.validateBus, c.validateL2, c.validateMemory}
+	for _, check := range checks {
+		if err := check(); err != nil {
+			return err
+		}
+	}
+
+	if c.Network.TransferCycles < 1 {
+		return newValidationError("network.transfer_cycles", "needs to be a positive integer")
+	}
+
+	if c.TrackValues && c.Protocol == DirMesi {
+		return newValidationError("track_values", "is not supported by DirMESI")
+	}
+
+	if c.Watchdog.StallCycles < 0 {
+		return newValidationError("watchdog.stall_cycles", "cannot be negative")
+	}
+
+	if c.Watchdog.MaxCycles < 0 {
+		return newValidationError("watchdog.max_cycles", "cannot be negative")
+	}
+
+	return c.validateBusTrace()
+}
+
+func (c Config) validateBusTrace() error {
+	busTrace := c.BusTrace
+	if busTrace.File != "" && c.Protocol == DirMesi {
+		return newValidationError("bus_trace.file", "is not supported by DirMESI")
+	}
+
+	if busTrace.FromCycle < 0 {
+		return newValidationError("bus_trace.from_cycle", "cannot be negative")
+	}
+
+	if busTrace.ToCycle < 0 {
+		return newValidationError("bus_trace.to_cycle", "cannot be negative")
+	}
+
+	if busTrace.ToCycle > 0 && busTrace.ToCycle < busTrace.FromCycle {
+		return newValidationError("bus_trace.to_cycle", "needs to be at least bus_trace.from_cycle")
+	}
+
+	return nil
+}
+
+func (c Config) validateL1() error {
+	l1 := c.L1
+	if !isPowerOfTwo(l1.Size) {
+		return newValidationError("l1.size", "needs to be power of 2")
+	}
+
+	if !isPowerOfTwo(l1.Associativity) {
+		return newValidationError("l1.associativity", "needs to be power of 2")
+	}
+
+	if !isPowerOfTwo(l1.BlockSize) {
+		return newValidationError("l1.block_size", "needs to be power of 2")
+	}
+
+	if l1.BlockSize < int(constants.WordSize) {
+		return newValidationError("l1.block_size", "needs to be at least the word size")
+	}
+
+	if l1.Size%l1.BlockSize != 0 {
+		return newValidationError("l1.size", "needs to be divisible by l1.block_size")
+	}
+
+	if (l1.Size/l1.BlockSize)%l1.Associativity != 0 {
+		return newValidationError("l1.associativity",
+			"needs to divide the number of cache blocks (l1.size / l1.block_size)")
+	}
+
+	if !l1.Replacement.Policy.IsValid() {
+		return newValidationError("l1.replacement.policy", "is not a replacement policy")
+	}
+
+	return nil
+}
+
+func (c Config) validateBus() error {
+	b := c.Bus
+	if c.Protocol == DirMesi {
+		if b.IsSplitTransaction {
+			return newValidationError("bus.split_transaction", "is not supported by DirMESI which does not use a bus")
+		}
+		if b.Arbitration.Policy != bus.Fifo {
+			return newValidationError("bus.arbitration.policy", "is not supported by DirMESI which does not use a bus")
+		}
+	}
+
+	if b.IsSplitTransaction && b.MaxOutstanding < 1 {
+		return newValidationError("bus.max_outstanding", "needs to be a positive integer")
+	}
+
+	if b.TransferCycles < 2 {
+		return newValidationError("bus.transfer_cycles", "needs to be at least 2")
+	}
+
+	if b.Width < 1 {
+		return newValidationError("bus.width", "needs to be a positive integer")
+	}
+
+	return nil
+}
+
+func (c Config) validateL2() error {
+	l2 := c.L2
+	if l2 == nil {
+		return nil
+	}
+
+	if c.Protocol == DirMesi {
+		return newValidationError("l2", "is not supported by DirMESI")
+	}
+
+	if !isPowerOfTwo(l2.CacheSize) {
+		return newValidationError("l2.size", "needs to be power of 2")
+	}
+
+	if !isPowerOfTwo(l2.Associativity) {
+		return newValidationError("l2.associativity", "needs to be power of 2")
+	}
+
+	if !isPowerOfTwo(l2.BlockSize) {
+		return newValidationError("l2.block_size", "needs to be power of 2")
+	}
+
+	if l2.BlockSize < c.L1.BlockSize {
+		return newValidationError("l2.block_size", "needs to be at least l1.block_size")
+	}
+
+	if l2.CacheSize%l2.BlockSize != 0 {
+		return newValidationError("l2.size", "needs to be divisible by l2.block_size")
+	}
+
+	if (l2.CacheSize/l2.BlockSize)%l2.Associativity != 0 {
+		return newValidationError("l2.associativity",
+			"needs to divide the number of L2 cache blocks (l2.size / l2.block_size)")
+	}
+
+	if l2.Latency < 1 {
+		return newValidationError("l2.latency", "needs to be a positive integer")
+	}
+
+	if !l2.Replacement.Policy.IsValid() {
+		return newValidationError("l2.replacement.policy", "is not a replacement policy")
+	}
+
+	return nil
+}
+
+func (c Config) validateMemory() error {
+	if c.Memory.Latency < 1 {
+		return newValidationError("memory.latency", "needs to be a positive integer")
+	}
+
+	dram := c.Memory.Dram
+	if dram == nil {
+		return nil
+	}
+
+	if c.Protocol == DirMesi {
+		return newValidationError("memory.dram", "is not supported by DirMESI")
+	}
+
+	if dram.NumBanks < 1 {
+		return newValidationError("memory.dram.banks", "needs to be a positive integer")
+	}
+
+	// The DRAM is accessed by the blocks of the L2 cache if there is one.
+	blockSize, blockSizeField := c.L1.BlockSize, "l1.block_size"
+	if c.L2 != nil {
+		blockSize, blockSizeField = c.L2.BlockSize, "l2.block_size"
+	}
+	if dram.RowSize < blockSize || dram.RowSize%blockSize != 0 {
+		return newValidationError("memory.dram.row_size", "needs to be a multiple of "+blockSizeField)
+	}
+
+	if dram.CasLatency < 1 {
+		return newValidationError("memory.dram.cas", "needs to be a positive integer")
+	}
+
+	if dram.RcdLatency < 0 {
+		return newValidationError("memory.dram.rcd", "cannot be negative")
+	}
+
+	if dram.PrechargeLatency < 0 {
+		return newValidationError("memory.dram.precharge", "cannot be negative")
+	}
+
+	return nil
+}
+
+func isPowerOfTwo(value int) bool {
+	return value > 0 && value&(value-1) == 0
+}
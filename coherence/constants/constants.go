@@ -3,5 +3,10 @@ Package constants contains program constants.
 */
 package constants
 
-const NumCores int = 4
+import "math"
+
+const MemoryId int = -1   // Sender id of memory and the directory. Cores and their caches use ids 0 to number of cores - 1.
 const WordSize uint32 = 4 // In Bytes, power of 2
+
+// Number of idle cycles of a component which does nothing until another component acts, e.g. memory without requests.
+const IdleForever int = math.MaxInt32
@@ -0,0 +1,196 @@
+package debugger
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/constants"
+	"github.com/chriskheng/cs4223-assignment2/coherence/stats"
+)
+
+type command struct {
+	name        string
+	alias       string
+	usage       string
+	description string
+	execute     func(d *Debugger, args []string) error
+}
+
+var commands []command
+
+func init() {
+	// Assigned in init since help refers to commands.
+	commands = []command{
+		{"step", "s", "step [N]", "Simulate N cycles, 1 by default", step},
+		{"continue", "c", "continue", "Simulate until a breakpoint is hit or the simulation is done", continueRun},
+		{"until", "u", "until cycle N | " + conditionUsage, "Simulate until the cycle or until the condition holds",
+			until},
+		{"break", "b", "break " + conditionUsage, "Set a breakpoint", setBreakpoint},
+		{"breakpoints", "", "breakpoints", "List the breakpoints", listBreakpoints},
+		{"delete", "d", "delete ID", "Delete a breakpoint", deleteBreakpoint},
+		{"set", "", "set CORE SET | set CORE 0xADDRESS",
+			"Print the lines of a cache set, or of the set of the address, with their tag, state and replacement " +
+				"bookkeeping, e.g. their LRU timestamp", printSet},
+		{"bus", "", "bus", "Print the state of the bus and its queue, or of the network and the directory", printBus},
+		{"cores", "", "cores", "Print the state of the cores and of their cache controllers", printCores},
+		{"state", "", "state", "Print the state of the whole system", printState},
+		{"stats", "", "stats", "Print the statistics so far", printStats},
+		{"help", "h", "help", "Print this help", printHelp},
+		{"quit", "q", "quit", "Exit the debugger", nil},
+	}
+}
+
+func (d *Debugger) execute(args []string) error {
+	for _, c := range commands {
+		if args[0] == c.name || args[0] == c.alias {
+			return c.execute(d, args[1:])
+		}
+	}
+	return fmt.Errorf("unknown command %s, type help for the commands", args[0])
+}
+
+func step(d *Debugger, args []string) error {
+	numCycles := 1
+	if len(args) > 1 {
+		return errors.New("usage: step [N]")
+	}
+	if len(args) == 1 {
+		var err error
+		if numCycles, err = strconv.Atoi(args[0]); err != nil || numCycles <= 0 {
+			return fmt.Errorf("invalid number of cycles %s", args[0])
+		}
+	}
+	return d.advance(numCycles, nil)
+}
+
+func continueRun(d *Debugger, args []string) error {
+	return d.advance(constants.IdleForever, nil)
+}
+
+func until(d *Debugger, args []string) error {
+	if len(args) > 0 && args[0] == "cycle" {
+		cycle := 0
+		if len(args) == 2 {
+			cycle, _ = strconv.Atoi(args[1])
+		}
+		if cycle <= d.sim.GetCycle() {
+			return fmt.Errorf("usage: until cycle N, with N after the current cycle %d", d.sim.GetCycle())
+		}
+		return d.advance(cycle-d.sim.GetCycle(), nil)
+	}
+
+	c, err := d.parseCondition(args)
+	if err != nil {
+		return err
+	}
+	return d.advance(constants.IdleForever, &c)
+}
+
+func setBreakpoint(d *Debugger, args []string) error {
+	c, err := d.parseCondition(args)
+	if err != nil {
+		return err
+	}
+	d.breakpoints = append(d.breakpoints, breakpoint{id: d.nextId, condition: c})
+	fmt.Fprintf(d.out, "breakpoint %d: %s\n", d.nextId, c)
+	d.nextId++
+	return nil
+}
+
+func listBreakpoints(d *Debugger, args []string) error {
+	if len(d.breakpoints) == 0 {
+		fmt.Fprintln(d.out, "no breakpoints")
+	}
+	for _, b := range d.breakpoints {
+		fmt.Fprintf(d.out, "breakpoint %d: %s\n", b.id, b.condition)
+	}
+	return nil
+}
+
+func deleteBreakpoint(d *Debugger, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: delete ID")
+	}
+	for i, b := range d.breakpoints {
+		if strconv.Itoa(b.id) == args[0] {
+			d.breakpoints = append(d.breakpoints[:i], d.breakpoints[i+1:]...)
+			fmt.Fprintf(d.out, "deleted breakpoint %d\n", b.id)
+			return nil
+		}
+	}
+	return fmt.Errorf("no breakpoint %s", args[0])
+}
+
+func printSet(d *Debugger, args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: set CORE SET | set CORE 0xADDRESS")
+	}
+	id, err := d.parseCore(args[0])
+	if err != nil {
+		return err
+	}
+
+	cache := d.sim.GetCores()[id].GetCache()
+	set, err := strconv.Atoi(args[1])
+	if strings.HasPrefix(args[1], "0x") {
+		var address uint32
+		address, err = d.parseAddress(args[1])
+		set = int(address>>d.offsetNumBits) % cache.GetNumSets()
+	}
+	if err != nil || set < 0 || set >= cache.GetNumSets() {
+		return fmt.Errorf("invalid set %s, expect 0 to %d or an address", args[1], cache.GetNumSets()-1)
+	}
+
+	fmt.Fprintf(d.out, "cache %d set %d:\n", id, set)
+	for _, line := range cache.GetSet(set) {
+		if !line.IsValid {
+			fmt.Fprintf(d.out, "  way %d: empty\n", line.Way)
+			continue
+		}
+		fmt.Fprintf(d.out, "  way %d: tag 0x%x, block 0x%x, %s", line.Way, line.Tag, line.Address, line.State)
+		if replacement := cache.DescribeReplacement(set, line.Way); replacement != "" {
+			fmt.Fprintf(d.out, ", %s", replacement)
+		}
+		fmt.Fprintln(d.out)
+	}
+	return nil
+}
+
+func printBus(d *Debugger, args []string) error {
+	d.sim.WriteInterconnectState(d.out)
+	return nil
+}
+
+func printCores(d *Debugger, args []string) error {
+	for _, core := range d.sim.GetCores() {
+		core.WriteState(d.out)
+	}
+	return nil
+}
+
+func printState(d *Debugger, args []string) error {
+	d.sim.WriteState(d.out)
+	return nil
+}
+
+func printStats(d *Debugger, args []string) error {
+	stats.PrintStatistics(d.out, d.sim.GetResults())
+	return nil
+}
+
+func printHelp(d *Debugger, args []string) error {
+	fmt.Fprintln(d.out, "Commands, which can be shortened to the name in brackets:")
+	for _, c := range commands {
+		name := c.usage
+		if c.alias != "" {
+			name += fmt.Sprintf(" (%s)", c.alias)
+		}
+		fmt.Fprintf(d.out, "  %s\n      %s\n", name, c.description)
+	}
+	fmt.Fprintln(d.out, "Addresses are in decimal, or in hexadecimal with a 0x prefix. A breakpoint on an address "+
+		"is hit by a transaction for its block or a change of the state of its block in a cache. A breakpoint on a "+
+		"core is hit when the core starts or completes an access to its cache.")
+	return nil
+}
@@ -0,0 +1,140 @@
+package debugger
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/xact"
+)
+
+type conditionKind int
+
+const (
+	blockCondition       conditionKind = iota // A transaction for the block or a change of its state in a cache
+	transactionCondition                      // A transaction of the type
+	coreCondition                             // The core starts or completes an access to its cache
+	stateCondition                            // A change of the state of a cache line
+)
+
+// condition is what a breakpoint or the until command waits for.
+type condition struct {
+	kind            conditionKind
+	core            int    // -1 for every core in a state condition
+	address         uint32 // Block address
+	hasAddress      bool   // Whether a state condition only holds for the block at address
+	transactionType xact.TransactionType
+}
+
+const conditionUsage = "addr ADDRESS | xact TYPE | core N | state [core N] [addr ADDRESS]"
+
+// Parse a condition from the arguments of a command.
+func (d *Debugger) parseCondition(args []string) (condition, error) {
+	if len(args) == 0 {
+		return condition{}, fmt.Errorf("missing condition: %s", conditionUsage)
+	}
+
+	var err error
+	c := condition{core: -1}
+	switch args[0] {
+	case "addr":
+		c.kind = blockCondition
+		if len(args) != 2 {
+			return c, errors.New("usage: addr ADDRESS")
+		}
+		c.address, err = d.parseAddress(args[1])
+	case "xact":
+		c.kind = transactionCondition
+		if len(args) != 2 {
+			return c, errors.New("usage: xact TYPE")
+		}
+		err = c.transactionType.UnmarshalText([]byte(args[1]))
+	case "core":
+		c.kind = coreCondition
+		if len(args) != 2 {
+			return c, errors.New("usage: core N")
+		}
+		c.core, err = d.parseCore(args[1])
+	case "state":
+		c.kind = stateCondition
+		err = d.parseStateFilters(&c, args[1:])
+	default:
+		return c, fmt.Errorf("invalid condition %s: %s", args[0], conditionUsage)
+	}
+	return c, err
+}
+
+func (d *Debugger) parseStateFilters(c *condition, args []string) error {
+	var err error
+	for i := 0; i < len(args) && err == nil; i += 2 {
+		if i+1 == len(args) {
+			return errors.New("usage: state [core N] [addr ADDRESS]")
+		}
+		switch args[i] {
+		case "core":
+			c.core, err = d.parseCore(args[i+1])
+		case "addr":
+			c.address, err = d.parseAddress(args[i+1])
+			c.hasAddress = true
+		default:
+			return fmt.Errorf("invalid state filter %s, expect core or addr", args[i])
+		}
+	}
+	return err
+}
+
+// Parse an address, in decimal or in hexadecimal with a 0x prefix, and return the address of its block.
+func (d *Debugger) parseAddress(s string) (uint32, error) {
+	address, err := strconv.ParseUint(s, 0, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid address %s", s)
+	}
+	return d.getBlockAddress(uint32(address)), nil
+}
+
+func (d *Debugger) parseCore(s string) (int, error) {
+	id, err := strconv.Atoi(s)
+	if err != nil || id < 0 || id >= len(d.sim.GetCores()) {
+		return 0, fmt.Errorf("invalid core %s, expect 0 to %d", s, len(d.sim.GetCores())-1)
+	}
+	return id, nil
+}
+
+func (c condition) String() string {
+	switch c.kind {
+	case blockCondition:
+		return fmt.Sprintf("addr 0x%x", c.address)
+	case transactionCondition:
+		return "xact " + c.transactionType.String()
+	case coreCondition:
+		return fmt.Sprintf("core %d", c.core)
+	}
+
+	description := "state"
+	if c.core != -1 {
+		description += fmt.Sprintf(" core %d", c.core)
+	}
+	if c.hasAddress {
+		description += fmt.Sprintf(" addr 0x%x", c.address)
+	}
+	return description
+}
+
+func (c condition) needsLineStates() bool {
+	return c.kind == blockCondition || c.kind == stateCondition
+}
+
+func (c condition) matchesTransaction(transaction xact.Transaction, blockAddress uint32) bool {
+	if c.kind == blockCondition {
+		return blockAddress == c.address
+	}
+	return c.kind == transactionCondition && transaction.TransactionType == c.transactionType
+}
+
+func (c condition) matchesChange(change lineChange) bool {
+	if c.kind == blockCondition {
+		return change.address == c.address
+	}
+	return c.kind == stateCondition && (c.core == -1 || change.cacheId == c.core) &&
+		(!c.hasAddress || change.address == c.address)
+}
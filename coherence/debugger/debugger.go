@@ -0,0 +1,267 @@
+/*
+Package debugger implements a Debugger struct which steps through a simulation interactively. It stops at the
+breakpoints set on a block, a transaction type, a core or the state changes of the cache lines, and prints the cache
+sets and the state of the bus or of any other component in between.
+*/
+package debugger
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/cache"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/core"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/xact"
+	"github.com/chriskheng/cs4223-assignment2/coherence/simerror"
+	"github.com/chriskheng/cs4223-assignment2/coherence/simulator"
+)
+
+const prompt = "(coherence) "
+
+// State shown for a block which is not cached, whether the protocol has an Invalid state or not.
+const invalidState = "Invalid"
+
+type Debugger struct {
+	sim           *simulator.BaseSimulator
+	out           io.Writer
+	offsetNumBits uint32
+	breakpoints   []breakpoint
+	nextId        int
+	transactions  []xact.Transaction // Transactions snooped or delivered in the last cycle
+	coreStates    []core.CoreState   // States of the cores before the last cycle
+	lines         [][]cache.SetLine  // Lines of every cache before the last cycle, nil if no condition needs them
+	err           error              // Error which stopped the simulation, after which it cannot go on
+}
+
+type breakpoint struct {
+	id        int
+	condition condition
+}
+
+// lineChange is a change of the state of a block in a cache during a cycle.
+type lineChange struct {
+	cacheId int
+	address uint32 // Block address
+	from    string
+	to      string
+}
+
+func (c lineChange) String() string {
+	return fmt.Sprintf("cache %d: 0x%x %s -> %s", c.cacheId, c.address, c.from, c.to)
+}
+
+// blockSize is in bytes. The simulator MUST not have run yet.
+func NewDebugger(sim *simulator.BaseSimulator, blockSize int, out io.Writer) *Debugger {
+	d := &Debugger{sim: sim, out: out, offsetNumBits: uint32(math.Log2(float64(blockSize))), nextId: 1}
+	sim.ObserveTransactions(func(transaction xact.Transaction) {
+		d.transactions = append(d.transactions, transaction)
+	})
+	return d
+}
+
+// Execute the commands read from in until quit or the end of the input.
+func (d *Debugger) Run(in io.Reader) {
+	fmt.Fprintf(d.out, "%d cores at cycle %d, type help for the commands\n", len(d.sim.GetCores()), d.sim.GetCycle())
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(d.out, prompt)
+		if !scanner.Scan() {
+			fmt.Fprintln(d.out)
+			return
+		}
+
+		args := strings.Fields(scanner.Text())
+		if len(args) == 0 {
+			continue
+		}
+		if args[0] == "quit" || args[0] == "q" {
+			return
+		}
+		if err := d.execute(args); err != nil {
+			fmt.Fprintln(d.out, err)
+		}
+	}
+}
+
+// Simulate numCycles cycles, or until the simulation is done, a breakpoint is hit or the until condition holds if
+// it is not nil. The idle cycles are skipped at once since no breakpoint can be hit in them.
+func (d *Debugger) advance(numCycles int, until *condition) error {
+	if d.err != nil {
+		return fmt.Errorf("the simulation is stopped by: %v", d.err)
+	}
+	if d.sim.IsDone() {
+		return errors.New("the simulation is done")
+	}
+
+	target := d.sim.GetCycle() + numCycles
+	for !d.sim.IsDone() && d.sim.GetCycle() < target {
+		cycle := d.sim.GetCycle()
+		d.prepareCycle(until)
+		if err := d.sim.Step(target - cycle); err != nil {
+			d.err = err
+			return err
+		}
+		if d.printHits(cycle, until) {
+			break
+		}
+	}
+
+	if d.sim.IsDone() {
+		fmt.Fprintf(d.out, "the simulation is done after %d cycles\n", d.sim.GetCycle())
+	} else {
+		fmt.Fprintf(d.out, "at cycle %d\n", d.sim.GetCycle())
+	}
+	return nil
+}
+
+// Record the state of the cores and of the cache lines before the next cycle, to find what changes during it.
+func (d *Debugger) prepareCycle(until *condition) {
+	d.transactions = d.transactions[:0]
+	d.coreStates = d.coreStates[:0]
+	for _, c := range d.sim.GetCores() {
+		d.coreStates = append(d.coreStates, c.GetState())
+	}
+
+	if !d.isLineStateNeeded(until) {
+		d.lines = nil
+	} else if d.lines == nil {
+		d.lines = d.getLines()
+	}
+}
+
+// Print the breakpoints hit in the given cycle and the until condition if it holds. Return true if there is any.
+func (d *Debugger) printHits(cycle int, until *condition) bool {
+	changes := d.getLineChanges()
+	isHit := false
+	for _, b := range d.breakpoints {
+		for _, hit := range d.getHits(b.condition, changes) {
+			fmt.Fprintf(d.out, "cycle %d: breakpoint %d (%s): %s\n", cycle, b.id, b.condition, hit)
+			isHit = true
+		}
+	}
+	if until != nil {
+		for _, hit := range d.getHits(*until, changes) {
+			fmt.Fprintf(d.out, "cycle %d: %s: %s\n", cycle, until, hit)
+			isHit = true
+		}
+	}
+	return isHit
+}
+
+// Return the descriptions of what makes the condition hold in the last cycle.
+func (d *Debugger) getHits(c condition, changes []lineChange) []string {
+	hits := []string{}
+	switch c.kind {
+	case blockCondition, transactionCondition:
+		for _, transaction := range d.transactions {
+			if c.matchesTransaction(transaction, d.getBlockAddress(transaction.Address)) {
+				hits = append(hits, simerror.FormatTransaction(transaction))
+			}
+		}
+	case coreCondition:
+		hits = append(hits, d.getCoreHits(c.core)...)
+	}
+
+	if c.kind == blockCondition || c.kind == stateCondition {
+		for _, change := range changes {
+			if c.matchesChange(change) {
+				hits = append(hits, change.String())
+			}
+		}
+	}
+	return hits
+}
+
+func (d *Debugger) getCoreHits(id int) []string {
+	c := d.sim.GetCores()[id]
+	wasWaiting := d.coreStates[id] == core.MemoryState
+	isWaiting := c.GetState() == core.MemoryState
+	if !wasWaiting && isWaiting {
+		return []string{"starts an access, cache: " + c.GetCache().GetStateDescription()}
+	}
+	if wasWaiting && !isWaiting {
+		return []string{"completes its access"}
+	}
+	return nil
+}
+
+func (d *Debugger) isLineStateNeeded(until *condition) bool {
+	if until != nil && until.needsLineStates() {
+		return true
+	}
+	for _, b := range d.breakpoints {
+		if b.condition.needsLineStates() {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the changes of the states of the cache lines during the last cycle. The lines only change in the cycles
+// with a transaction or in which a core starts or completes an access, e.g. on a silent upgrade, so they are not
+// compared in the other cycles.
+func (d *Debugger) getLineChanges() []lineChange {
+	if d.lines == nil || (len(d.transactions) == 0 && !d.isAnyCoreStateChanged()) {
+		return nil
+	}
+
+	lines := d.getLines()
+	changes := []lineChange{}
+	for cacheId := range lines {
+		for i, line := range lines[cacheId] {
+			changes = appendLineChanges(changes, cacheId, d.lines[cacheId][i], line)
+		}
+	}
+	d.lines = lines
+	return changes
+}
+
+func (d *Debugger) isAnyCoreStateChanged() bool {
+	for id, c := range d.sim.GetCores() {
+		if c.GetState() != d.coreStates[id] {
+			return true
+		}
+	}
+	return false
+}
+
+// A line which holds another block after the cycle evicted the block it held before.
+func appendLineChanges(changes []lineChange, cacheId int, before cache.SetLine, after cache.SetLine) []lineChange {
+	if before == after {
+		return changes
+	}
+	if before.IsValid && after.IsValid && before.Address == after.Address {
+		return append(changes, lineChange{cacheId: cacheId, address: after.Address, from: before.State,
+			to: after.State})
+	}
+	if before.IsValid && before.State != invalidState {
+		changes = append(changes, lineChange{cacheId: cacheId, address: before.Address, from: before.State,
+			to: invalidState})
+	}
+	if after.IsValid && after.State != invalidState {
+		changes = append(changes, lineChange{cacheId: cacheId, address: after.Address,
+			from: invalidState, to: after.State})
+	}
+	return changes
+}
+
+// Return the lines of every cache, indexed by cache id and then by set and way.
+func (d *Debugger) getLines() [][]cache.SetLine {
+	lines := [][]cache.SetLine{}
+	for _, c := range d.sim.GetCores() {
+		cacheLines := []cache.SetLine{}
+		for set := 0; set < c.GetCache().GetNumSets(); set++ {
+			cacheLines = append(cacheLines, c.GetCache().GetSet(set)...)
+		}
+		lines = append(lines, cacheLines)
+	}
+	return lines
+}
+
+func (d *Debugger) getBlockAddress(address uint32) uint32 {
+	return address >> d.offsetNumBits << d.offsetNumBits
+}
@@ -0,0 +1,247 @@
+package debugger
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/cache"
+	"github.com/chriskheng/cs4223-assignment2/coherence/config"
+	"github.com/chriskheng/cs4223-assignment2/coherence/simulation"
+	"github.com/chriskheng/cs4223-assignment2/coherence/simulator"
+	"github.com/chriskheng/cs4223-assignment2/coherence/testutils"
+)
+
+type runTest struct {
+	name     string
+	commands []string
+	output   []string // Expected output after the banner, without the prompts
+}
+
+// Core 0 reads the blocks 0x0 and 0x20 of set 0, then core 1 takes the block 0x0 from it with a write miss.
+var debuggedTraces = testutils.Traces{
+	{{Op: testutils.LoadOp, Value: 0x0}, {Op: testutils.OthersOp, Value: 5}, {Op: testutils.LoadOp, Value: 0x24}},
+	{{Op: testutils.OthersOp, Value: 150}, {Op: testutils.StoreOp, Value: 0x4}},
+}
+
+var runTests = []runTest{
+	{name: "step", commands: []string{"step", "step 2"}, output: []string{"at cycle 1", "at cycle 3"}},
+	{
+		name:     "break on an address",
+		commands: []string{"break addr 0x4", "continue", "continue"},
+		output: []string{
+			"breakpoint 1: addr 0x0",
+			"cycle 1: breakpoint 1 (addr 0x0): BusRead of 0x0 from 0 for 0",
+			"cycle 1: breakpoint 1 (addr 0x0): cache 0: 0x0 Invalid -> IE_D",
+			"at cycle 2",
+			"cycle 109: breakpoint 1 (addr 0x0): MemReadDone of 0x0 from -1 for 0",
+			"cycle 109: breakpoint 1 (addr 0x0): cache 0: 0x0 IE_D -> Exclusive",
+			"at cycle 110",
+		},
+	},
+	{
+		name:     "break on the states of a core",
+		commands: []string{"break state core 1", "continue", "continue"},
+		output: []string{
+			"breakpoint 1: state core 1",
+			"cycle 227: breakpoint 1 (state core 1): cache 1: 0x0 Invalid -> IM_D",
+			"at cycle 228",
+			"cycle 236: breakpoint 1 (state core 1): cache 1: 0x0 IM_D -> Modified",
+			"at cycle 237",
+		},
+	},
+	{
+		name:     "break on the states of a block",
+		commands: []string{"break state addr 0x20", "continue"},
+		output: []string{
+			"breakpoint 1: state addr 0x20",
+			"cycle 117: breakpoint 1 (state addr 0x20): cache 0: 0x20 Invalid -> IE_D",
+			"at cycle 118",
+		},
+	},
+	{
+		name:     "break on a core",
+		commands: []string{"break core 0", "step", "continue"},
+		output: []string{
+			"breakpoint 1: core 0",
+			"cycle 0: breakpoint 1 (core 0): starts an access, cache: WaitForRequestToComplete, load of 0x0, " +
+				"transaction BusRead of 0x0 from 0 for 0, holding the bus granted in cycle 0",
+			"at cycle 1",
+			"cycle 110: breakpoint 1 (core 0): completes its access",
+			"at cycle 111",
+		},
+	},
+	{
+		name:     "break on a transaction type",
+		commands: []string{"break xact BusReadX", "continue"},
+		output: []string{
+			"breakpoint 1: xact BusReadX",
+			"cycle 227: breakpoint 1 (xact BusReadX): BusReadX of 0x4 from 1 for 1",
+			"at cycle 228",
+		},
+	},
+	{
+		name:     "deleted breakpoint",
+		commands: []string{"break addr 0x0", "delete 1", "continue"},
+		output:   []string{"breakpoint 1: addr 0x0", "deleted breakpoint 1", "the simulation is done after 239 cycles"},
+	},
+	{
+		name:     "until",
+		commands: []string{"until cycle 200", "until addr 0x0", "until cycle 1000"},
+		output: []string{
+			"at cycle 200",
+			"cycle 227: addr 0x0: BusReadX of 0x4 from 1 for 1",
+			"cycle 227: addr 0x0: cache 0: 0x0 Exclusive -> Invalid",
+			"cycle 227: addr 0x0: cache 1: 0x0 Invalid -> IM_D",
+			"at cycle 228",
+			"the simulation is done after 239 cycles",
+		},
+	},
+	{
+		name:     "set and bus",
+		commands: []string{"until cycle 120", "set 0 0", "set 0 1", "bus"},
+		output: []string{
+			"at cycle 120",
+			"cache 0 set 0:",
+			"  way 0: tag 0x0, block 0x0, Exclusive, last used 2",
+			"  way 1: tag 0x1, block 0x20, IE_D, last used 3",
+			"cache 0 set 1:",
+			"  way 0: empty",
+			"  way 1: empty",
+			"bus: RequestSent BusRead of 0x24 from 0 for 0",
+			"memory: 1 operations",
+			"  MemReadDone of 0x24 from -1 for 0 done in cycle 216",
+		},
+	},
+	{
+		name:     "invalid commands",
+		commands: []string{"step x", "set 2 0", "foo", "until cycle 0", "break state core", "break at 0"},
+		output: []string{
+			"invalid number of cycles x",
+			"invalid core 2, expect 0 to 1",
+			"unknown command foo, type help for the commands",
+			"usage: until cycle N, with N after the current cycle 0",
+			"usage: state [core N] [addr ADDRESS]",
+			"invalid condition at: addr ADDRESS | xact TYPE | core N | state [core N] [addr ADDRESS]",
+		},
+	},
+}
+
+func TestRun(t *testing.T) {
+	c := config.Default()
+	c.Protocol = config.Mesi
+	c.NumCores = 2
+	c.L1.Size = testutils.FuzzCacheSize
+	c.L1.Associativity = testutils.FuzzAssociativity
+	c.L1.BlockSize = testutils.FuzzBlockSize
+
+	for _, test := range runTests {
+		sim, err := simulation.New(c, debuggedTraces.GetReaders())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		d := NewDebugger(sim.(*simulator.BaseSimulator), c.L1.BlockSize, &out)
+		d.Run(strings.NewReader(strings.Join(test.commands, "\n") + "\n"))
+
+		expected := append([]string{"2 cores at cycle 0, type help for the commands"}, test.output...)
+		got := strings.TrimSpace(strings.ReplaceAll(out.String(), prompt, ""))
+		if want := strings.Join(expected, "\n"); got != want {
+			t.Errorf(testutils.GetErrorString(test.name, want, got))
+		}
+	}
+}
+
+type parseConditionTest struct {
+	args      string
+	condition string // Empty if the arguments are invalid
+}
+
+var parseConditionTests = []parseConditionTest{
+	{args: "addr 0x24", condition: "addr 0x20"},
+	{args: "addr 36", condition: "addr 0x20"},
+	{args: "xact Flush", condition: "xact Flush"},
+	{args: "core 1", condition: "core 1"},
+	{args: "state", condition: "state"},
+	{args: "state addr 0x8 core 0", condition: "state core 0 addr 0x0"},
+	{args: ""},
+	{args: "addr"},
+	{args: "addr x"},
+	{args: "xact Foo"},
+	{args: "core 2"},
+	{args: "state core"},
+	{args: "state cycle 1"},
+	{args: "cycle 1"},
+}
+
+func TestParseCondition(t *testing.T) {
+	c := config.Default()
+	c.NumCores = 2
+	sim, err := simulation.New(c, debuggedTraces.GetReaders())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDebugger(sim.(*simulator.BaseSimulator), testutils.FuzzBlockSize, &bytes.Buffer{})
+
+	for _, test := range parseConditionTests {
+		condition, err := d.parseCondition(strings.Fields(test.args))
+		if test.condition == "" {
+			if err == nil {
+				t.Errorf(testutils.GetErrorString(test.args, "an error", condition.String()))
+			}
+		} else if err != nil {
+			t.Errorf(testutils.GetErrorString(test.args, test.condition, err.Error()))
+		} else if condition.String() != test.condition {
+			t.Errorf(testutils.GetErrorString(test.args, test.condition, condition.String()))
+		}
+	}
+}
+
+type appendLineChangesTest struct {
+	name    string
+	before  cache.SetLine
+	after   cache.SetLine
+	changes []string
+}
+
+var appendLineChangesTests = []appendLineChangesTest{
+	{
+		name:   "unchanged line",
+		before: cache.SetLine{IsValid: true, Address: 0x20, State: "Shared"},
+		after:  cache.SetLine{IsValid: true, Address: 0x20, State: "Shared"},
+	},
+	{
+		name:    "state change of the block",
+		before:  cache.SetLine{IsValid: true, Address: 0x20, State: "Shared"},
+		after:   cache.SetLine{IsValid: true, Address: 0x20, State: "Modified"},
+		changes: []string{"cache 1: 0x20 Shared -> Modified"},
+	},
+	{
+		name:    "block filling an empty line",
+		after:   cache.SetLine{IsValid: true, Address: 0x20, State: "IS_D"},
+		changes: []string{"cache 1: 0x20 Invalid -> IS_D"},
+	},
+	{
+		name:    "block evicted for another block",
+		before:  cache.SetLine{IsValid: true, Address: 0x0, State: "Modified"},
+		after:   cache.SetLine{IsValid: true, Address: 0x20, State: "IS_D"},
+		changes: []string{"cache 1: 0x0 Modified -> Invalid", "cache 1: 0x20 Invalid -> IS_D"},
+	},
+	{
+		name:   "Invalid block replaced by another Invalid block",
+		before: cache.SetLine{IsValid: true, Address: 0x0, State: "Invalid"},
+		after:  cache.SetLine{IsValid: true, Address: 0x20, State: "Invalid"},
+	},
+}
+
+func TestAppendLineChanges(t *testing.T) {
+	for _, test := range appendLineChangesTests {
+		changes := []string{}
+		for _, change := range appendLineChanges(nil, 1, test.before, test.after) {
+			changes = append(changes, change.String())
+		}
+		if got, want := strings.Join(changes, "; "), strings.Join(test.changes, "; "); got != want {
+			t.Errorf(testutils.GetErrorString(test.name, want, got))
+		}
+	}
+}
@@ -0,0 +1,38 @@
+/*
+Package dirmesi implements a DirMesiSimulator struct to simulate directory-based MESI Cache Coherence Protocol.
+*/
+package dirmesi
+
+import (
+	"io"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/cache"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/clock"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/core"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/directory"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/network"
+	"github.com/chriskheng/cs4223-assignment2/coherence/config"
+	"github.com/chriskheng/cs4223-assignment2/coherence/constants"
+	"github.com/chriskheng/cs4223-assignment2/coherence/simulator"
+)
+
+type DirMesiSimulator struct {
+	*simulator.BaseSimulator
+}
+
+func NewDirMesiSimulator(config config.Config, traces []io.Reader) *DirMesiSimulator {
+	cores := []*core.Core{}
+	clock := clock.NewClock()
+	network := network.NewNetwork(config.Network, clock)
+	directory := directory.NewDirectory(constants.MemoryId, config.NumCores, network, config.L1.BlockSize,
+		config.Memory.Latency, clock)
+
+	l1 := config.L1
+	for i := 0; i < config.NumCores; i++ {
+		cache := cache.NewDirectoryMesiCache(i, network, constants.MemoryId, l1.BlockSize, l1.Associativity, l1.Size,
+			l1.Replacement)
+		cores = append(cores, core.NewCore(i, traces[i], cache))
+	}
+
+	return &DirMesiSimulator{BaseSimulator: simulator.NewDirectoryBaseSimulator(cores, network, directory, clock)}
+}
@@ -4,10 +4,14 @@ Package dragon implements a DragonSimulator struct to simulate Dragon Cache Cohe
 package dragon
 
 import (
+	"io"
+
 	"github.com/chriskheng/cs4223-assignment2/coherence/components/bus"
 	"github.com/chriskheng/cs4223-assignment2/coherence/components/cache"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/clock"
 	"github.com/chriskheng/cs4223-assignment2/coherence/components/core"
 	"github.com/chriskheng/cs4223-assignment2/coherence/components/memory"
+	"github.com/chriskheng/cs4223-assignment2/coherence/config"
 	"github.com/chriskheng/cs4223-assignment2/coherence/constants"
 	"github.com/chriskheng/cs4223-assignment2/coherence/simulator"
 )
@@ -16,15 +20,20 @@ type DragonSimulator struct {
 	*simulator.BaseSimulator
 }
 
-func NewDragonSimulator(inputFilePrefix string, cacheSize int, associativity int, blockSize int) *DragonSimulator {
+func NewDragonSimulator(config config.Config, traces []io.Reader) *DragonSimulator {
 	cores := []*core.Core{}
-	bus := bus.NewBus()
-	memory := memory.NewMemory(constants.NumCores, bus)
+	clock := clock.NewClock()
+	bus := bus.NewBus(config.Bus, config.L1.BlockSize, clock)
+	memory := memory.NewMemory(constants.MemoryId, bus, config.Memory, config.L1.BlockSize, clock)
+	if config.L2 != nil {
+		memory.AddL2Cache(*config.L2, config.L1.BlockSize)
+	}
 
-	for i := 0; i < constants.NumCores; i++ {
-		cache := cache.NewDragonCache(i, bus, blockSize, associativity, cacheSize)
-		cores = append(cores, core.NewCore(i, inputFilePrefix, cache))
+	l1 := config.L1
+	for i := 0; i < config.NumCores; i++ {
+		cache := cache.NewDragonCache(i, bus, l1.BlockSize, l1.Associativity, l1.Size, l1.Replacement)
+		cores = append(cores, core.NewCore(i, traces[i], cache))
 	}
 
-	return &DragonSimulator{BaseSimulator: simulator.NewBaseSimulator(cores, bus, memory)}
+	return &DragonSimulator{BaseSimulator: simulator.NewBaseSimulator(cores, bus, memory, clock)}
 }
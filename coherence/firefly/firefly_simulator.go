@@ -0,0 +1,40 @@
+/*
+Package firefly implements a FireflySimulator struct to simulate Firefly Cache Coherence Protocol.
+*/
+package firefly
+
+import (
+	"io"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/bus"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/cache"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/clock"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/core"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/memory"
+	"github.com/chriskheng/cs4223-assignment2/coherence/config"
+	"github.com/chriskheng/cs4223-assignment2/coherence/constants"
+	"github.com/chriskheng/cs4223-assignment2/coherence/simulator"
+)
+
+type FireflySimulator struct {
+	*simulator.BaseSimulator
+}
+
+func NewFireflySimulator(config config.Config, traces []io.Reader) *FireflySimulator {
+	cores := []*core.Core{}
+	clock := clock.NewClock()
+	bus := bus.NewBus(config.Bus, config.L1.BlockSize, clock)
+	memory := memory.NewMemory(constants.MemoryId, bus, config.Memory, config.L1.BlockSize, clock)
+	if config.L2 != nil {
+		memory.AddL2Cache(*config.L2, config.L1.BlockSize)
+	}
+	memory.EnableUpdateOnBusUpd()
+
+	l1 := config.L1
+	for i := 0; i < config.NumCores; i++ {
+		cache := cache.NewFireflyCache(i, bus, l1.BlockSize, l1.Associativity, l1.Size, l1.Replacement)
+		cores = append(cores, core.NewCore(i, traces[i], cache))
+	}
+
+	return &FireflySimulator{BaseSimulator: simulator.NewBaseSimulator(cores, bus, memory, clock)}
+}
@@ -0,0 +1,39 @@
+/*
+Package moesi implements a MoesiSimulator struct to simulate MOESI Cache Coherence Protocol.
+*/
+package moesi
+
+import (
+	"io"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/bus"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/cache"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/clock"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/core"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/memory"
+	"github.com/chriskheng/cs4223-assignment2/coherence/config"
+	"github.com/chriskheng/cs4223-assignment2/coherence/constants"
+	"github.com/chriskheng/cs4223-assignment2/coherence/simulator"
+)
+
+type MoesiSimulator struct {
+	*simulator.BaseSimulator
+}
+
+func NewMoesiSimulator(config config.Config, traces []io.Reader) *MoesiSimulator {
+	cores := []*core.Core{}
+	clock := clock.NewClock()
+	bus := bus.NewBus(config.Bus, config.L1.BlockSize, clock)
+	memory := memory.NewMemory(constants.MemoryId, bus, config.Memory, config.L1.BlockSize, clock)
+	if config.L2 != nil {
+		memory.AddL2Cache(*config.L2, config.L1.BlockSize)
+	}
+
+	l1 := config.L1
+	for i := 0; i < config.NumCores; i++ {
+		cache := cache.NewMoesiCache(i, bus, l1.BlockSize, l1.Associativity, l1.Size, l1.Replacement)
+		cores = append(cores, core.NewCore(i, traces[i], cache))
+	}
+
+	return &MoesiSimulator{BaseSimulator: simulator.NewBaseSimulator(cores, bus, memory, clock)}
+}
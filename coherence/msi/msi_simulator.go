@@ -0,0 +1,39 @@
+/*
+Package msi implements a MsiSimulator struct to simulate MSI Cache Coherence Protocol.
+*/
+package msi
+
+import (
+	"io"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/bus"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/cache"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/clock"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/core"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/memory"
+	"github.com/chriskheng/cs4223-assignment2/coherence/config"
+	"github.com/chriskheng/cs4223-assignment2/coherence/constants"
+	"github.com/chriskheng/cs4223-assignment2/coherence/simulator"
+)
+
+type MsiSimulator struct {
+	*simulator.BaseSimulator
+}
+
+func NewMsiSimulator(config config.Config, traces []io.Reader) *MsiSimulator {
+	cores := []*core.Core{}
+	clock := clock.NewClock()
+	bus := bus.NewBus(config.Bus, config.L1.BlockSize, clock)
+	memory := memory.NewMemory(constants.MemoryId, bus, config.Memory, config.L1.BlockSize, clock)
+	if config.L2 != nil {
+		memory.AddL2Cache(*config.L2, config.L1.BlockSize)
+	}
+
+	l1 := config.L1
+	for i := 0; i < config.NumCores; i++ {
+		cache := cache.NewMsiCache(i, bus, l1.BlockSize, l1.Associativity, l1.Size, l1.Replacement)
+		cores = append(cores, core.NewCore(i, traces[i], cache))
+	}
+
+	return &MsiSimulator{BaseSimulator: simulator.NewBaseSimulator(cores, bus, memory, clock)}
+}
@@ -0,0 +1,160 @@
+/*
+Package simerror implements the errors returned by a simulation when a component receives something that its protocol
+does not allow, when a trace cannot be read, when the coherence checker finds a violation, when a load returns a
+stale value, or when the watchdog stops a simulation which makes no progress.
+
+The components panic with these errors, since they are raised deep in the callbacks of the bus and of the network.
+The simulator recovers them and returns them from Run, after adding the cycle and the state of the interconnect.
+*/
+package simerror
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/xact"
+)
+
+// Error describes the state of the simulated system when a component receives something that its protocol does not
+// allow. The fields which do not apply are left empty.
+type Error struct {
+	Cycle           int
+	Component       string // cache, bus, directory, network or core
+	Id              int    // Id of the cache or of the core, -1 for the other components
+	Address         uint32 // Address of the block concerned
+	HasAddress      bool
+	ControllerState string            // State of the cache controller or of the directory entry
+	LineState       string            // State of the cache line of the block, if the block is cached
+	BusState        string            // State of the bus, or of the outstanding transactions on a split-transaction bus
+	Transaction     *xact.Transaction // Transaction which triggered the error, if any
+	Reason          string
+}
+
+// Return an error raised by a component which is not a cache or a core.
+func New(component string, transaction *xact.Transaction, format string, a ...interface{}) *Error {
+	err := &Error{Component: component, Id: -1, Transaction: transaction, Reason: fmt.Sprintf(format, a...)}
+	if transaction != nil {
+		err.SetAddress(transaction.Address)
+	}
+	return err
+}
+
+func (e *Error) SetAddress(address uint32) {
+	e.Address = address
+	e.HasAddress = true
+}
+
+func (e *Error) Error() string {
+	component := e.Component
+	if e.Id != -1 {
+		component = fmt.Sprintf("%s %d", e.Component, e.Id)
+	}
+
+	details := []string{}
+	if e.HasAddress {
+		details = append(details, fmt.Sprintf("block 0x%x", e.Address))
+	}
+	if e.ControllerState != "" {
+		details = append(details, "controller state "+e.ControllerState)
+	}
+	if e.LineState != "" {
+		details = append(details, "line state "+e.LineState)
+	}
+	if e.BusState != "" {
+		details = append(details, "bus state "+e.BusState)
+	}
+	if e.Transaction != nil {
+		details = append(details, "transaction "+FormatTransaction(*e.Transaction))
+	}
+
+	message := fmt.Sprintf("cycle %d: %s: %s", e.Cycle, component, e.Reason)
+	if len(details) > 0 {
+		message += " (" + strings.Join(details, ", ") + ")"
+	}
+	return message
+}
+
+// TraceError describes a trace which cannot be read, or one of its lines which cannot be parsed.
+type TraceError struct {
+	CoreId int
+	File   string // Empty if the trace is not read from a file
+	Line   int    // 0 if the error is not about a line
+	Err    error
+}
+
+func (e *TraceError) Error() string {
+	trace := e.File
+	if trace == "" {
+		trace = fmt.Sprintf("trace of core %d", e.CoreId)
+	}
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", trace, e.Line, e.Err.Error())
+	}
+	return fmt.Sprintf("%s: %s", trace, e.Err.Error())
+}
+
+func (e *TraceError) Unwrap() error {
+	return e.Err
+}
+
+// CoherenceError describes a violation of a coherence invariant found by the checker.
+type CoherenceError struct {
+	Cycle      int
+	Address    uint32 // Address of the block
+	Invariant  string
+	LineStates []string // State of the cache line of the block in every cache, indexed by cache id
+}
+
+func (e *CoherenceError) Error() string {
+	states := []string{}
+	for id, state := range e.LineStates {
+		states = append(states, fmt.Sprintf("cache %d %s", id, state))
+	}
+	return fmt.Sprintf("cycle %d: coherence violated for block 0x%x: %s (%s)", e.Cycle, e.Address, e.Invariant,
+		strings.Join(states, ", "))
+}
+
+// StaleReadError describes a load which does not return the value of the last store to its word. The writers are
+// constants.MemoryId for the initial value.
+type StaleReadError struct {
+	Cycle          int
+	CacheId        int
+	Address        uint32 // Address of the word
+	Value          uint32 // Value returned by the load
+	ValueWriter    int
+	Expected       uint32 // Value of the last store to the word
+	ExpectedWriter int
+}
+
+func (e *StaleReadError) Error() string {
+	return fmt.Sprintf("cycle %d: cache %d: stale read of 0x%x, the load returns %s instead of %s", e.Cycle,
+		e.CacheId, e.Address, formatValue(e.Value, e.ValueWriter), formatValue(e.Expected, e.ExpectedWriter))
+}
+
+// WatchdogError describes a simulation stopped by the watchdog, along with the state of every component at that time.
+type WatchdogError struct {
+	Cycle    int
+	Reason   string
+	State    string // State of the cores, the cache controllers and the interconnect
+	DumpFile string // File the state is written to, empty if it is not written
+}
+
+func (e *WatchdogError) Error() string {
+	message := fmt.Sprintf("cycle %d: watchdog: %s", e.Cycle, e.Reason)
+	if e.DumpFile != "" {
+		message += ", the state of the system is written to " + e.DumpFile
+	}
+	return message
+}
+
+func formatValue(value uint32, writer int) string {
+	if value == 0 {
+		return "the initial value"
+	}
+	return fmt.Sprintf("value %d stored by cache %d", value, writer)
+}
+
+func FormatTransaction(transaction xact.Transaction) string {
+	return fmt.Sprintf("%s of 0x%x from %d for %d", transaction.TransactionType, transaction.Address,
+		transaction.SenderId, transaction.RequesterId)
+}
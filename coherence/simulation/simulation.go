@@ -0,0 +1,125 @@
+/*
+Package simulation is the API to run the simulator from Go programs. A simulation is described by a config.Config and
+the trace of every core, and its statistics are returned as a stats.Results.
+*/
+package simulation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/core"
+	"github.com/chriskheng/cs4223-assignment2/coherence/config"
+	"github.com/chriskheng/cs4223-assignment2/coherence/dirmesi"
+	"github.com/chriskheng/cs4223-assignment2/coherence/dragon"
+	"github.com/chriskheng/cs4223-assignment2/coherence/firefly"
+	"github.com/chriskheng/cs4223-assignment2/coherence/mesi"
+	"github.com/chriskheng/cs4223-assignment2/coherence/mesif"
+	"github.com/chriskheng/cs4223-assignment2/coherence/moesi"
+	"github.com/chriskheng/cs4223-assignment2/coherence/msi"
+	"github.com/chriskheng/cs4223-assignment2/coherence/simerror"
+	"github.com/chriskheng/cs4223-assignment2/coherence/simulator"
+	"github.com/chriskheng/cs4223-assignment2/coherence/stats"
+)
+
+// Return a simulator of the given system in which core i executes traces[i]. The number of cores is the number of
+// traces if it is not set, and the trace prefix of the configuration is not used. The configuration is validated.
+func New(systemConfig config.Config, traces []io.Reader) (simulator.Simulator, error) {
+	if systemConfig.NumCores == 0 {
+		systemConfig.NumCores = len(traces)
+	}
+	if len(traces) != systemConfig.NumCores {
+		return nil, fmt.Errorf("%d traces are given for %d cores", len(traces), systemConfig.NumCores)
+	}
+
+	if err := systemConfig.Validate(); err != nil {
+		return nil, err
+	}
+
+	sim := newSimulator(systemConfig, traces)
+	if systemConfig.CheckCoherence {
+		sim.EnableCoherenceChecker(systemConfig.L1.BlockSize)
+	}
+	if systemConfig.TrackValues {
+		sim.EnableValueTracking(systemConfig.L1.BlockSize)
+	}
+	if systemConfig.Watchdog.StallCycles > 0 || systemConfig.Watchdog.MaxCycles > 0 {
+		sim.EnableWatchdog(systemConfig.Watchdog)
+	}
+	if systemConfig.BusTrace.File != "" {
+		if err := sim.EnableBusTrace(systemConfig.BusTrace, systemConfig.L1.BlockSize); err != nil {
+			return nil, err
+		}
+	}
+	return sim, nil
+}
+
+func newSimulator(systemConfig config.Config, traces []io.Reader) *simulator.BaseSimulator {
+	switch systemConfig.Protocol {
+	case config.Mesi:
+		return mesi.NewMesiSimulator(systemConfig, traces).BaseSimulator
+	case config.Dragon:
+		return dragon.NewDragonSimulator(systemConfig, traces).BaseSimulator
+	case config.Firefly:
+		return firefly.NewFireflySimulator(systemConfig, traces).BaseSimulator
+	case config.DirMesi:
+		return dirmesi.NewDirMesiSimulator(systemConfig, traces).BaseSimulator
+	case config.Msi:
+		return msi.NewMsiSimulator(systemConfig, traces).BaseSimulator
+	case config.Moesi:
+		return moesi.NewMoesiSimulator(systemConfig, traces).BaseSimulator
+	default:
+		return mesif.NewMesifSimulator(systemConfig, traces).BaseSimulator
+	}
+}
+
+// Run the simulation of the given system, in which the cores execute the trace files of the trace prefix. The number
+// of cores is the number of trace files found if it is not set.
+func RunTraceFiles(ctx context.Context, systemConfig config.Config) (stats.Results, error) {
+	if _, err := systemConfig.DiscoverNumCores(); err != nil {
+		return stats.Results{}, err
+	}
+
+	traces, closeTraces, err := OpenTraceFiles(systemConfig)
+	if err != nil {
+		return stats.Results{}, err
+	}
+	defer closeTraces()
+
+	sim, err := New(systemConfig, traces)
+	if err != nil {
+		return stats.Results{}, err
+	}
+
+	results, err := sim.Run(ctx)
+	var traceErr *simerror.TraceError
+	if errors.As(err, &traceErr) {
+		traceErr.File = core.GetTraceFileName(systemConfig.TracePrefix, traceErr.CoreId)
+	}
+	return results, err
+}
+
+// Open the trace files of the trace prefix, one for every core. The returned function closes them.
+func OpenTraceFiles(systemConfig config.Config) ([]io.Reader, func(), error) {
+	files := []*os.File{}
+	closeFiles := func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}
+
+	traces := []io.Reader{}
+	for i := 0; i < systemConfig.NumCores; i++ {
+		file, err := os.Open(core.GetTraceFileName(systemConfig.TracePrefix, i))
+		if err != nil {
+			closeFiles()
+			return nil, nil, err
+		}
+		files = append(files, file)
+		traces = append(traces, file)
+	}
+	return traces, closeFiles, nil
+}
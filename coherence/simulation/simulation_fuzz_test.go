@@ -0,0 +1,209 @@
+package simulation
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/bus"
+	"github.com/chriskheng/cs4223-assignment2/coherence/config"
+	"github.com/chriskheng/cs4223-assignment2/coherence/simulator"
+	"github.com/chriskheng/cs4223-assignment2/coherence/stats"
+	"github.com/chriskheng/cs4223-assignment2/coherence/testutils"
+)
+
+// A simulation of a few hundred instructions takes a few thousand cycles, so one which takes longer is deadlocked.
+const fuzzTimeout = 5 * time.Second
+
+// Few banks, so that the accesses often wait for each other.
+const fuzzNumDramBanks = 2
+
+// An inclusive L2 cache holding half of the blocks accessed, so that it often invalidates the blocks of the L1 caches.
+const (
+	fuzzL2Size          = 64
+	fuzzL2Associativity = 2
+)
+
+// The bus trace is limited to a block and a cycle window, so that both filters run.
+const (
+	fuzzBusTraceAddress   = 0
+	fuzzBusTraceFromCycle = 10
+)
+
+type fuzzSystem struct {
+	name   string
+	config config.Config
+	flags  string // Flags of the command line simulating the same system
+}
+
+// fuzzModifier adds a feature to the system of a snooping protocol.
+type fuzzModifier struct {
+	name  string
+	apply func(c *config.Config)
+	flags string // Flags of the command line adding the same feature
+}
+
+// The DRAM model, whose banks delay the replies of memory, the random arbitration of the bus, which grants the requests
+// in another order than they are made, the bus trace, which is written to busTraceFile, and an inclusive L2 cache.
+func getFuzzModifiers(busTraceFile string) []fuzzModifier {
+	return []fuzzModifier{
+		{
+			name: "dram",
+			apply: func(c *config.Config) {
+				dram := config.DefaultDram()
+				dram.NumBanks = fuzzNumDramBanks
+				c.Memory.Dram = &dram
+			},
+			flags: fmt.Sprintf("-dram-banks %d", fuzzNumDramBanks),
+		},
+		{
+			name:  "random_arbitration",
+			apply: func(c *config.Config) { c.Bus.Arbitration.Policy = bus.Random },
+			flags: "-arbitration Random",
+		},
+		{
+			name: "bus_trace",
+			apply: func(c *config.Config) {
+				c.BusTrace.File = busTraceFile
+				c.BusTrace.Addresses = []uint32{fuzzBusTraceAddress}
+				c.BusTrace.FromCycle = fuzzBusTraceFromCycle
+			},
+			flags: fmt.Sprintf("-bus-trace %s -bus-trace-addr %d -bus-trace-from %d", busTraceFile,
+				fuzzBusTraceAddress, fuzzBusTraceFromCycle),
+		},
+		{
+			name: "l2",
+			apply: func(c *config.Config) {
+				l2 := config.DefaultL2()
+				l2.CacheSize = fuzzL2Size
+				l2.Associativity = fuzzL2Associativity
+				l2.BlockSize = c.L1.BlockSize
+				c.L2 = &l2
+			},
+			flags: fmt.Sprintf("-l2-size %d -l2-assoc %d", fuzzL2Size, fuzzL2Associativity),
+		},
+	}
+}
+
+// Every protocol on the atomic and on the split-transaction bus, with the coherence checker and the value tracking.
+// The snooping protocols also run with each of the fuzz modifiers, whose bus trace is written to traceDir.
+func getFuzzSystems(traceDir string) []fuzzSystem {
+	modifiers := getFuzzModifiers(filepath.Join(traceDir, "bus_trace.jsonl"))
+	systems := []fuzzSystem{}
+	for _, protocol := range []config.Protocol{config.Msi, config.Mesi, config.Mesif, config.Moesi, config.Dragon,
+		config.Firefly, config.DirMesi} {
+		for _, isSplitTransaction := range []bool{false, true} {
+			if protocol == config.DirMesi && isSplitTransaction {
+				continue
+			}
+
+			c := config.Default()
+			c.Protocol = protocol
+			c.L1.Size = testutils.FuzzCacheSize
+			c.L1.Associativity = testutils.FuzzAssociativity
+			c.L1.BlockSize = testutils.FuzzBlockSize
+			c.Bus.IsSplitTransaction = isSplitTransaction
+			c.CheckCoherence = true
+			c.TrackValues = protocol != config.DirMesi
+
+			system := fuzzSystem{name: protocol.String(), config: c, flags: "-check-coherence"}
+			if c.TrackValues {
+				system.flags += " -track-values"
+			}
+			if isSplitTransaction {
+				system.name += "_split"
+				system.flags += " -bus split"
+			}
+			systems = append(systems, system)
+
+			if protocol == config.DirMesi {
+				continue
+			}
+			for _, modifier := range modifiers {
+				modified := fuzzSystem{name: system.name + "_" + modifier.name, config: c,
+					flags: system.flags + " " + modifier.flags}
+				modifier.apply(&modified.config)
+				systems = append(systems, modified)
+			}
+		}
+	}
+	return systems
+}
+
+// Return the error of the simulation, including the panics which are not simulation errors. The statistics must be
+// the same when every cycle is executed instead of skipping the idle ones.
+func runFuzzTraces(c config.Config, traces testutils.Traces) error {
+	results, err := runFuzzSimulation(c, traces, false)
+	if err != nil {
+		return err
+	}
+	steppedResults, err := runFuzzSimulation(c, traces, true)
+	if err != nil {
+		return fmt.Errorf("simulation of every cycle: %v", err)
+	}
+
+	results.Duration, steppedResults.Duration = 0, 0
+	if !reflect.DeepEqual(results, steppedResults) {
+		return fmt.Errorf("statistics differ when every cycle is executed:\n%+v\n%+v", results, steppedResults)
+	}
+	return nil
+}
+
+func runFuzzSimulation(c config.Config, traces testutils.Traces, isStepped bool) (results stats.Results, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	c.NumCores = len(traces)
+	sim, err := New(c, traces.GetReaders())
+	if err != nil {
+		return stats.Results{}, err
+	}
+	if isStepped {
+		sim.(*simulator.BaseSimulator).DisableCycleSkipping()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), fuzzTimeout)
+	defer cancel()
+	results, err = sim.Run(ctx)
+	if err == context.DeadlineExceeded {
+		return stats.Results{}, fmt.Errorf("simulation does not finish in %s", fuzzTimeout)
+	}
+	return results, err
+}
+
+// FuzzProtocols runs the generated traces on every protocol. A failing trace is shrunk and written to
+// testdata/fuzz_failures/<system>, from where the simulator can run it again.
+func FuzzProtocols(f *testing.F) {
+	f.Add([]byte{0, 4, 1, 5, 1, 0, 1, 1, 1})
+	f.Add([]byte{1, 3, 0, 4, 8, 5, 16, 6, 24, 7, 0, 8, 8, 9, 16, 10, 24, 11, 0})
+	f.Add([]byte{2, 1, 0, 2, 0, 3, 0, 5, 0, 6, 0, 7, 0, 9, 64, 10, 64, 11, 64, 13, 8, 14, 8, 15, 8})
+
+	systems := getFuzzSystems(f.TempDir())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		traces := testutils.DecodeTraces(data)
+		for _, system := range systems {
+			err := runFuzzTraces(system.config, traces)
+			if err == nil {
+				continue
+			}
+
+			minimal := testutils.Shrink(traces, func(candidate testutils.Traces) bool {
+				return runFuzzTraces(system.config, candidate) != nil
+			})
+			dir, _ := filepath.Abs(filepath.Join("testdata", "fuzz_failures", system.name))
+			if writeErr := minimal.Write(dir, "trace"); writeErr != nil {
+				t.Fatalf("%s: %v\ncannot write the minimal traces: %v", system.name, err, writeErr)
+			}
+			t.Fatalf("%s: %v\nminimal traces of %d instructions: %v\nrun them with: coherence %s %s %s %d %d %d",
+				system.name, err, minimal.GetNumInstructions(), runFuzzTraces(system.config, minimal), system.flags,
+				system.config.Protocol, filepath.Join(dir, "trace"), testutils.FuzzCacheSize,
+				testutils.FuzzAssociativity, testutils.FuzzBlockSize)
+		}
+	})
+}
@@ -0,0 +1,64 @@
+package simulation
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/simulator"
+	"github.com/chriskheng/cs4223-assignment2/coherence/stats"
+	"github.com/chriskheng/cs4223-assignment2/coherence/testutils"
+)
+
+// The statistics taken in the middle of a simulation, e.g. by the debugger, only count the accesses which are
+// complete, so that a miss in progress does not make the number of hits negative.
+func TestStatisticsWhileStepping(t *testing.T) {
+	traces := make(testutils.Traces, 3)
+	for i := 0; i < 40; i++ {
+		for core := range traces {
+			op := testutils.LoadOp
+			if (i+core)%3 == 0 {
+				op = testutils.StoreOp
+			}
+			block := uint32(i*(core+1)) % testutils.FuzzNumBlocks
+			traces[core] = append(traces[core], testutils.Instruction{Op: op, Value: block * testutils.FuzzBlockSize})
+		}
+	}
+
+	for _, system := range getFuzzSystems(t.TempDir()) {
+		c := system.config
+		c.NumCores = len(traces)
+		sim, err := New(c, traces.GetReaders())
+		if err != nil {
+			t.Fatalf("%s: %v", system.name, err)
+		}
+
+		baseSimulator := sim.(*simulator.BaseSimulator)
+		for !baseSimulator.IsDone() {
+			if err := baseSimulator.Step(1); err != nil {
+				t.Fatalf("%s: %v", system.name, err)
+			}
+			if err := checkStatistics(baseSimulator.GetResults()); err != "" {
+				t.Fatalf("%s: cycle %d: %s", system.name, baseSimulator.GetCycle(), err)
+			}
+		}
+		if err := baseSimulator.CloseBusTrace(); err != nil {
+			t.Fatalf("%s: %v", system.name, err)
+		}
+	}
+}
+
+// Return what is inconsistent in the statistics of the cores, or an empty string.
+func checkStatistics(results stats.Results) string {
+	for i, core := range results.Cores {
+		numClassified := core.NumAccessesToPrivateData + core.NumAccessesToSharedData
+		switch {
+		case core.NumCacheMisses > core.NumCacheAccesses:
+			return testutils.GetErrorString(fmt.Sprintf("cache misses of core %d", i),
+				fmt.Sprintf("at most %d", core.NumCacheAccesses), fmt.Sprint(core.NumCacheMisses))
+		case numClassified != core.NumCacheAccesses:
+			return testutils.GetErrorString(fmt.Sprintf("private and shared accesses of core %d", i),
+				fmt.Sprint(core.NumCacheAccesses), fmt.Sprint(numClassified))
+		}
+	}
+	return ""
+}
@@ -5,59 +5,374 @@ type of cache coherence protocol simulator.
 package simulator
 
 import (
+	"context"
+	"fmt"
+	"os"
 	"time"
 
+	"github.com/chriskheng/cs4223-assignment2/coherence/bustrace"
+	"github.com/chriskheng/cs4223-assignment2/coherence/checker"
 	"github.com/chriskheng/cs4223-assignment2/coherence/components/bus"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/cache"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/clock"
 	"github.com/chriskheng/cs4223-assignment2/coherence/components/core"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/directory"
 	"github.com/chriskheng/cs4223-assignment2/coherence/components/memory"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/network"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/values"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/xact"
+	"github.com/chriskheng/cs4223-assignment2/coherence/constants"
+	"github.com/chriskheng/cs4223-assignment2/coherence/simerror"
 	"github.com/chriskheng/cs4223-assignment2/coherence/stats"
+	"github.com/chriskheng/cs4223-assignment2/coherence/watchdog"
 )
 
 type BaseSimulator struct {
-	cores  []*core.Core
-	bus    *bus.Bus
-	memory *memory.Memory
+	cores     []*core.Core
+	bus       *bus.Bus
+	memory    *memory.Memory
+	network   *network.Network // Only used in directory-based coherence, in which case bus and memory are nil
+	directory *directory.Directory
+	clock     *clock.Clock       // Shared by every component, advanced once every component has executed the cycle
+	checker   *checker.Checker   // nil if the coherence invariants are not checked
+	watchdog  *watchdog.Watchdog // nil if the simulation is never stopped for taking too long
+	dumpFile  string
+	isStepped bool // True if every cycle is executed, even the ones in which every component is idle
+
+	busTrace     *bustrace.Tracer // nil if the events of the bus are not written
+	busTraceFile *os.File
 }
 
-func NewBaseSimulator(cores []*core.Core, bus *bus.Bus, memory *memory.Memory) *BaseSimulator {
+func NewBaseSimulator(cores []*core.Core, bus *bus.Bus, memory *memory.Memory, clock *clock.Clock) *BaseSimulator {
 	return &BaseSimulator{
 		cores:  cores,
 		bus:    bus,
 		memory: memory,
+		clock:  clock,
+	}
+}
+
+func NewDirectoryBaseSimulator(cores []*core.Core, network *network.Network, directory *directory.Directory,
+	clock *clock.Clock) *BaseSimulator {
+	return &BaseSimulator{
+		cores:     cores,
+		network:   network,
+		directory: directory,
+		clock:     clock,
+	}
+}
+
+// Check the coherence invariants after every cycle in which there are transactions on the bus or the network. Run
+// returns a *simerror.CoherenceError on the first violation. blockSize is in bytes.
+func (s *BaseSimulator) EnableCoherenceChecker(blockSize int) {
+	caches := []cache.CacheController{}
+	for i := range s.cores {
+		caches = append(caches, s.cores[i].GetCache())
+	}
+	s.checker = checker.NewChecker(caches, blockSize)
+	s.ObserveTransactions(s.checker.OnTransaction)
+}
+
+// Give every store a unique value and check that every load returns the value of the last store to its word. Run
+// returns a *simerror.StaleReadError on the first stale read. Only the simulators with a bus track the values.
+// blockSize is in bytes.
+func (s *BaseSimulator) EnableValueTracking(blockSize int) {
+	tracker := values.NewTracker(blockSize)
+	s.memory.EnableValueTracking(tracker)
+	for i := range s.cores {
+		s.cores[i].GetCache().EnableValueTracking(tracker)
+	}
+}
+
+// Stop the simulation when it makes no progress or takes more cycles than allowed, in which case Run returns a
+// *simerror.WatchdogError with the state of every component, which is also written to the dump file if given.
+func (s *BaseSimulator) EnableWatchdog(config watchdog.Config) {
+	s.watchdog = watchdog.NewWatchdog(config, s.cores)
+	s.dumpFile = config.DumpFile
+	s.ObserveTransactions(s.watchdog.OnTransaction)
+}
+
+// Write every event of the bus to the JSON Lines file of the configuration, see package bustrace. Only the simulators
+// with a bus have events to write. blockSize is in bytes.
+func (s *BaseSimulator) EnableBusTrace(config bustrace.Config, blockSize int) error {
+	file, err := os.Create(config.File)
+	if err != nil {
+		return fmt.Errorf("cannot create the bus trace: %w", err)
+	}
+
+	caches := []cache.CacheController{}
+	for i := range s.cores {
+		caches = append(caches, s.cores[i].GetCache())
+	}
+	s.busTrace = bustrace.NewTracer(config, caches, blockSize, s.clock, file)
+	s.busTraceFile = file
+	s.bus.RegisterEventObserver(s.busTrace)
+	return nil
+}
+
+// Write the events of the bus left in the buffer and close the file of the bus trace. Run does it before returning,
+// a simulation stepped with Step MUST do it once it is over.
+func (s *BaseSimulator) CloseBusTrace() error {
+	if s.busTraceFile == nil {
+		return nil
+	}
+
+	err := s.busTrace.Flush()
+	if closeErr := s.busTraceFile.Close(); err == nil {
+		err = closeErr
+	}
+	s.busTraceFile = nil
+	if err != nil {
+		return fmt.Errorf("cannot write the bus trace: %w", err)
 	}
+	return nil
+}
+
+// Register a callback to be called with every transaction snooped on the bus or delivered by the network.
+func (s *BaseSimulator) ObserveTransactions(callback xact.SnoopingCallBack) {
+	if s.bus != nil {
+		s.bus.RegisterSnoopingCallBack(callback)
+	} else {
+		s.network.RegisterObserver(callback)
+	}
+}
+
+// Execute every cycle instead of skipping the cycles in which every component is idle. The statistics are the same,
+// only the simulation is slower.
+func (s *BaseSimulator) DisableCycleSkipping() {
+	s.isStepped = true
 }
 
-func (s *BaseSimulator) Run() {
+// The context is checked every contextCheckInterval cycles, since checking it takes longer than simulating a cycle.
+const contextCheckInterval = 1024
+
+// Run the simulation until every core is done, or until the context is done in which case its error is returned. A
+// *simerror.Error is returned if a component receives something its protocol does not allow, a *simerror.TraceError
+// if a trace cannot be read, a *simerror.CoherenceError if the coherence checker finds a violation, a
+// *simerror.StaleReadError if a load returns a stale value, and a *simerror.WatchdogError if the watchdog stops it.
+func (s *BaseSimulator) Run(ctx context.Context) (results stats.Results, err error) {
 	start := time.Now()
-	iter := 0
-	for !s.isAllCoresDone() {
-		for i := 0; i < len(s.cores); i++ {
-			s.cores[i].Execute()
+	defer func() {
+		if r := recover(); r != nil {
+			results, err = stats.Results{}, s.recoverError(r, s.clock.GetCycle())
+		}
+		if closeErr := s.CloseBusTrace(); closeErr != nil && err == nil {
+			results, err = stats.Results{}, closeErr
+		}
+	}()
+
+	nextContextCheck := s.clock.GetCycle()
+	for !s.IsDone() {
+		cycle := s.clock.GetCycle()
+		if cycle >= nextContextCheck {
+			if err := ctx.Err(); err != nil {
+				return stats.Results{}, err
+			}
+			nextContextCheck = cycle + contextCheckInterval
+		}
+
+		// The context is still checked if every component is idle forever, as in a deadlock.
+		if err := s.advance(nextContextCheck - cycle); err != nil {
+			return stats.Results{}, err
 		}
+	}
+
+	results = s.GetResults()
+	results.Duration = time.Since(start)
+	return results, nil
+}
+
+// Execute the next cycle, or skip at most maxCycles of the idle cycles ahead, e.g. to step through the simulation in
+// a debugger. The same errors as Run are returned, after which the simulation cannot go on.
+func (s *BaseSimulator) Step(maxCycles int) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = s.recoverError(r, s.clock.GetCycle())
+		}
+	}()
+	return s.advance(maxCycles)
+}
+
+func (s *BaseSimulator) advance(maxCycles int) error {
+	cycle := s.clock.GetCycle()
+	if s.watchdog != nil {
+		if reason := s.watchdog.Check(cycle); reason != "" {
+			return s.stopByWatchdog(cycle, reason)
+		}
+	}
+
+	// Nothing happens in idle cycles but counting them, so they are skipped at once.
+	if numIdleCycles := s.getNumIdleCycles(); numIdleCycles > 0 {
+		numIdleCycles = min(numIdleCycles, maxCycles)
+		if s.watchdog != nil {
+			numIdleCycles = min(numIdleCycles, s.watchdog.GetNumCyclesLeft(cycle))
+		}
+		s.skipIdleCycles(numIdleCycles)
+		s.advanceClock(numIdleCycles)
+		return nil
+	}
 
+	for i := 0; i < len(s.cores); i++ {
+		s.cores[i].Execute()
+	}
+
+	if s.bus != nil {
 		s.bus.Execute()
 		s.memory.Execute()
-		iter++
+	} else {
+		s.network.Execute()
+		s.directory.Execute()
 	}
-	elapsed := time.Since(start)
 
-	coreStats := []stats.Stats{}
+	if s.checker != nil {
+		if violation := s.checker.Check(); violation != nil {
+			violation.Cycle = cycle
+			return violation
+		}
+	}
+	s.advanceClock(1)
+	return nil
+}
+
+// Return the error a component panicked with, after adding the cycle and the state of the interconnect. Any other
+// panic is a bug of the simulator and is not recovered.
+func (s *BaseSimulator) recoverError(r interface{}, cycle int) error {
+	switch err := r.(type) {
+	case *simerror.Error:
+		err.Cycle = cycle
+		if err.BusState == "" && s.bus != nil {
+			err.BusState = s.bus.GetStateDescription()
+		}
+		return err
+	case *simerror.StaleReadError:
+		err.Cycle = cycle
+		return err
+	case *simerror.TraceError:
+		return err
+	default:
+		panic(r)
+	}
+}
+
+// Return the number of next cycles in which every component is idle, which is 0 if cycle skipping is disabled.
+func (s *BaseSimulator) getNumIdleCycles() int {
+	if s.isStepped {
+		return 0
+	}
+
+	numIdleCycles := constants.IdleForever
 	for i := range s.cores {
-		coreStats = append(coreStats, s.cores[i].GetStatistics())
+		if numIdleCycles = min(numIdleCycles, s.cores[i].GetNumIdleCycles()); numIdleCycles == 0 {
+			return 0
+		}
 	}
 
+	if s.bus != nil {
+		numIdleCycles = min(numIdleCycles, s.bus.GetNumIdleCycles())
+		return min(numIdleCycles, s.memory.GetNumIdleCycles())
+	}
+	numIdleCycles = min(numIdleCycles, s.network.GetNumIdleCycles())
+	return min(numIdleCycles, s.directory.GetNumIdleCycles())
+}
+
+func (s *BaseSimulator) advanceClock(numCycles int) {
+	s.clock.Advance(numCycles)
+	if s.watchdog != nil {
+		s.watchdog.Update(s.clock.GetCycle())
+	}
+}
+
+func (s *BaseSimulator) skipIdleCycles(numCycles int) {
+	for i := range s.cores {
+		s.cores[i].SkipIdleCycles(numCycles)
+	}
+	// Memory, the network and the directory only compare the clock with the cycles their operations are done.
+	if s.bus != nil {
+		s.bus.SkipIdleCycles(numCycles)
+	}
+}
+
+// Return the statistics of the cycles simulated so far, without the duration of the simulation.
+func (s *BaseSimulator) GetResults() stats.Results {
+	results := stats.Results{}
+	for i := range s.cores {
+		results.Cores = append(results.Cores, s.cores[i].GetStatistics())
+	}
+
+	if s.bus != nil {
+		s.addBusStats(&results)
+	} else {
+		s.addDirectoryStats(&results)
+	}
+	return results
+}
+
+// The cache ids are the core indices. A core which never requested the bus has no stats in the bus.
+func (s *BaseSimulator) addBusStats(results *stats.Results) {
 	busStats := s.bus.GetStatistics()
-	otherStats := stats.OtherStats{
-		DataTrafficOnBus: busStats.DataTraffic,
+	results.Bus = stats.BusStats{
+		DataTraffic:      busStats.DataTraffic,
 		NumInvalidations: busStats.NumInvalidations,
 		NumUpdates:       busStats.NumUpdates,
+		NumWriteBacks:    busStats.NumWriteBacks,
+	}
+
+	for i := range results.Cores {
+		if i < len(busStats.Requesters) {
+			results.Cores[i].NumBusGrants = busStats.Requesters[i].NumGrants
+			results.Cores[i].NumBusWaitCycles = busStats.Requesters[i].NumWaitCycles
+			results.Cores[i].MaxBusWaitCycles = busStats.Requesters[i].MaxWaitCycles
+		}
+	}
+
+	if s.memory.HasL2Cache() {
+		l2Stats := s.memory.GetL2Statistics()
+		results.Memory.L2 = &stats.L2Stats{
+			NumAccesses:          l2Stats.NumAccesses,
+			NumMisses:            l2Stats.NumMisses,
+			NumBackInvalidations: l2Stats.NumBackInvalidations,
+			NumWriteBacks:        l2Stats.NumWriteBacks,
+		}
+	}
+
+	if s.memory.HasDram() {
+		dramStats := s.memory.GetDramStatistics()
+		results.Memory.Dram = &stats.DramStats{
+			NumAccesses:           dramStats.NumAccesses,
+			NumRowBufferHits:      dramStats.NumRowBufferHits,
+			NumRowBufferConflicts: dramStats.NumRowBufferConflicts,
+			NumLatencyCycles:      dramStats.NumLatencyCycles,
+		}
+	}
+}
+
+// The stats of the network are given as the bus stats.
+func (s *BaseSimulator) addDirectoryStats(results *stats.Results) {
+	networkStats := s.network.GetStatistics()
+	directoryStats := s.directory.GetStatistics()
+	results.Bus = stats.BusStats{
+		DataTraffic:      networkStats.DataTraffic,
+		NumInvalidations: directoryStats.NumInvalidations,
+		NumWriteBacks:    directoryStats.NumWriteBacks,
+	}
+	results.Directory = &stats.DirectoryStats{
+		NumLookups:        directoryStats.NumLookups,
+		NumMessages:       networkStats.NumMessages,
+		NumTwoHopMisses:   directoryStats.NumTwoHopMisses,
+		NumThreeHopMisses: directoryStats.NumThreeHopMisses,
 	}
+}
+
+func (s *BaseSimulator) GetCycle() int {
+	return s.clock.GetCycle()
+}
 
-	stats.PrintStatistics(elapsed, coreStats, otherStats)
-	stats.PrintStatisticsCsv(elapsed, coreStats, otherStats)
+func (s *BaseSimulator) GetCores() []*core.Core {
+	return s.cores
 }
 
-func (s *BaseSimulator) isAllCoresDone() bool {
+// Return true once every core is done, which ends the simulation.
+func (s *BaseSimulator) IsDone() bool {
 	for i := range s.cores {
 		if !s.cores[i].IsDone() {
 			return false
@@ -65,3 +380,10 @@ func (s *BaseSimulator) isAllCoresDone() bool {
 	}
 	return true
 }
+
+func min(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
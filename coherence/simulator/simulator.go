@@ -1,5 +1,11 @@
 package simulator
 
+import (
+	"context"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/stats"
+)
+
 type Simulator interface {
-	Run()
+	Run(ctx context.Context) (stats.Results, error)
 }
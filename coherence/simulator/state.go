@@ -0,0 +1,46 @@
+package simulator
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/simerror"
+)
+
+// Write the state of every core and cache controller, and of the bus and memory or of the network and the directory.
+func (s *BaseSimulator) WriteState(w io.Writer) {
+	fmt.Fprintf(w, "cycle %d\n", s.clock.GetCycle())
+	for i := range s.cores {
+		s.cores[i].WriteState(w)
+	}
+	s.WriteInterconnectState(w)
+}
+
+// Write the state of the bus, its requesters and memory, or of the network and the directory.
+func (s *BaseSimulator) WriteInterconnectState(w io.Writer) {
+	if s.bus != nil {
+		s.bus.WriteState(w)
+		s.memory.WriteState(w)
+	} else {
+		s.network.WriteState(w)
+		s.directory.WriteState(w)
+	}
+}
+
+// Return the error stopping the simulation, after writing the state of the system to the dump file if there is one.
+func (s *BaseSimulator) stopByWatchdog(cycle int, reason string) error {
+	state := &strings.Builder{}
+	s.WriteState(state)
+	err := &simerror.WatchdogError{Cycle: cycle, Reason: reason, State: state.String()}
+	if s.dumpFile == "" {
+		return err
+	}
+
+	if writeErr := os.WriteFile(s.dumpFile, []byte(err.Error()+"\n\n"+err.State), 0644); writeErr != nil {
+		return fmt.Errorf("%w, and the state of the system cannot be written: %v", err, writeErr)
+	}
+	err.DumpFile = s.dumpFile
+	return err
+}
@@ -0,0 +1,162 @@
+package stats
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Reporter writes the results of a simulation along with the configuration of the simulated system.
+type Reporter interface {
+	Report(w io.Writer, run RunInfo, results Results) error
+}
+
+// RunInfo describes the simulated system in the reports.
+type RunInfo struct {
+	Protocol      string `json:"protocol"`
+	Trace         string `json:"trace"` // Prefix of the trace files
+	NumCores      int    `json:"num_cores"`
+	CacheSize     int    `json:"cache_size"` // In Bytes
+	Associativity int    `json:"associativity"`
+	BlockSize     int    `json:"block_size"` // In Bytes
+}
+
+func NewTextReporter() Reporter {
+	return &textReporter{}
+}
+
+// Return a reporter writing a JSON object with the run, the statistics of the whole system and the results.
+func NewJsonReporter() Reporter {
+	return &jsonReporter{}
+}
+
+// Return a reporter writing a CSV table with a header and a row for every core. Every row holds the run, the
+// statistics of the whole system and the statistics of the core. The columns are the same whatever the simulated
+// system, those of the statistics it does not have are empty.
+func NewCsvReporter() Reporter {
+	return &csvReporter{}
+}
+
+type textReporter struct{}
+
+func (r *textReporter) Report(w io.Writer, run RunInfo, results Results) error {
+	fmt.Fprintf(w, "Run:\n")
+	fmt.Fprintf(w, "Protocol: %s\n", run.Protocol)
+	fmt.Fprintf(w, "Trace: %s\n", run.Trace)
+	fmt.Fprintf(w, "Num cores: %d\n", run.NumCores)
+	fmt.Fprintf(w, "Cache size: %d bytes\n", run.CacheSize)
+	fmt.Fprintf(w, "Associativity: %d\n", run.Associativity)
+	fmt.Fprintf(w, "Block size: %d bytes\n", run.BlockSize)
+	fmt.Fprintf(w, "======================================================\n")
+	PrintStatistics(w, results)
+	return nil
+}
+
+type jsonReporter struct{}
+
+type jsonReport struct {
+	Run            RunInfo `json:"run"`
+	TimeMs         int64   `json:"time_ms"`
+	TotalCycles    int     `json:"total_cycles"`
+	TotalEvictions int     `json:"total_evictions"`
+	Results
+}
+
+func (r *jsonReporter) Report(w io.Writer, run RunInfo, results Results) error {
+	report := jsonReport{
+		Run:            run,
+		TimeMs:         results.Duration.Milliseconds(),
+		TotalCycles:    results.GetTotalCycles(),
+		TotalEvictions: results.GetTotalEvictions(),
+		Results:        results,
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+type csvReporter struct{}
+
+var csvReportColumns = []string{
+	"protocol", "trace", "num_cores", "cache_size", "associativity", "block_size",
+	"time_ms", "total_cycles", "total_evictions",
+	"data_traffic", "invalidations", "updates", "write_backs",
+	"directory_lookups", "directory_messages", "two_hop_misses", "three_hop_misses",
+	"l2_accesses", "l2_misses", "l2_miss_rate", "l2_back_invalidations", "l2_write_backs",
+	"dram_accesses", "dram_row_buffer_hits", "dram_row_buffer_conflicts", "dram_row_buffer_hit_rate",
+	"dram_average_latency",
+	"core", "execution_cycles", "compute_cycles", "loads", "stores", "idle_cycles", "cache_hits", "cache_misses",
+	"cache_miss_rate", "evictions", "accesses_to_private_data", "accesses_to_shared_data", "bus_grants",
+	"bus_wait_cycles", "max_bus_wait_cycles",
+}
+
+func (r *csvReporter) Report(w io.Writer, run RunInfo, results Results) error {
+	cw := csv.NewWriter(w)
+	cw.Write(csvReportColumns)
+
+	system := []string{
+		run.Protocol, run.Trace, itoa(run.NumCores), itoa(run.CacheSize), itoa(run.Associativity), itoa(run.BlockSize),
+		strconv.FormatInt(results.Duration.Milliseconds(), 10), itoa(results.GetTotalCycles()),
+		itoa(results.GetTotalEvictions()),
+		itoa(results.Bus.DataTraffic), itoa(results.Bus.NumInvalidations), itoa(results.Bus.NumUpdates),
+		itoa(results.Bus.NumWriteBacks),
+	}
+
+	if d := results.Directory; d != nil {
+		system = append(system, itoa(d.NumLookups), itoa(d.NumMessages), itoa(d.NumTwoHopMisses),
+			itoa(d.NumThreeHopMisses))
+	} else {
+		system = append(system, "", "", "", "")
+	}
+
+	if l2 := results.Memory.L2; l2 != nil {
+		system = append(system, itoa(l2.NumAccesses), itoa(l2.NumMisses), ftoa(getL2MissRate(*l2)),
+			itoa(l2.NumBackInvalidations), itoa(l2.NumWriteBacks))
+	} else {
+		system = append(system, "", "", "", "", "")
+	}
+
+	if dram := results.Memory.Dram; dram != nil {
+		system = append(system, itoa(dram.NumAccesses), itoa(dram.NumRowBufferHits), itoa(dram.NumRowBufferConflicts),
+			ftoa(getRowBufferHitRate(*dram)), ftoa(getAverageMemoryLatency(*dram)))
+	} else {
+		system = append(system, "", "", "", "", "")
+	}
+
+	for i, stats := range results.Cores {
+		row := append([]string{}, system...)
+		row = append(row,
+			itoa(i),
+			itoa(getExecutionCycles(stats)),
+			itoa(stats.NumComputeCycles),
+			itoa(stats.NumLoads),
+			itoa(stats.NumStores),
+			itoa(stats.NumIdleCycles),
+			itoa(getNumCacheHits(stats)),
+			itoa(stats.NumCacheMisses),
+			ftoa(getCacheMissRate(stats)),
+			itoa(stats.NumEvictions),
+			itoa(stats.NumAccessesToPrivateData),
+			itoa(stats.NumAccessesToSharedData),
+			itoa(stats.NumBusGrants),
+			itoa(stats.NumBusWaitCycles),
+			itoa(stats.MaxBusWaitCycles),
+		)
+		cw.Write(row)
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func itoa(value int) string {
+	return strconv.Itoa(value)
+}
+
+// The rates are written with 3 decimals, the same as in the text.
+func ftoa(value float64) string {
+	return strconv.FormatFloat(value, 'f', 3, 64)
+}
@@ -5,79 +5,188 @@ package stats
 
 import (
 	"fmt"
-	"os"
+	"io"
+	"strings"
 	"time"
 )
 
 type Stats struct {
-	NumComputeCycles         int
-	NumLoads                 int
-	NumStores                int
-	NumIdleCycles            int
-	NumAccessesToPrivateData int
-	NumAccessesToSharedData  int
-	NumCacheMisses           int
-	NumCacheAccesses         int
-}
-
-type OtherStats struct {
-	DataTrafficOnBus int // In Bytes
-	NumInvalidations int
-	NumUpdates       int
-}
-
-func PrintStatistics(duration time.Duration, stats []Stats, otherStats OtherStats) {
-	fmt.Printf("Overall stats:\n")
-	fmt.Printf("Total time taken: %d ms\n", duration.Milliseconds())
-	fmt.Printf("Total Cycles: %d\n", getMaxCycles(stats))
-
-	fmt.Printf("======================================================\n")
-	fmt.Printf("Bus stats:\n")
-	fmt.Printf("Total data traffic on bus: %d bytes\n", otherStats.DataTrafficOnBus)
-	fmt.Printf("Total invalidations: %d\n", otherStats.NumInvalidations)
-	fmt.Printf("Total updates: %d\n", otherStats.NumUpdates)
-
-	for i := range stats {
-		fmt.Printf("======================================================\n")
-		fmt.Printf("Core %d:\n", i)
-		fmt.Printf("Execution cycles: %d\n", getExecutionCycles(stats[i]))
-		fmt.Printf("Compute cycles: %d\n", stats[i].NumComputeCycles)
-		fmt.Printf("Num loads: %d\n", stats[i].NumLoads)
-		fmt.Printf("Num stores: %d\n", stats[i].NumStores)
-		fmt.Printf("Idle cycles: %d\n", stats[i].NumIdleCycles)
-		fmt.Printf("Num cache hits: %d\n", getNumCacheHits(stats[i]))
-		fmt.Printf("Num cache misses: %d\n", stats[i].NumCacheMisses)
-		fmt.Printf("Data cache miss rate: %.3f\n", getCacheMissRate(stats[i]))
-		fmt.Printf("Num accesses to private data: %d\n", stats[i].NumAccessesToPrivateData)
-		fmt.Printf("Num accesses to shared data: %d\n", stats[i].NumAccessesToSharedData)
-	}
-}
-
-func PrintStatisticsCsv(duration time.Duration, stats []Stats, otherStats OtherStats) {
-	fmt.Fprintf(os.Stderr, "%d,%d\n", duration.Milliseconds(), getMaxCycles(stats))
-	fmt.Fprintf(os.Stderr, "%d,%d,%d\n", otherStats.DataTrafficOnBus, otherStats.NumInvalidations, otherStats.NumUpdates)
-
-	for i := range stats {
-		fmt.Fprintf(os.Stderr, "%d,%d,%d,%d,%d,%d,%d,%d,%.3f,%d,%d\n",
+	NumComputeCycles         int `json:"compute_cycles"`
+	NumLoads                 int `json:"loads"`
+	NumStores                int `json:"stores"`
+	NumIdleCycles            int `json:"idle_cycles"`
+	NumAccessesToPrivateData int `json:"accesses_to_private_data"`
+	NumAccessesToSharedData  int `json:"accesses_to_shared_data"`
+	NumCacheMisses           int `json:"cache_misses"`
+	NumCacheAccesses         int `json:"cache_accesses"`
+	NumEvictions             int `json:"evictions"`
+	NumBusGrants             int `json:"bus_grants"` // Only set if there is a bus
+	NumBusWaitCycles         int `json:"bus_wait_cycles"`
+	MaxBusWaitCycles         int `json:"max_bus_wait_cycles"`
+}
+
+// Results are the statistics of a whole simulation.
+type Results struct {
+	Duration  time.Duration   `json:"-"` // Time taken to run the simulation
+	Cores     []Stats         `json:"cores"`
+	Bus       BusStats        `json:"bus"`       // Of the network in directory-based coherence
+	Directory *DirectoryStats `json:"directory"` // Only set in directory-based coherence
+	Memory    MemoryStats     `json:"memory"`
+}
+
+type BusStats struct {
+	DataTraffic      int `json:"data_traffic"` // In Bytes
+	NumInvalidations int `json:"invalidations"`
+	NumUpdates       int `json:"updates"`
+	NumWriteBacks    int `json:"write_backs"`
+}
+
+type MemoryStats struct {
+	L2   *L2Stats   `json:"l2"`   // Only set if there is a shared L2 cache
+	Dram *DramStats `json:"dram"` // Only set if the DRAM model is used
+}
+
+type DirectoryStats struct {
+	NumLookups        int `json:"lookups"`
+	NumMessages       int `json:"messages"`
+	NumTwoHopMisses   int `json:"two_hop_misses"`
+	NumThreeHopMisses int `json:"three_hop_misses"`
+}
+
+type L2Stats struct {
+	NumAccesses          int `json:"accesses"`
+	NumMisses            int `json:"misses"`
+	NumBackInvalidations int `json:"back_invalidations"`
+	NumWriteBacks        int `json:"write_backs"`
+}
+
+type DramStats struct {
+	NumAccesses           int `json:"accesses"`
+	NumRowBufferHits      int `json:"row_buffer_hits"`
+	NumRowBufferConflicts int `json:"row_buffer_conflicts"`
+	NumLatencyCycles      int `json:"latency_cycles"`
+}
+
+func PrintStatistics(w io.Writer, results Results) {
+	fmt.Fprintf(w, "Overall stats:\n")
+	fmt.Fprintf(w, "Total time taken: %d ms\n", results.Duration.Milliseconds())
+	fmt.Fprintf(w, "Total Cycles: %d\n", results.GetTotalCycles())
+	fmt.Fprintf(w, "Total evictions: %d\n", results.GetTotalEvictions())
+
+	fmt.Fprintf(w, "======================================================\n")
+	interconnect := "bus"
+	if results.Directory != nil {
+		interconnect = "network"
+	}
+	fmt.Fprintf(w, "%s stats:\n", strings.Title(interconnect))
+	fmt.Fprintf(w, "Total data traffic on %s: %d bytes\n", interconnect, results.Bus.DataTraffic)
+	fmt.Fprintf(w, "Total invalidations: %d\n", results.Bus.NumInvalidations)
+	fmt.Fprintf(w, "Total updates: %d\n", results.Bus.NumUpdates)
+	fmt.Fprintf(w, "Total write backs to memory: %d\n", results.Bus.NumWriteBacks)
+	if results.Directory == nil {
+		fmt.Fprintf(w, "Max bus wait cycles: %d\n", results.GetMaxBusWaitCycles())
+	}
+
+	if results.Directory != nil {
+		fmt.Fprintf(w, "======================================================\n")
+		fmt.Fprintf(w, "Directory stats:\n")
+		fmt.Fprintf(w, "Total directory lookups: %d\n", results.Directory.NumLookups)
+		fmt.Fprintf(w, "Total messages sent: %d\n", results.Directory.NumMessages)
+		fmt.Fprintf(w, "Messages sent per miss: %.3f\n", getMessagesPerMiss(*results.Directory))
+		fmt.Fprintf(w, "2-hop misses: %d\n", results.Directory.NumTwoHopMisses)
+		fmt.Fprintf(w, "3-hop misses: %d\n", results.Directory.NumThreeHopMisses)
+	}
+
+	if results.Memory.L2 != nil {
+		fmt.Fprintf(w, "======================================================\n")
+		fmt.Fprintf(w, "L2 cache stats:\n")
+		fmt.Fprintf(w, "Num L2 accesses: %d\n", results.Memory.L2.NumAccesses)
+		fmt.Fprintf(w, "Num L2 hits: %d\n", results.Memory.L2.NumAccesses-results.Memory.L2.NumMisses)
+		fmt.Fprintf(w, "Num L2 misses: %d\n", results.Memory.L2.NumMisses)
+		fmt.Fprintf(w, "L2 hit rate: %.3f\n", 1-getL2MissRate(*results.Memory.L2))
+		fmt.Fprintf(w, "L2 miss rate: %.3f\n", getL2MissRate(*results.Memory.L2))
+		fmt.Fprintf(w, "Back invalidations: %d\n", results.Memory.L2.NumBackInvalidations)
+		fmt.Fprintf(w, "L2 write backs to memory: %d\n", results.Memory.L2.NumWriteBacks)
+	}
+
+	if results.Memory.Dram != nil {
+		fmt.Fprintf(w, "======================================================\n")
+		fmt.Fprintf(w, "DRAM stats:\n")
+		fmt.Fprintf(w, "Num DRAM accesses: %d\n", results.Memory.Dram.NumAccesses)
+		fmt.Fprintf(w, "Num row buffer hits: %d\n", results.Memory.Dram.NumRowBufferHits)
+		fmt.Fprintf(w, "Num row buffer conflicts: %d\n", results.Memory.Dram.NumRowBufferConflicts)
+		fmt.Fprintf(w, "Row buffer hit rate: %.3f\n", getRowBufferHitRate(*results.Memory.Dram))
+		fmt.Fprintf(w, "Average memory latency: %.3f cycles\n", getAverageMemoryLatency(*results.Memory.Dram))
+	}
+
+	for i, stats := range results.Cores {
+		fmt.Fprintf(w, "======================================================\n")
+		fmt.Fprintf(w, "Core %d:\n", i)
+		fmt.Fprintf(w, "Execution cycles: %d\n", getExecutionCycles(stats))
+		fmt.Fprintf(w, "Compute cycles: %d\n", stats.NumComputeCycles)
+		fmt.Fprintf(w, "Num loads: %d\n", stats.NumLoads)
+		fmt.Fprintf(w, "Num stores: %d\n", stats.NumStores)
+		fmt.Fprintf(w, "Idle cycles: %d\n", stats.NumIdleCycles)
+		fmt.Fprintf(w, "Num cache hits: %d\n", getNumCacheHits(stats))
+		fmt.Fprintf(w, "Num cache misses: %d\n", stats.NumCacheMisses)
+		fmt.Fprintf(w, "Data cache miss rate: %.3f\n", getCacheMissRate(stats))
+		fmt.Fprintf(w, "Num evictions: %d\n", stats.NumEvictions)
+		fmt.Fprintf(w, "Num accesses to private data: %d\n", stats.NumAccessesToPrivateData)
+		fmt.Fprintf(w, "Num accesses to shared data: %d\n", stats.NumAccessesToSharedData)
+		if results.Directory == nil {
+			fmt.Fprintf(w, "Num bus grants: %d\n", stats.NumBusGrants)
+			fmt.Fprintf(w, "Bus wait cycles: %d\n", stats.NumBusWaitCycles)
+			fmt.Fprintf(w, "Average bus wait cycles: %.3f\n", getAverageBusWaitCycles(stats))
+			fmt.Fprintf(w, "Max bus wait cycles: %d\n", stats.MaxBusWaitCycles)
+		}
+	}
+}
+
+func PrintStatisticsCsv(w io.Writer, results Results) {
+	fmt.Fprintf(w, "%d,%d,%d\n", results.Duration.Milliseconds(), results.GetTotalCycles(), results.GetTotalEvictions())
+	fmt.Fprintf(w, "%d,%d,%d,%d\n", results.Bus.DataTraffic, results.Bus.NumInvalidations, results.Bus.NumUpdates,
+		results.Bus.NumWriteBacks)
+	if results.Directory != nil {
+		fmt.Fprintf(w, "%d,%d,%.3f,%d,%d\n", results.Directory.NumLookups, results.Directory.NumMessages,
+			getMessagesPerMiss(*results.Directory), results.Directory.NumTwoHopMisses,
+			results.Directory.NumThreeHopMisses)
+	}
+	if results.Memory.L2 != nil {
+		fmt.Fprintf(w, "%d,%d,%.3f,%d,%d\n", results.Memory.L2.NumAccesses, results.Memory.L2.NumMisses,
+			getL2MissRate(*results.Memory.L2), results.Memory.L2.NumBackInvalidations, results.Memory.L2.NumWriteBacks)
+	}
+	if results.Memory.Dram != nil {
+		fmt.Fprintf(w, "%d,%d,%d,%.3f,%.3f\n", results.Memory.Dram.NumAccesses, results.Memory.Dram.NumRowBufferHits,
+			results.Memory.Dram.NumRowBufferConflicts, getRowBufferHitRate(*results.Memory.Dram),
+			getAverageMemoryLatency(*results.Memory.Dram))
+	}
+
+	for i, stats := range results.Cores {
+		fmt.Fprintf(w, "%d,%d,%d,%d,%d,%d,%d,%d,%.3f,%d,%d,%d,%d,%d,%d\n",
 			i,
-			getExecutionCycles(stats[i]),
-			stats[i].NumComputeCycles,
-			stats[i].NumLoads,
-			stats[i].NumStores,
-			stats[i].NumIdleCycles,
-			getNumCacheHits(stats[i]),
-			stats[i].NumCacheMisses,
-			getCacheMissRate(stats[i]),
-			stats[i].NumAccessesToPrivateData,
-			stats[i].NumAccessesToSharedData,
+			getExecutionCycles(stats),
+			stats.NumComputeCycles,
+			stats.NumLoads,
+			stats.NumStores,
+			stats.NumIdleCycles,
+			getNumCacheHits(stats),
+			stats.NumCacheMisses,
+			getCacheMissRate(stats),
+			stats.NumAccessesToPrivateData,
+			stats.NumAccessesToSharedData,
+			stats.NumEvictions,
+			stats.NumBusGrants,
+			stats.NumBusWaitCycles,
+			stats.MaxBusWaitCycles,
 		)
 	}
 }
 
-func getMaxCycles(stats []Stats) int {
+// Return the number of cycles until the last core is done.
+func (r Results) GetTotalCycles() int {
 	max := 0
-	for i := range stats {
-		numCycles := getExecutionCycles(stats[i])
+	for i := range r.Cores {
+		numCycles := getExecutionCycles(r.Cores[i])
 		if numCycles > max {
 			max = numCycles
 		}
@@ -85,6 +194,31 @@ func getMaxCycles(stats []Stats) int {
 	return max
 }
 
+func (r Results) GetTotalEvictions() int {
+	total := 0
+	for i := range r.Cores {
+		total += r.Cores[i].NumEvictions
+	}
+	return total
+}
+
+func (r Results) GetMaxBusWaitCycles() int {
+	max := 0
+	for i := range r.Cores {
+		if r.Cores[i].MaxBusWaitCycles > max {
+			max = r.Cores[i].MaxBusWaitCycles
+		}
+	}
+	return max
+}
+
+func getAverageBusWaitCycles(stats Stats) float64 {
+	if stats.NumBusGrants == 0 {
+		return 0
+	}
+	return float64(stats.NumBusWaitCycles) / float64(stats.NumBusGrants)
+}
+
 func getExecutionCycles(stats Stats) int {
 	return stats.NumComputeCycles + stats.NumIdleCycles
 }
@@ -93,6 +227,37 @@ func getCacheMissRate(stats Stats) float64 {
 	return float64(stats.NumCacheMisses) / float64(stats.NumCacheAccesses)
 }
 
+// Misses here include the upgrades of Shared blocks, since they are served by the directory as well.
+func getMessagesPerMiss(stats DirectoryStats) float64 {
+	numMisses := stats.NumTwoHopMisses + stats.NumThreeHopMisses
+	if numMisses == 0 {
+		return 0
+	}
+	return float64(stats.NumMessages) / float64(numMisses)
+}
+
+func getL2MissRate(stats L2Stats) float64 {
+	if stats.NumAccesses == 0 {
+		return 0
+	}
+	return float64(stats.NumMisses) / float64(stats.NumAccesses)
+}
+
+func getRowBufferHitRate(stats DramStats) float64 {
+	if stats.NumAccesses == 0 {
+		return 0
+	}
+	return float64(stats.NumRowBufferHits) / float64(stats.NumAccesses)
+}
+
+// The latency includes the cycles waiting for a busy bank.
+func getAverageMemoryLatency(stats DramStats) float64 {
+	if stats.NumAccesses == 0 {
+		return 0
+	}
+	return float64(stats.NumLatencyCycles) / float64(stats.NumAccesses)
+}
+
 func getNumCacheHits(stats Stats) int {
 	return stats.NumCacheAccesses - stats.NumCacheMisses
 }
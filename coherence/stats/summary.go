@@ -0,0 +1,66 @@
+package stats
+
+import (
+	"strconv"
+	"time"
+)
+
+// Summary holds the main statistics of a whole simulation, to compare simulations with each other.
+type Summary struct {
+	Duration         time.Duration `json:"-"`
+	TotalCycles      int           `json:"total_cycles"`
+	NumCacheAccesses int           `json:"cache_accesses"`
+	NumCacheMisses   int           `json:"cache_misses"`
+	NumEvictions     int           `json:"evictions"`
+	DataTrafficOnBus int           `json:"data_traffic"` // In Bytes
+	NumInvalidations int           `json:"invalidations"`
+	NumUpdates       int           `json:"updates"`
+	NumWriteBacks    int           `json:"write_backs"`
+	MaxBusWaitCycles int           `json:"max_bus_wait_cycles"`
+}
+
+// The names of the values of a summary, in the order of Summary.Values.
+var SummaryColumns = []string{"total_cycles", "cache_accesses", "cache_misses", "cache_miss_rate", "evictions",
+	"data_traffic", "invalidations", "updates", "write_backs", "max_bus_wait_cycles", "time_ms"}
+
+func Summarize(results Results) Summary {
+	summary := Summary{
+		Duration:         results.Duration,
+		TotalCycles:      results.GetTotalCycles(),
+		NumEvictions:     results.GetTotalEvictions(),
+		DataTrafficOnBus: results.Bus.DataTraffic,
+		NumInvalidations: results.Bus.NumInvalidations,
+		NumUpdates:       results.Bus.NumUpdates,
+		NumWriteBacks:    results.Bus.NumWriteBacks,
+		MaxBusWaitCycles: results.GetMaxBusWaitCycles(),
+	}
+	for i := range results.Cores {
+		summary.NumCacheAccesses += results.Cores[i].NumCacheAccesses
+		summary.NumCacheMisses += results.Cores[i].NumCacheMisses
+	}
+	return summary
+}
+
+func (s Summary) Values() []string {
+	return []string{
+		itoa(s.TotalCycles),
+		itoa(s.NumCacheAccesses),
+		itoa(s.NumCacheMisses),
+		ftoa(s.GetCacheMissRate()),
+		itoa(s.NumEvictions),
+		itoa(s.DataTrafficOnBus),
+		itoa(s.NumInvalidations),
+		itoa(s.NumUpdates),
+		itoa(s.NumWriteBacks),
+		itoa(s.MaxBusWaitCycles),
+		strconv.FormatInt(s.Duration.Milliseconds(), 10),
+	}
+}
+
+// The miss rate over all the cores.
+func (s Summary) GetCacheMissRate() float64 {
+	if s.NumCacheAccesses == 0 {
+		return 0
+	}
+	return float64(s.NumCacheMisses) / float64(s.NumCacheAccesses)
+}
@@ -0,0 +1,248 @@
+/*
+Package scenario implements a runner of cache controller scenarios: the loads and stores of a few cores, checked against
+the expected states of the cache lines, transactions on the bus and completion cycles of the accesses.
+
+The caches are connected to an atomic or split-transaction bus and to memory with the default configuration, as in the
+simulator. They hold CacheSize bytes in blocks of BlockSize bytes with Associativity ways, so that the blocks 0x0, 0x20
+and 0x40 are in the same set and the third one evicts the least recently used of the other two.
+*/
+package scenario
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/bus"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/cache"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/clock"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/memory"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/xact"
+	"github.com/chriskheng/cs4223-assignment2/coherence/config"
+	"github.com/chriskheng/cs4223-assignment2/coherence/constants"
+	"github.com/chriskheng/cs4223-assignment2/coherence/testutils"
+)
+
+const (
+	CacheSize     = 64
+	Associativity = 2
+	BlockSize     = 16
+)
+
+// A scenario which takes more cycles than this is deadlocked.
+const maxCycles = 100000
+
+type Op int
+
+const (
+	Load Op = iota
+	Store
+)
+
+func (op Op) String() string {
+	return [...]string{"Load", "Store"}[op]
+}
+
+type Scenario struct {
+	NumCores     int
+	Accesses     []Access      // The accesses of every core are requested in the order they are given
+	States       []State       // Expected states of the cache lines once every access is complete or in their Cycle
+	Transactions []Transaction // Expected transactions on the bus in the order they are snooped. Not checked if nil
+
+	IsSplitTransaction bool // Use a split-transaction bus instead of the atomic bus
+}
+
+type Access struct {
+	Cycle   int // The core requests the access in this cycle, or as soon as its previous access is complete
+	Core    int
+	Op      Op
+	Address uint32
+	Done    int // Expected cycle in which the access is complete. Not checked if 0
+}
+
+type State struct {
+	Cycle   int // The state is checked at the end of this cycle, or once every access is complete if 0
+	Core    int
+	Address uint32
+	Name    string // Name of the state in the protocol or of its transient state, e.g. IM_D. Invalid if not cached
+}
+
+type Transaction struct {
+	Type     xact.TransactionType
+	SenderId int // constants.MemoryId for memory
+	Address  uint32
+}
+
+func (t Transaction) String() string {
+	sender := fmt.Sprintf("cache %d", t.SenderId)
+	if t.SenderId == constants.MemoryId {
+		sender = "memory"
+	}
+	return fmt.Sprintf("%s of 0x%x from %s", t.Type, t.Address, sender)
+}
+
+// NewController creates the cache controller of the protocol under test, e.g. cache.NewMesiCache.
+type NewController func(id int, bus *bus.Bus, blockSize, associativity, cacheSize int,
+	replacement cache.ReplacementConfig) cache.CacheController
+
+type runner struct {
+	scenario     Scenario
+	bus          *bus.Bus
+	memory       *memory.Memory
+	caches       []cache.CacheController
+	clock        *clock.Clock
+	queues       [][]int  // Indices of the accesses still to be requested by every core
+	isBusy       []bool   // True if the core waits for an access to complete
+	doneCycles   []int    // Cycle in which every access is complete, -1 until then
+	stateNames   []string // Name of every expected state in its cycle, empty until then
+	numDone      int
+	transactions []Transaction
+}
+
+// Run the scenario on caches created by newController and report every expectation which is not met to t.
+func Run(t testing.TB, newController NewController, s Scenario) {
+	t.Helper()
+	r := newRunner(newController, s)
+	if err := r.run(); err != nil {
+		t.Fatalf("%v\ntransactions: %s", err, formatTransactions(r.transactions))
+	}
+
+	for i, access := range s.Accesses {
+		if access.Done != 0 && r.doneCycles[i] != access.Done {
+			t.Error(testutils.GetErrorString(fmt.Sprintf("completion cycle of access %d (%s of 0x%x by core %d)", i,
+				access.Op, access.Address, access.Core), fmt.Sprint(access.Done), fmt.Sprint(r.doneCycles[i])))
+		}
+	}
+
+	r.recordStates(0)
+	for i, state := range s.States {
+		if r.stateNames[i] != state.Name {
+			identifier := fmt.Sprintf("state of 0x%x in cache %d", state.Address, state.Core)
+			if state.Cycle != 0 {
+				identifier += fmt.Sprintf(" in cycle %d", state.Cycle)
+			}
+			t.Error(testutils.GetErrorString(identifier, state.Name, r.stateNames[i]))
+		}
+	}
+
+	if s.Transactions != nil && !isSameTransactions(s.Transactions, r.transactions) {
+		t.Error(testutils.GetErrorString("transactions", formatTransactions(s.Transactions),
+			formatTransactions(r.transactions)))
+	}
+}
+
+func newRunner(newController NewController, s Scenario) *runner {
+	defaults := config.Default()
+	defaults.Bus.IsSplitTransaction = s.IsSplitTransaction
+	clock := clock.NewClock()
+	r := &runner{
+		scenario:   s,
+		bus:        bus.NewBus(defaults.Bus, BlockSize, clock),
+		clock:      clock,
+		queues:     make([][]int, s.NumCores),
+		isBusy:     make([]bool, s.NumCores),
+		doneCycles: make([]int, len(s.Accesses)),
+		stateNames: make([]string, len(s.States)),
+	}
+	r.memory = memory.NewMemory(constants.MemoryId, r.bus, defaults.Memory, BlockSize, clock)
+
+	for i := 0; i < s.NumCores; i++ {
+		r.caches = append(r.caches, newController(i, r.bus, BlockSize, Associativity, CacheSize,
+			defaults.L1.Replacement))
+	}
+	r.bus.RegisterSnoopingCallBack(func(transaction xact.Transaction) {
+		r.transactions = append(r.transactions, Transaction{
+			Type:     transaction.TransactionType,
+			SenderId: transaction.SenderId,
+			Address:  transaction.Address,
+		})
+	})
+
+	for i, access := range s.Accesses {
+		r.queues[access.Core] = append(r.queues[access.Core], i)
+		r.doneCycles[i] = -1
+	}
+	return r
+}
+
+// Simulate cycles until every access is complete. The cores and their caches go first in every cycle, then the bus
+// and memory, as in the simulator.
+func (r *runner) run() (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("cycle %d: %v", r.clock.GetCycle(), p)
+		}
+	}()
+
+	for ; r.numDone < len(r.scenario.Accesses); r.clock.Advance(1) {
+		if r.clock.GetCycle() == maxCycles {
+			return fmt.Errorf("%d of %d accesses are not complete after %d cycles",
+				len(r.scenario.Accesses)-r.numDone, len(r.scenario.Accesses), maxCycles)
+		}
+
+		for core := range r.caches {
+			r.requestNextAccess(core)
+			r.caches[core].Execute()
+		}
+		r.bus.Execute()
+		r.memory.Execute()
+		r.recordStates(r.clock.GetCycle())
+	}
+	return nil
+}
+
+// Record the names of the states expected in the given cycle.
+func (r *runner) recordStates(cycle int) {
+	for i, state := range r.scenario.States {
+		if state.Cycle != cycle {
+			continue
+		}
+		r.stateNames[i] = r.caches[state.Core].GetLineState(state.Address).GetDisplayName()
+		if r.stateNames[i] == "" {
+			r.stateNames[i] = "Invalid"
+		}
+	}
+}
+
+func (r *runner) requestNextAccess(core int) {
+	queue := r.queues[core]
+	if r.isBusy[core] || len(queue) == 0 || r.scenario.Accesses[queue[0]].Cycle > r.clock.GetCycle() {
+		return
+	}
+
+	index := queue[0]
+	r.queues[core] = queue[1:]
+	r.isBusy[core] = true
+	onComplete := func() {
+		r.doneCycles[index] = r.clock.GetCycle()
+		r.isBusy[core] = false
+		r.numDone++
+	}
+
+	access := r.scenario.Accesses[index]
+	if access.Op == Store {
+		r.caches[core].RequestWrite(access.Address, onComplete)
+	} else {
+		r.caches[core].RequestRead(access.Address, onComplete)
+	}
+}
+
+func isSameTransactions(expected []Transaction, got []Transaction) bool {
+	if len(expected) != len(got) {
+		return false
+	}
+	for i := range expected {
+		if expected[i] != got[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func formatTransactions(transactions []Transaction) string {
+	formatted := []string{}
+	for _, transaction := range transactions {
+		formatted = append(formatted, transaction.String())
+	}
+	return "[" + strings.Join(formatted, ", ") + "]"
+}
@@ -0,0 +1,140 @@
+package testutils
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	LoadOp   = 0
+	StoreOp  = 1
+	OthersOp = 2
+)
+
+type Instruction struct {
+	Op    int
+	Value uint32 // Address of a load or a store, or number of cycles of another instruction
+}
+
+// Traces are the instructions executed by every core, indexed by core.
+type Traces [][]Instruction
+
+// The generated accesses are to FuzzNumBlocks blocks of FuzzBlockSize bytes, FuzzNumBlocks / 2 of which are in each of
+// the 2 sets of a cache of FuzzCacheSize bytes with FuzzAssociativity ways, so that the caches also evict blocks.
+const (
+	FuzzCacheSize     = 64
+	FuzzAssociativity = 2
+	FuzzBlockSize     = 16
+	FuzzNumBlocks     = 8
+)
+
+// Decode the input of a fuzz test into the traces of 2 to 4 cores sharing a few blocks. The first byte gives the
+// number of cores, then every 2 bytes are an instruction: the first byte gives the core and the type of the
+// instruction, the second one the address or the number of cycles.
+func DecodeTraces(data []byte) Traces {
+	if len(data) == 0 {
+		return Traces{{}, {}}
+	}
+
+	numCores := 2 + int(data[0])%3
+	traces := make(Traces, numCores)
+	for i := 1; i+1 < len(data); i += 2 {
+		core := int(data[i]) % numCores
+		inst := Instruction{Op: int(data[i]) / numCores % 3}
+		if inst.Op == OthersOp {
+			inst.Value = 1 + uint32(data[i+1])%4
+		} else {
+			block := uint32(data[i+1]) % FuzzNumBlocks
+			word := uint32(data[i+1]) / FuzzNumBlocks % (FuzzBlockSize / 4)
+			inst.Value = block*FuzzBlockSize + word*4
+		}
+		traces[core] = append(traces[core], inst)
+	}
+	return traces
+}
+
+func (traces Traces) GetReaders() []io.Reader {
+	readers := []io.Reader{}
+	for _, trace := range traces {
+		readers = append(readers, strings.NewReader(formatTrace(trace)))
+	}
+	return readers
+}
+
+func (traces Traces) GetNumInstructions() int {
+	numInstructions := 0
+	for _, trace := range traces {
+		numInstructions += len(trace)
+	}
+	return numInstructions
+}
+
+// Write the trace of core i to <dir>/<prefix>_i.data, so that the simulator can run them with the trace prefix
+// <dir>/<prefix>.
+func (traces Traces) Write(dir string, prefix string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for i, trace := range traces {
+		path := filepath.Join(dir, fmt.Sprintf("%s_%d.data", prefix, i))
+		if err := os.WriteFile(path, []byte(formatTrace(trace)), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatTrace(trace []Instruction) string {
+	var sb strings.Builder
+	for _, inst := range trace {
+		fmt.Fprintf(&sb, "%d 0x%x\n", inst.Op, inst.Value)
+	}
+	return sb.String()
+}
+
+// Return the smallest traces found for which fails still returns true, given that it returns true for the traces.
+// Cores are removed first, then chunks of instructions of decreasing size, until no instruction can be removed.
+func Shrink(traces Traces, fails func(Traces) bool) Traces {
+	for core := 0; core < len(traces) && len(traces) > 1; {
+		candidate := append(append(Traces{}, traces[:core]...), traces[core+1:]...)
+		if fails(candidate) {
+			traces = candidate
+		} else {
+			core++
+		}
+	}
+
+	for chunkSize := (traces.GetNumInstructions() + 1) / 2; chunkSize >= 1; {
+		if !shrinkChunks(&traces, chunkSize, fails) {
+			chunkSize /= 2
+		}
+	}
+	return traces
+}
+
+// Try to remove every chunk of chunkSize instructions of every core, and return true if one is removed.
+func shrinkChunks(traces *Traces, chunkSize int, fails func(Traces) bool) bool {
+	isShrunk := false
+	for core := range *traces {
+		for start := 0; start < len((*traces)[core]); {
+			end := start + chunkSize
+			if end > len((*traces)[core]) {
+				end = len((*traces)[core])
+			}
+
+			candidate := append(Traces{}, (*traces)...)
+			trace := (*traces)[core]
+			candidate[core] = append(append([]Instruction{}, trace[:start]...), trace[end:]...)
+			if fails(candidate) {
+				*traces = candidate
+				isShrunk = true
+			} else {
+				start = end
+			}
+		}
+	}
+	return isShrunk
+}
@@ -0,0 +1,79 @@
+/*
+Package watchdog implements a Watchdog struct which stops a simulation that makes no progress, e.g. because a cache
+controller waits forever for a transaction in a deadlock, or that takes more cycles than allowed.
+*/
+package watchdog
+
+import (
+	"fmt"
+
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/core"
+	"github.com/chriskheng/cs4223-assignment2/coherence/components/xact"
+	"github.com/chriskheng/cs4223-assignment2/coherence/constants"
+)
+
+type Config struct {
+	StallCycles int    `json:"stall_cycles"` // Cycles without progress before stopping the simulation, 0 to never stop
+	MaxCycles   int    `json:"max_cycles"`   // Cycles after which the simulation is stopped, 0 for no limit
+	DumpFile    string `json:"dump_file"`    // File the state of the system is written to, not written if empty
+}
+
+// Watchdog records the instructions retired by the cores and the transactions completed on the bus or the network.
+// A cycle makes progress if either of them changes, or if a core is computing since its instruction retires later.
+type Watchdog struct {
+	config              Config
+	cores               []*core.Core
+	numTransactions     int
+	lastNumTransactions int
+	lastNumRetired      int
+	lastProgressCycle   int
+}
+
+func NewWatchdog(config Config, cores []*core.Core) *Watchdog {
+	return &Watchdog{config: config, cores: cores}
+}
+
+func (w *Watchdog) OnTransaction(transaction xact.Transaction) {
+	w.numTransactions++
+}
+
+// Record the progress made by the cycles before the given cycle, MUST call after the cycles are executed or skipped.
+func (w *Watchdog) Update(cycle int) {
+	numRetired := 0
+	isComputing := false
+	for _, core := range w.cores {
+		numRetired += core.GetNumRetiredInstructions()
+		isComputing = isComputing || core.IsComputing()
+	}
+
+	if numRetired != w.lastNumRetired || w.numTransactions != w.lastNumTransactions || isComputing {
+		w.lastProgressCycle = cycle
+	}
+	w.lastNumRetired = numRetired
+	w.lastNumTransactions = w.numTransactions
+}
+
+// Return the reason to stop the simulation before the given cycle, or an empty string if it can go on.
+func (w *Watchdog) Check(cycle int) string {
+	if w.config.MaxCycles > 0 && cycle >= w.config.MaxCycles {
+		return fmt.Sprintf("the simulation does not finish in %d cycles", w.config.MaxCycles)
+	}
+	if w.config.StallCycles > 0 && cycle-w.lastProgressCycle >= w.config.StallCycles {
+		return fmt.Sprintf("no instruction is retired and no transaction is completed for %d cycles",
+			cycle-w.lastProgressCycle)
+	}
+	return ""
+}
+
+// Return the number of cycles which can be skipped from the given cycle without going past the one in which Check
+// stops the simulation.
+func (w *Watchdog) GetNumCyclesLeft(cycle int) int {
+	numCycles := constants.IdleForever
+	if w.config.MaxCycles > 0 && w.config.MaxCycles-cycle < numCycles {
+		numCycles = w.config.MaxCycles - cycle
+	}
+	if w.config.StallCycles > 0 && w.lastProgressCycle+w.config.StallCycles-cycle < numCycles {
+		numCycles = w.lastProgressCycle + w.config.StallCycles - cycle
+	}
+	return numCycles
+}
@@ -0,0 +1,12 @@
+#!/bin/bash
+# Run this script in the experiment directory. It runs the same experiments as experiment_all.sh in parallel, and
+# writes one table for every dimension to the out directory.
+traces="../benchmarks/blackscholes_four/blackscholes,../benchmarks/bodytrack_four/bodytrack,../benchmarks/fluidanimate_four/fluidanimate"
+protocols="MESI,MESIF,Dragon"
+
+mkdir -p out
+
+cd ../coherence
+./coherence sweep -protocol $protocols -trace $traces -cache-size 64:65536 -assoc 2 -block-size 32 -format csv -output ../experiment/out/cache_size.csv
+./coherence sweep -protocol $protocols -trace $traces -cache-size 4096 -assoc 1:128 -block-size 32 -format csv -output ../experiment/out/associativity.csv
+./coherence sweep -protocol $protocols -trace $traces -cache-size 4096 -assoc 2 -block-size 4:2048 -format csv -output ../experiment/out/block_size.csv